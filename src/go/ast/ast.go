@@ -9,6 +9,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -33,6 +34,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -54,6 +62,9 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -64,14 +75,21 @@ type LetStatement struct {
 	Value       Expression
 	FileName    string
 	PackageName string
+	Exported    bool // written after export, the modules importing this one see it
 }
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
 	out.WriteString(" = ")
@@ -93,6 +111,9 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -110,17 +131,24 @@ type ExpressionStatement struct {
 	Expression  Expression
 	FileName    string
 	PackageName string
+	Exported    bool // a function, class or interface written after export
 }
 
 func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
 func (es *ExpressionStatement) String() string {
-	if es.Expression != nil {
-		return es.Expression.String()
+	if es.Expression == nil {
+		return ""
 	}
-	return ""
+	if es.Exported {
+		return "export " + es.Expression.String()
+	}
+	return es.Expression.String()
 }
 
 type IntegerLiteral struct {
@@ -130,6 +158,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type PrefixExpression struct {
@@ -140,6 +169,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -158,6 +188,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -175,8 +206,18 @@ type Boolean struct {
 
 func (bl *Boolean) expressionNode()      {}
 func (bl *Boolean) TokenLiteral() string { return bl.Token.Literal }
+func (bl *Boolean) Pos() token.Position  { return bl.Token.Pos }
 func (bl *Boolean) String() string       { return bl.Token.Literal }
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) expressionNode()      {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) Pos() token.Position  { return nl.Token.Pos }
+func (nl *NullLiteral) String() string       { return "null" }
+
 type IfExpression struct {
 	Token       token.Token
 	Condition   Expression
@@ -186,6 +227,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -205,10 +247,13 @@ type BlockStatement struct {
 	Statements      []Statement
 	DeferStatements []Statement
 	IsDeferBlock    bool
+	Defers          []*BlockStatement // the defer blocks as written, DeferStatements are those of the last one
+	Rbrace          token.Position
 }
 
 func (bs *BlockStatement) expressionNode()      {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("{")
@@ -224,12 +269,14 @@ type FunctionLiteral struct {
 	Parameters  []*Identifier
 	Body        *BlockStatement
 	Name        string
+	NamePos     token.Position // where the name of a named function is written
 	FileName    string
 	PackageName string
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
@@ -256,6 +303,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -279,8 +327,20 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// TemplateLiteral is a string holding ${...}, its parts are the StringLiterals of its text and the expressions in between
+type TemplateLiteral struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) Pos() token.Position  { return tl.Token.Pos }
+func (tl *TemplateLiteral) String() string       { return `"` + tl.Token.Literal + `"` }
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -288,6 +348,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
@@ -302,31 +363,48 @@ func (al *ArrayLiteral) String() string {
 }
 
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Optional bool       // left?.[index], null when left is null
+	Slice    bool       // left[index:high], either bound may be nil
+	High     Expression // the end of a slice
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
-	out.WriteString(ie.Index.String())
+	if ie.Index != nil {
+		out.WriteString(ie.Index.String())
+	}
+	if ie.Slice {
+		out.WriteString(":")
+		if ie.High != nil {
+			out.WriteString(ie.High.String())
+		}
+	}
 	out.WriteString("])")
 	return out.String()
 }
 
 type HashLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
-	Keys  []Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Keys   []Expression
+	Rbrace token.Position
 }
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -342,31 +420,34 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// ImportStatement is an import, the module loader resolves its path to the module it names
 type ImportStatement struct {
-	Token      token.Token
-	Statements []Statement
+	Token   token.Token
+	Path    string
+	PathPos token.Position
 }
 
+func (bs *ImportStatement) statementNode()       {}
 func (bs *ImportStatement) expressionNode()      {}
 func (bs *ImportStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *ImportStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *ImportStatement) String() string {
-	var out bytes.Buffer
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
-	}
-	return out.String()
+	return "import \"" + bs.Path + "\";"
 }
 
 type WhileExpression struct {
 	Token     token.Token
+	Label     *Identifier // nil when the loop has no label
 	Condition Expression
 	Body      *BlockStatement
 }
 
 func (we *WhileExpression) expressionNode()      {}
 func (we *WhileExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WhileExpression) Pos() token.Position  { return we.Token.Pos }
 func (we *WhileExpression) String() string {
 	var out bytes.Buffer
+	out.WriteString(labelString(we.Label))
 	out.WriteString("while")
 	out.WriteString(we.Condition.String())
 	out.WriteString(" ")
@@ -374,28 +455,6 @@ func (we *WhileExpression) String() string {
 	return out.String()
 }
 
-type HashAssignExpress struct {
-	Token token.Token
-	Hash  Identifier
-	Index Expression
-	Value Expression
-}
-
-func (hae *HashAssignExpress) expressionNode()      {}
-func (hae *HashAssignExpress) TokenLiteral() string { return hae.Token.Literal }
-func (hae *HashAssignExpress) String() string {
-	var out bytes.Buffer
-	out.WriteString("(")
-	out.WriteString(hae.Hash.String())
-	out.WriteString("[")
-	out.WriteString(hae.Index.String())
-	out.WriteString("]")
-	out.WriteString("=")
-	out.WriteString(hae.Value.String())
-	out.WriteString(")")
-	return out.String()
-}
-
 type FloatLiteral struct {
 	Token token.Token
 	Value float64
@@ -403,20 +462,55 @@ type FloatLiteral struct {
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
 type BreakExpression struct {
 	Token token.Token
+	Label *Identifier // the loop to leave, nil for the innermost one
 }
 
 func (be *BreakExpression) expressionNode() {}
 func (be *BreakExpression) TokenLiteral() string {
 	return be.Token.Literal
 }
-func (be *BreakExpression) String() string { return be.Token.Literal }
+func (be *BreakExpression) Pos() token.Position {
+	return be.Token.Pos
+}
+func (be *BreakExpression) String() string {
+	if be.Label != nil {
+		return be.Token.Literal + " " + be.Label.Value
+	}
+	return be.Token.Literal
+}
+
+// ContinueExpression goes on with the next iteration of a loop
+type ContinueExpression struct {
+	Token token.Token
+	Label *Identifier // the loop to go on with, nil for the innermost one
+}
+
+func (ce *ContinueExpression) expressionNode()      {}
+func (ce *ContinueExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ContinueExpression) Pos() token.Position  { return ce.Token.Pos }
+func (ce *ContinueExpression) String() string {
+	if ce.Label != nil {
+		return ce.Token.Literal + " " + ce.Label.Value
+	}
+	return ce.Token.Literal
+}
+
+// labelString is the label in front of a loop as it is written
+func labelString(label *Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value + ": "
+}
 
 type ForExpression struct {
 	Token     token.Token
+	Label     *Identifier // nil when the loop has no label
 	Initor    Statement
 	Condition Expression
 	Body      *BlockStatement
@@ -427,8 +521,12 @@ func (fe *ForExpression) expressionNode() {}
 func (fe *ForExpression) TokenLiteral() string {
 	return fe.Token.Literal
 }
+func (fe *ForExpression) Pos() token.Position {
+	return fe.Token.Pos
+}
 func (fe *ForExpression) String() string {
 	var out bytes.Buffer
+	out.WriteString(labelString(fe.Label))
 	out.WriteString("for")
 	out.WriteString("(")
 	out.WriteString(fe.Initor.String())
@@ -442,6 +540,36 @@ func (fe *ForExpression) String() string {
 	return out.String()
 }
 
+// ForInExpression runs its body for each element of an array, a hash, a string or the properties of an object.
+// With two names they are given the key and the value, with one name the value of an array or a string
+// and the key of a hash or an object
+type ForInExpression struct {
+	Token      token.Token
+	Label      *Identifier // nil when the loop has no label
+	Names      []*Identifier
+	Collection Expression
+	Body       *BlockStatement
+}
+
+func (fe *ForInExpression) expressionNode()      {}
+func (fe *ForInExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *ForInExpression) Pos() token.Position  { return fe.Token.Pos }
+func (fe *ForInExpression) String() string {
+	var out bytes.Buffer
+	names := []string{}
+	for _, name := range fe.Names {
+		names = append(names, name.String())
+	}
+	out.WriteString(labelString(fe.Label))
+	out.WriteString("for (")
+	out.WriteString(strings.Join(names, ", "))
+	out.WriteString(" in ")
+	out.WriteString(fe.Collection.String())
+	out.WriteString(") ")
+	out.WriteString(fe.Body.String())
+	return out.String()
+}
+
 type ClassExpress struct {
 	Token         token.Token
 	Name          *Identifier
@@ -449,12 +577,16 @@ type ClassExpress struct {
 	Interface     *Identifier
 	LetStatements []*LetStatement
 	Functions     []*FunctionLiteral
+	Rbrace        token.Position
 }
 
 func (ce *ClassExpress) expressionNode() {}
 func (ce *ClassExpress) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *ClassExpress) Pos() token.Position {
+	return ce.Token.Pos
+}
 func (ce *ClassExpress) String() string {
 	var out bytes.Buffer
 	out.WriteString("class")
@@ -495,6 +627,9 @@ func (oe *ObjectExpress) expressionNode() {}
 func (oe *ObjectExpress) TokenLiteral() string {
 	return oe.Token.Literal
 }
+func (oe *ObjectExpress) Pos() token.Position {
+	return oe.Token.Pos
+}
 func (oe *ObjectExpress) String() string {
 	var out bytes.Buffer
 	out.WriteString("new")
@@ -517,12 +652,16 @@ type InterfaceExpress struct {
 	Name      Identifier
 	Parents   []*Identifier
 	Functions []*FunctionLiteral
+	Rbrace    token.Position
 }
 
 func (ie *InterfaceExpress) expressionNode() {}
 func (ie *InterfaceExpress) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *InterfaceExpress) Pos() token.Position {
+	return ie.Token.Pos
+}
 func (ie *InterfaceExpress) String() string {
 	var out bytes.Buffer
 	out.WriteString(ie.Token.Literal)
@@ -546,3 +685,60 @@ func (ie *InterfaceExpress) String() string {
 	out.WriteString(" }")
 	return out.String()
 }
+
+type TryExpression struct {
+	Token     token.Token
+	Block     *BlockStatement
+	Parameter *Identifier // name the caught error is bound to, nil when omitted
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+func (te *TryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+	if te.Catch != nil {
+		out.WriteString(" catch ")
+		if te.Parameter != nil {
+			out.WriteString("(")
+			out.WriteString(te.Parameter.String())
+			out.WriteString(") ")
+		}
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+	return out.String()
+}
+
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+func (ts *ThrowStatement) TokenLiteral() string {
+	return ts.Token.Literal
+}
+func (ts *ThrowStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
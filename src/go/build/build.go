@@ -2,6 +2,8 @@ package build
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"z/ast"
 	"z/evaluator"
 	"z/object"
@@ -23,9 +25,11 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, string) {
 		case "STRING":
 			return nil, "char *" + node.Name.Value + " = " + val + ";\n"
 		case "INTEGER":
-			return nil, "int " + node.Name.Value + " = " + val + ";\n"
+			return nil, "long long " + node.Name.Value + " = " + val + ";\n"
 		case "FLOAT":
 			return nil, "double " + node.Name.Value + " = " + val + ";\n"
+		case "BOOLEAN":
+			return nil, "int " + node.Name.Value + " = " + val + ";\n"
 		}
 	case *ast.Identifier:
 		object := evalIdentifier(node, env)
@@ -39,48 +43,60 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, string) {
 		case "puts":
 			for _, argument := range node.Arguments {
 				object, argumentRes := Eval(argument, env)
-				if object.Type() == "STRING" {
-					callString += "printf(\"%s\"," + argumentRes + ");\n"
-				}
-				if object.Type() == "INTEGER" {
-					callString += "printf(\"%d\"," + argumentRes + ");\n"
-				}
-				if object.Type() == "FLOAT" {
-					callString += "printf(\"%f\"," + argumentRes + ");\n"
+				if format, arg := printed(object, argumentRes); format != "" {
+					callString += "printf(\"" + format + "\"," + arg + ");\n"
 				}
 			}
 		}
 		return nil, callString
 	case *ast.StringLiteral:
-		return &object.String{}, string("\"" + node.Value + "\"")
+		return &object.String{}, cString(node.Value)
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
 	case *ast.IntegerLiteral:
-		return &object.Integer{}, node.String()
+		return &object.Integer{}, strconv.FormatInt(node.Value, 10)
 	case *ast.FloatLiteral:
-		return &object.Float{}, node.String()
+		float := strconv.FormatFloat(node.Value, 'g', -1, 64)
+		if !strings.ContainsAny(float, ".e") {
+			float += ".0"
+		}
+		return &object.Float{}, float
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.PrefixExpression:
+		right, code := Eval(node.Right, env)
+		if right == nil {
+			return nil, "convert failed"
+		}
+		if node.Operator == "!" {
+			return &object.Boolean{}, "(!" + code + ")"
+		}
+		return right, "(" + node.Operator + code + ")"
 	case *ast.InfixExpression:
 		left, code := Eval(node.Left, env)
 		infixString := ""
 		if isError(left) {
 			return left, code
 		}
+		right, rightCode := Eval(node.Right, env)
+		if object.IsNumber(left) && object.IsNumber(right) {
+			return evalNumberInfixExpression(node.Operator, left, code, right, rightCode)
+		}
 		if left.Type() == "STRING" {
 			infixString += "\"" + code + "\""
 		} else {
 			infixString += code
 		}
-		right, code := Eval(node.Right, env)
 		if isError(right) {
-			return right, code
+			return right, rightCode
 		}
 		infixString += node.Operator
 		if right.Type() == "STRING" {
-			infixString += "\"" + code + "\""
+			infixString += "\"" + rightCode + "\""
 		} else {
-			infixString += code
+			infixString += rightCode
 		}
 		return left, infixString
 	case *ast.BlockStatement:
@@ -91,6 +107,171 @@ func Eval(node ast.Node, env *object.Environment) (object.Object, string) {
 	return nil, "convert failed"
 }
 
+// runtimeFunctions name the functions of Runtime doing the operators c has not or does not check, like z_int_div
+var runtimeFunctions = map[string]string{"/": "div", "%": "mod", "**": "pow", "<<": "shl", ">>": "shr"}
+
+// evalNumberInfixExpression is an operator on two numbers, the checks of object.Arithmetic are done by the functions of Runtime.
+// The operation is in parentheses as z and c do not agree on the precedence of the bitwise operators
+func evalNumberInfixExpression(operator string, left object.Object, leftCode string, right object.Object, rightCode string) (object.Object, string) {
+	integers := left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ
+	switch operator {
+	case "<", "<=", ">", ">=", "==", "!=":
+		return &object.Boolean{}, "(" + leftCode + " " + operator + " " + rightCode + ")"
+	case "+", "-", "*", "&", "|", "^":
+		if integers { // long long, so that int literals do not overflow
+			return left, "((long long)" + leftCode + " " + operator + " " + rightCode + ")"
+		}
+		if operator == "+" || operator == "-" || operator == "*" {
+			return &object.Float{}, "(" + leftCode + " " + operator + " " + rightCode + ")"
+		}
+	case "/", "%", "**", "<<", ">>":
+		if integers {
+			return left, "z_int_" + runtimeFunctions[operator] + "(" + leftCode + ", " + rightCode + ")"
+		}
+		if operator != "<<" && operator != ">>" {
+			return &object.Float{}, "z_float_" + runtimeFunctions[operator] + "(" + leftCode + ", " + rightCode + ")"
+		}
+	}
+	return nil, "convert failed"
+}
+
+// printed is the printf format and argument printing a value the way puts does, no format for the values c can not print
+func printed(value object.Object, code string) (string, string) {
+	if value == nil {
+		return "", ""
+	}
+	switch value.Type() {
+	case object.STRING_OBJ:
+		return "%s", code
+	case object.INTEGER_OBJ:
+		return "%lld", code
+	case object.FLOAT_OBJ:
+		return "%s", "z_float(" + code + ")"
+	case object.BOOLEAN_OBJ:
+		return "%s", "(" + code + " ? \"true\" : \"false\")"
+	}
+	return "", ""
+}
+
+// evalTemplateLiteral formats the parts of a string with z_format, the helper Runtime defines
+func evalTemplateLiteral(tl *ast.TemplateLiteral, env *object.Environment) (object.Object, string) {
+	format := ""
+	args := ""
+	for _, part := range tl.Parts {
+		if text, ok := part.(*ast.StringLiteral); ok {
+			format += strings.ReplaceAll(text.Value, "%", "%%")
+			continue
+		}
+		value, code := Eval(part, env)
+		partFormat, arg := printed(value, code)
+		if partFormat == "" {
+			return nil, "convert failed"
+		}
+		format += partFormat
+		args += ", " + arg
+	}
+	return &object.String{}, "z_format(" + cString(format) + args + ")"
+}
+
+// cString is a C string literal of s
+func cString(s string) string {
+	var out strings.Builder
+	out.WriteString(`"`)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			out.WriteString(`\` + string(c))
+		case c == '\n':
+			out.WriteString(`\n`)
+		case c == '\t':
+			out.WriteString(`\t`)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&out, "\\%03o", c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
+
+// CFlags are the gcc flags the generated c needs, after its source file:
+// integers wrap around when they overflow like in z, and the functions of math.h are linked
+var CFlags = []string{"-fwrapv", "-lm"}
+
+// Runtime is the c the generated code needs before its main
+const Runtime = `#include <stdarg.h>
+#include <string.h>
+#include <math.h>
+char *z_format(const char *format, ...) {
+  va_list args;
+  va_start(args, format);
+  int length = vsnprintf(NULL, 0, format, args);
+  va_end(args);
+  char *s = malloc(length + 1);
+  va_start(args, format);
+  vsnprintf(s, length + 1, format, args);
+  va_end(args);
+  return s;
+}
+void z_fail(const char *message, long long n) {
+  fprintf(stderr, "ERROR: ");
+  fprintf(stderr, message, n);
+  fprintf(stderr, "\n");
+  exit(1);
+}
+long long z_int_div(long long a, long long b) {
+  if (b == 0) z_fail("division by zero", 0);
+  return b == -1 ? -a : a / b;
+}
+long long z_int_mod(long long a, long long b) {
+  if (b == 0) z_fail("division by zero", 0);
+  return b == -1 ? 0 : a % b;
+}
+long long z_int_pow(long long a, long long b) {
+  if (b < 0) z_fail("negative exponent %lld of an integer, use a float", b);
+  long long result = 1;
+  for (; b > 0; b >>= 1) {
+    if (b & 1) result *= a;
+    a *= a;
+  }
+  return result;
+}
+long long z_int_shl(long long a, long long b) {
+  if (b < 0) z_fail("negative shift count %lld", b);
+  return b >= 64 ? 0 : (long long)((unsigned long long)a << b);
+}
+long long z_int_shr(long long a, long long b) {
+  if (b < 0) z_fail("negative shift count %lld", b);
+  return b >= 64 ? (a < 0 ? -1 : 0) : a >> b;
+}
+double z_float_div(double a, double b) {
+  if (b == 0) z_fail("division by zero", 0);
+  return a / b;
+}
+double z_float_mod(double a, double b) {
+  if (b == 0) z_fail("division by zero", 0);
+  return fmod(a, b);
+}
+double z_float_pow(double a, double b) {
+  return pow(a, b);
+}
+/* z_float prints a float like z does, with the fewest digits that read back as it */
+char *z_float(double f) {
+  if (isnan(f)) return "NaN";
+  if (isinf(f)) return f > 0 ? "+Inf" : "-Inf";
+  char digits[32];
+  int precision = 1;
+  for (; precision < 17; precision++) {
+    snprintf(digits, sizeof digits, "%.*e", precision - 1, f);
+    if (strtod(digits, NULL) == f) break;
+  }
+  int exponent = f == 0 ? 0 : atoi(strchr(digits, 'e') + 1);
+  if (exponent < -4 || exponent >= 6) return z_format("%.*e", precision - 1, f);
+  return z_format("%.*f", precision - 1 - exponent > 0 ? precision - 1 - exponent : 0, f);
+}
+`
+
 func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) (object.Object, string) {
 	condition, conditionString := Eval(we.Condition, env)
 	compileCode := "while("
@@ -131,7 +312,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 		return builtin
 	}
 	if !ok {
-		fmt.Println("identifier not found:", node.Value)
+		fmt.Println("undefined variable", node.Value)
 	}
 	return val
 }
@@ -18,7 +18,12 @@ func BuildSourceCode(sourceCode string, sourceFile string) {
 	var duration time.Duration
 	start := time.Now()
 	fmt.Println("begin to build code")
-	compiledCode := parseAstToC(sourceCode)
+	// c has no namespaces, the modules are generated one after the other in a single main
+	program := &ast.Program{}
+	for _, m := range loadOrExit(sourceCode, sourceFile, os.Stdout).Order() {
+		program.Statements = append(program.Statements, m.Program.Statements...)
+	}
+	compiledCode := generateProgram(program, object.NewEnvironment())
 	fileName := filepath.Base(sourceFile)
 	outFileName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
 	compileC(compiledCode, outFileName)
@@ -26,15 +31,6 @@ func BuildSourceCode(sourceCode string, sourceFile string) {
 	fmt.Printf("build execute time is :%s\n", duration)
 }
 
-func parseAstToC(sourceCode string) string {
-	l := lexer.New(sourceCode)
-	p := parser.New(l)
-	program := p.ParseProgram()
-	env := object.NewEnvironment()
-	compiledCode := generateProgram(program, env)
-	return compiledCode
-}
-
 func ConvertZToC(sourceCode string, isWrapper bool) string {
 	l := lexer.New(sourceCode)
 	p := parser.New(l)
@@ -54,6 +50,7 @@ func generateProgram(program *ast.Program, env *object.Environment) string {
 	compiledCode := generateCompiledCode(program, env)
 	generatedCompiledCode += "#include <stdio.h>\n"
 	generatedCompiledCode += "#include <stdlib.h>\n"
+	generatedCompiledCode += build.Runtime
 	generatedCompiledCode += "int main() {\n"
 	generatedCompiledCode += compiledCode + "\n"
 	generatedCompiledCode += "}\n"
@@ -77,7 +74,7 @@ func compileC(code string, outFile string) {
 	}
 	_, _ = file.WriteString(code)
 	file.Close()
-	cmd := exec.Command("gcc", tempFileName, "-o", outFile)
+	cmd := exec.Command("gcc", append([]string{tempFileName, "-o", outFile}, build.CFlags...)...)
 	_, err = cmd.Output()
 	if err != nil {
 		fmt.Println(err.Error())
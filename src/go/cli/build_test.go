@@ -16,7 +16,7 @@ func TestConvertZToC(t *testing.T) {
 		},
 		{
 			`let age = 18`,
-			`int age = 18;`,
+			`long long age = 18;`,
 		},
 		{
 			`let age = 12; if (age > 18) {}`,
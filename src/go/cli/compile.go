@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"z/compile"
+	"z/module"
+)
+
+// CompileSourceCode compiles the source code to bytecode and writes it to outFile,
+// the .zc file next to the source file when outFile is empty
+func CompileSourceCode(sourceCode string, fileName string, outFile string) {
+	if outFile == "" {
+		outFile = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".zc"
+	}
+	main := loadOrExit(sourceCode, fileName, os.Stdout)
+	comp := compile.New()
+	err := comp.CompileModule(main)
+	if err != nil {
+		fmt.Printf("compile error: %s\n", err)
+		return
+	}
+	file, err := os.Create(outFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer file.Close()
+	err = compile.WriteBytecode(file, comp.Bytecode())
+	if err != nil {
+		fmt.Printf("write bytecode error: %s\n", err)
+	}
+}
+
+// LoadFile loads a source file as the main module of a program with the modules it imports and the prelude,
+// like z run does before evaluating it
+func LoadFile(fileName string) (*module.Module, error) {
+	fileContent, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return loadModule(string(fileContent), fileName)
+}
+
+// CompileFile compiles a source file with the prelude, like z run does before running it with the vm
+func CompileFile(fileName string) (*compile.Bytecode, error) {
+	main, err := LoadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	comp := compile.New()
+	err = comp.CompileModule(main)
+	if err != nil {
+		return nil, fmt.Errorf("compile error: %w", err)
+	}
+	return comp.Bytecode(), nil
+}
+
+// RunBytecodeFile runs a .zc file written by CompileSourceCode with the vm
+func RunBytecodeFile(fileName string) {
+	bytecode, err := loadBytecodeFile(fileName)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	runBytecode(bytecode)
+}
+
+// DisasmSourceCode prints the bytecode the source code compiles to
+func DisasmSourceCode(sourceCode string, fileName string) {
+	main := loadOrExit(sourceCode, fileName, os.Stdout)
+	comp := compile.New()
+	err := comp.CompileModule(main)
+	if err != nil {
+		fmt.Printf("compile error: %s\n", err)
+		return
+	}
+	fmt.Print(compile.Disassemble(comp.Bytecode()))
+}
+
+// DisasmBytecodeFile prints the bytecode of a .zc file
+func DisasmBytecodeFile(fileName string) {
+	bytecode, err := loadBytecodeFile(fileName)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Print(compile.Disassemble(bytecode))
+}
+
+func loadBytecodeFile(fileName string) (*compile.Bytecode, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	bytecode, err := compile.ReadBytecode(file)
+	if err != nil {
+		return nil, fmt.Errorf("load %s error: %w", fileName, err)
+	}
+	return bytecode, nil
+}
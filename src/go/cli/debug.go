@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"z/compile"
+	"z/debug"
+	"z/object"
+	"z/token"
+	"z/vm"
+)
+
+const debugHelp = `commands:
+  break [file:]line   pause at a line, without a line list the breakpoints
+  clear [file:]line   remove a breakpoint
+  continue, c         run to the next breakpoint
+  step, s             run to the next line, into called functions
+  next, n             run to the next line of this function
+  out, o              run until this function returns
+  locals, l           print the locals of this function
+  free, f             print the variables this closure captured
+  globals, g          print the globals
+  print, p name       print a variable
+  stack               print the operand stack
+  where, bt           print the call stack
+  list                print the source around this line
+  quit, q             stop the program
+an empty line repeats the last command
+`
+
+// DebugSourceCode runs the source code with the vm under a debugger,
+// it pauses at the first line of the file and reads commands from in
+func DebugSourceCode(sourceCode string, fileName string, in io.Reader, out io.Writer) {
+	main := loadOrExit(sourceCode, fileName, out)
+	comp := compile.New()
+	err := comp.CompileModule(main)
+	if err != nil {
+		fmt.Fprintf(out, "compile error: %s\n", err)
+		return
+	}
+	session := &debugSession{
+		scanner:  bufio.NewScanner(in),
+		out:      out,
+		fileName: absolutePath(fileName),
+		sources:  map[string][]string{},
+	}
+	session.debugger = vm.NewDebugger(session.pause)
+	machine := vm.New(comp.Bytecode())
+	machine.SetDebugger(session.debugger)
+	fmt.Fprintln(out, "z debug, type help for the commands")
+
+	err = machine.Run()
+	switch {
+	case err == vm.ErrStopped:
+		fmt.Fprintln(out, "stopped")
+	case err != nil:
+		fmt.Fprintf(out, "ERROR: %s\n", err)
+		if runtimeError, ok := err.(*vm.RuntimeError); ok {
+			fmt.Fprint(out, runtimeError.Stack)
+		}
+	default:
+		fmt.Fprintln(out, "program finished")
+	}
+}
+
+type debugSession struct {
+	debugger    *vm.Debugger
+	scanner     *bufio.Scanner
+	out         io.Writer
+	fileName    string // the absolute name of the debugged file
+	started     bool   // the program reached the debugged file, the lines of the prelude are not paused at
+	lastCommand string
+	sources     map[string][]string
+}
+
+// pause reads commands until one of them lets the program go on
+func (s *debugSession) pause(machine *vm.VM, reason debug.PauseReason) debug.StepMode {
+	pos := machine.Position()
+	if !s.started {
+		if pos.FileName != s.fileName {
+			return debug.StepInto
+		}
+		s.started = true
+	}
+	fmt.Fprintf(s.out, "stopped at %s\n", pos)
+	s.printLines(pos, 0)
+	for {
+		fmt.Fprint(s.out, "(zdb) ")
+		if !s.scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return debug.Stop
+		}
+		command := strings.TrimSpace(s.scanner.Text())
+		if command == "" {
+			command = s.lastCommand
+		}
+		s.lastCommand = command
+		if mode, ok := s.execute(machine, command); ok {
+			return mode
+		}
+	}
+}
+
+// execute runs one command, ok is true for the commands that let the program go on
+func (s *debugSession) execute(machine *vm.VM, command string) (mode debug.StepMode, ok bool) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	argument := strings.Join(fields[1:], " ")
+	switch fields[0] {
+	case "continue", "c":
+		return debug.Continue, true
+	case "step", "s":
+		return debug.StepInto, true
+	case "next", "n":
+		return debug.StepOver, true
+	case "out", "o":
+		return debug.StepOut, true
+	case "quit", "q":
+		return debug.Stop, true
+	case "break", "b":
+		if argument == "" {
+			for _, b := range s.debugger.Breakpoints() {
+				fmt.Fprintf(s.out, "%s:%d\n", b.FileName, b.Line)
+			}
+			break
+		}
+		b, err := s.breakpoint(argument)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			break
+		}
+		s.debugger.SetBreakpoints(append(s.debugger.Breakpoints(), b))
+		fmt.Fprintf(s.out, "breakpoint at %s:%d\n", b.FileName, b.Line)
+	case "clear":
+		b, err := s.breakpoint(argument)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			break
+		}
+		breakpoints := []debug.Breakpoint{}
+		for _, other := range s.debugger.Breakpoints() {
+			if other != b {
+				breakpoints = append(breakpoints, other)
+			}
+		}
+		s.debugger.SetBreakpoints(breakpoints)
+	case "locals", "l":
+		s.printVariables(machine.Locals(0))
+	case "free", "f":
+		s.printVariables(machine.FreeVariables(0))
+	case "globals", "g":
+		s.printVariables(machine.Globals())
+	case "print", "p":
+		s.printVariable(machine, argument)
+	case "stack":
+		for i, value := range machine.OperandStack() {
+			fmt.Fprintf(s.out, "%4d  %s\n", i, inspectValue(value))
+		}
+	case "where", "bt":
+		fmt.Fprint(s.out, machine.CallStack())
+	case "list":
+		s.printLines(machine.Position(), 5)
+	case "help", "h":
+		fmt.Fprint(s.out, debugHelp)
+	default:
+		fmt.Fprintf(s.out, "unknown command %q, type help for the commands\n", fields[0])
+	}
+	return 0, false
+}
+
+// breakpoint parses [file:]line, a breakpoint without a file is in the debugged file
+func (s *debugSession) breakpoint(argument string) (debug.Breakpoint, error) {
+	b := debug.Breakpoint{FileName: s.fileName}
+	lineText := argument
+	if i := strings.LastIndex(argument, ":"); i >= 0 {
+		b.FileName = argument[:i]
+		lineText = argument[i+1:]
+	}
+	line, err := strconv.Atoi(lineText)
+	if err != nil || line < 1 {
+		return b, fmt.Errorf("want a line as [file:]line, got %q", argument)
+	}
+	b.Line = line
+	return b, nil
+}
+
+func (s *debugSession) printVariables(variables []vm.Variable) {
+	for _, variable := range variables {
+		fmt.Fprintf(s.out, "%s = %s\n", variable.Name, inspectValue(variable.Value))
+	}
+}
+
+func (s *debugSession) printVariable(machine *vm.VM, name string) {
+	value, ok := machine.LookupVariable(0, name)
+	if !ok {
+		fmt.Fprintf(s.out, "%s is not defined here\n", name)
+		return
+	}
+	fmt.Fprintln(s.out, inspectValue(value))
+}
+
+// printLines prints the line of pos with context lines around it
+func (s *debugSession) printLines(pos token.Position, context int) {
+	lines, ok := s.sources[pos.FileName]
+	if !ok {
+		content, err := Resolver().ReadFile(pos.FileName)
+		if err == nil {
+			lines = strings.Split(string(content), "\n")
+		}
+		s.sources[pos.FileName] = lines
+	}
+	for line := pos.Line - context; line <= pos.Line+context; line++ {
+		if line < 1 || line > len(lines) {
+			continue
+		}
+		marker := " "
+		if line == pos.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(s.out, "%s %4d  %s\n", marker, line, lines[line-1])
+	}
+}
+
+func inspectValue(value object.Object) string {
+	if value == nil {
+		return "<nil>"
+	}
+	return value.Inspect()
+}
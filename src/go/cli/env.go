@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"z/module"
+	"z/stdlib"
+)
+
+// ZRoot is the directory the standard library is in: Z_ROOT, or the directory of the z binary or the one above it,
+// dist/.., when it is not set
+func ZRoot() string {
+	envZRoot, ok := os.LookupEnv("Z_ROOT")
+	if ok {
+		return envZRoot
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	dir := filepath.Dir(executable)
+	for _, root := range []string{dir, filepath.Dir(dir)} {
+		if info, err := os.Stat(filepath.Join(root, "standard")); err == nil && info.IsDir() {
+			return root
+		}
+	}
+	return dir
+}
+
+// Resolver finds imports in the directories of Z_PATH and in the standard library of ZRoot,
+// or in the one built into z for the files ZRoot does not have
+func Resolver() *module.Resolver {
+	resolver := module.NewResolver(ZRoot(), os.Getenv("Z_PATH"))
+	resolver.Embedded = stdlib.FS
+	return resolver
+}
+
+// EnvCommand is z env [file]: it prints the roots z uses and the directories the imports of file,
+// or of a file in the working directory, are looked for in
+func EnvCommand(args []string, out io.Writer, errOut io.Writer) bool {
+	if len(args) > 1 {
+		fmt.Fprintln(errOut, "usage: z env [file]")
+		return false
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return false
+	}
+	if len(args) == 1 {
+		dir = filepath.Dir(absolutePath(args[0]))
+	}
+	resolver := Resolver()
+	fmt.Fprintf(out, "Z_ROOT=%q\n", ZRoot())
+	fmt.Fprintf(out, "Z_PATH=%q\n", os.Getenv("Z_PATH"))
+	root := module.ProjectRoot(dir)
+	fmt.Fprintf(out, "Z_PROJECT=%q\n", root)
+	fmt.Fprintln(out, "import search path:")
+	for _, searched := range resolver.SearchPath(dir) {
+		fmt.Fprintf(out, "\t%s\n", searched)
+	}
+	if root == "" {
+		return true
+	}
+	manifest, err := module.ReadManifest(root)
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return false
+	}
+	if len(manifest.Requires) > 0 {
+		fmt.Fprintln(out, "dependencies, imported as name/file:")
+	}
+	for _, r := range manifest.Requires {
+		fmt.Fprintf(out, "\t%s %s", r.Name, r.Source)
+		if r.IsGit() {
+			fmt.Fprintf(out, " %s", r.Version)
+		}
+		fmt.Fprintln(out)
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"z/format"
+	"z/module"
+)
+
+// FormatCommand is z fmt [-w] [-d] path...: it formats .z files and the .z files under directories,
+// printing them, rewriting them with -w or printing what would change with -d.
+// It returns false when a file could not be formatted
+func FormatCommand(args []string, out io.Writer, errOut io.Writer) bool {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	write := flags.Bool("w", false, "write the result to the file instead of printing it")
+	diff := flags.Bool("d", false, "print a diff instead of the formatted source")
+	flags.Usage = func() {
+		fmt.Fprintln(errOut, "usage: z fmt [-w] [-d] path...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return false
+	}
+
+	ok := true
+	for _, path := range flags.Args() {
+		files, err := sourceFiles(path)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			ok = false
+			continue
+		}
+		for _, file := range files {
+			if err := formatFile(file, *write, *diff, out); err != nil {
+				fmt.Fprintln(errOut, err)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// sourceFiles is the file at path, or the .z files under it when it is a directory
+func sourceFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	files := []string{}
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		// the vendored copies of dependencies are not the project's to change
+		if err == nil && entry.IsDir() && entry.Name() == module.VendorDir {
+			return filepath.SkipDir
+		}
+		if err == nil && !entry.IsDir() && strings.HasSuffix(file, ".z") {
+			files = append(files, file)
+		}
+		return err
+	})
+	return files, err
+}
+
+func formatFile(fileName string, write bool, diff bool, out io.Writer) error {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	formatted, err := format.Source(string(src), fileName)
+	if err != nil {
+		return err
+	}
+	if diff {
+		fmt.Fprint(out, format.Diff(fileName+".orig", fileName, string(src), formatted))
+	}
+	if write {
+		if formatted == string(src) {
+			return nil
+		}
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(fileName, []byte(formatted), info.Mode().Perm())
+	}
+	if !diff {
+		fmt.Fprint(out, formatted)
+	}
+	return nil
+}
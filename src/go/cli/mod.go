@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"z/module"
+)
+
+const modUsage = `usage: z mod command
+  init name   write the z.mod of a project named name in this directory
+  tidy        drop the dependencies nothing imports from z.mod, write z.lock with the commit and the hash of the others
+  vendor      copy the dependencies to vendor at the commits of z.lock, imports find them there`
+
+// ModCommand is z mod init|tidy|vendor, it manages the dependencies of the project of the working directory.
+// It returns false when the command failed
+func ModCommand(args []string, out io.Writer, errOut io.Writer) bool {
+	if len(args) == 0 {
+		fmt.Fprintln(errOut, modUsage)
+		return false
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return false
+	}
+	if args[0] == "init" {
+		if len(args) != 2 {
+			fmt.Fprintln(errOut, "usage: z mod init name")
+			return false
+		}
+		err = module.InitProject(wd, args[1])
+	} else {
+		root := module.ProjectRoot(wd)
+		if root == "" {
+			fmt.Fprintf(errOut, "no %s in this directory or above, run z mod init\n", module.ManifestFile)
+			return false
+		}
+		switch args[0] {
+		case "tidy":
+			var removed []string
+			removed, err = module.Tidy(root)
+			for _, name := range removed {
+				fmt.Fprintf(out, "removed %s, nothing imports it\n", name)
+			}
+		case "vendor":
+			err = module.Vendor(root)
+		default:
+			fmt.Fprintln(errOut, modUsage)
+			return false
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(errOut, err)
+		return false
+	}
+	return true
+}
@@ -2,43 +2,70 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"strings"
+	"path/filepath"
 	"z/compile"
 	"z/evaluator"
-	"z/lexer"
+	"z/module"
 	"z/object"
-	"z/parser"
 	"z/vm"
 )
 
 func RunSourceCode(sourceCode string, mode string, fileName string) {
-	l := lexer.New(sourceCode)
-	p := parser.New(l)
-	wd, _ := os.Getwd()
-	l.SetFileName(wd + "/" + fileName)
-	filePaths := strings.Split(fileName, "/")
-	runSourceDir := strings.Join(filePaths[0:len(filePaths)-1], "/")
-	runSourceDir = wd + "/" + runSourceDir
-	p.SetRunSourceDir(runSourceDir)
-	program := p.ParseProgram()
-	if mode != "vm" {
+	main := loadOrExit(sourceCode, fileName, os.Stdout)
+	if mode == "vm" {
 		comp := compile.New()
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Printf("compile error: %s", err)
-		}
-		machine := vm.New(comp.Bytecode())
-		err = machine.Run()
+		err := comp.CompileModule(main)
 		if err != nil {
-			fmt.Printf("vm error: %s", err)
+			fmt.Printf("compile error: %s\n", err)
+			return
 		}
+		runBytecode(comp.Bytecode())
 	} else {
-		env := object.NewEnvironment()
-		result := evaluator.Eval(program, env)
-		_, ok := result.(*object.Error)
-		if ok {
-			fmt.Println(result)
+		result := evaluator.EvalModule(main)
+		errorObject, ok := result.(*object.Error)
+		if ok && !errorObject.Caught {
+			fmt.Println(errorObject.Inspect())
+			fmt.Print(errorObject.Stack)
+		}
+	}
+}
+
+// loadModule loads the source code of a file as the main module of a program, with the modules it imports
+// and the prelude, standard/builtin.z. The error lists every parse and import error when there are some
+func loadModule(sourceCode string, fileName string) (*module.Module, error) {
+	loader := module.NewLoader(Resolver())
+	return loader.LoadSource(absolutePath(fileName), sourceCode)
+}
+
+// loadOrExit loads the main module for a command, a program with parse errors is not run:
+// the errors are printed and z exits with 1
+func loadOrExit(sourceCode string, fileName string, out io.Writer) *module.Module {
+	main, err := loadModule(sourceCode, fileName)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		os.Exit(1)
+	}
+	return main
+}
+
+// absolutePath is the file name positions are reported with
+func absolutePath(fileName string) string {
+	if filepath.IsAbs(fileName) {
+		return fileName
+	}
+	wd, _ := os.Getwd()
+	return wd + "/" + fileName
+}
+
+func runBytecode(bytecode *compile.Bytecode) {
+	machine := vm.New(bytecode)
+	err := machine.Run()
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err)
+		if runtimeError, ok := err.(*vm.RuntimeError); ok {
+			fmt.Print(runtimeError.Stack)
 		}
 	}
 }
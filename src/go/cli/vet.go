@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"z/module"
+	"z/vet"
+)
+
+// VetCommand is z vet path...: it reports the mistakes found in .z files and in the .z files under directories.
+// It returns false when a file has findings or could not be checked
+func VetCommand(args []string, resolver *module.Resolver, out io.Writer, errOut io.Writer) bool {
+	flags := flag.NewFlagSet("vet", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() {
+		fmt.Fprintln(errOut, "usage: z vet path...")
+		fmt.Fprintln(errOut, "a finding is silenced by a // vet:ignore rule comment on its line or on the line above")
+	}
+	if err := flags.Parse(args); err != nil {
+		return false
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return false
+	}
+
+	ok := true
+	for _, path := range flags.Args() {
+		files, err := sourceFiles(path)
+		if err != nil {
+			fmt.Fprintln(errOut, err)
+			ok = false
+			continue
+		}
+		for _, file := range files {
+			findings, err := vet.File(file, resolver)
+			if err != nil {
+				fmt.Fprintln(errOut, err)
+				ok = false
+				continue
+			}
+			for _, finding := range findings {
+				fmt.Fprintln(out, finding)
+				ok = false
+			}
+		}
+	}
+	return ok
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
+	"z/token"
 )
 
 type Instructions []byte
@@ -42,7 +44,37 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
-	OpWhile
+	OpTry
+	OpEndTry
+	OpThrow
+	OpAnd
+	OpOr
+	OpSetFree
+	OpSetIndex
+	OpGetProperty
+	OpGetStatic
+	OpGetField
+	OpSetField
+	OpThis
+	OpClass
+	OpNew
+	OpTemplate
+	OpMod
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpIterator
+	OpIteratorNext
+	OpJumpNull    // jumps when the value on top of the stack is null, keeping it
+	OpJumpNotNull // jumps when the value on top of the stack is not null, keeping it, else pops it
+	OpSlice       // left[low:high], a bound left out is null
+	OpIndexKeep   // like OpIndex, keeping the left side and the index under the element for an OpSetIndex
+	OpIteratorClose
+	OpCaptureLocal // pushes the cell of a local a closure captures, putting the local in a cell first
+	OpCaptureFree  // pushes the cell of a free variable a closure captures again
 )
 
 type Defination struct {
@@ -82,6 +114,37 @@ var definations = map[OpCode]*Defination{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpTry:            {"OpTry", []int{2}},
+	OpEndTry:         {"OpEndTry", []int{}},
+	OpThrow:          {"OpThrow", []int{}},
+	OpAnd:            {"OpAnd", []int{}},
+	OpOr:             {"OpOr", []int{}},
+	OpSetFree:        {"OpSetFree", []int{1}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+	OpGetProperty:    {"OpGetProperty", []int{2}},
+	OpGetStatic:      {"OpGetStatic", []int{2}},
+	OpGetField:       {"OpGetField", []int{2}},
+	OpSetField:       {"OpSetField", []int{2}},
+	OpThis:           {"OpThis", []int{}},
+	OpClass:          {"OpClass", []int{2, 2, 1}},
+	OpNew:            {"OpNew", []int{1}},
+	OpTemplate:       {"OpTemplate", []int{2}},
+	OpMod:            {"OpMod", []int{}},
+	OpPow:            {"OpPow", []int{}},
+	OpBitAnd:         {"OpBitAnd", []int{}},
+	OpBitOr:          {"OpBitOr", []int{}},
+	OpBitXor:         {"OpBitXor", []int{}},
+	OpShiftLeft:      {"OpShiftLeft", []int{}},
+	OpShiftRight:     {"OpShiftRight", []int{}},
+	OpIterator:       {"OpIterator", []int{}},
+	OpIteratorNext:   {"OpIteratorNext", []int{1}},
+	OpJumpNull:       {"OpJumpNull", []int{2}},
+	OpJumpNotNull:    {"OpJumpNotNull", []int{2}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpIndexKeep:      {"OpIndexKeep", []int{}},
+	OpIteratorClose:  {"OpIteratorClose", []int{}},
+	OpCaptureLocal:   {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:    {"OpCaptureFree", []int{1}},
 }
 
 func Lookup(op byte) (*Defination, error) {
@@ -128,34 +191,47 @@ func (ins Instructions) String() string {
 
 	i := 0
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
+		def, operands, width, err := ins.Decode(i)
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
-			continue
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+		} else {
+			fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 		}
-		operands, read := ReadOperands(def, ins[i+1:])
-
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
-		i += 1 + read
+		i += width
 	}
 	return out.String()
 }
 
+// Decode reads the instruction at offset and returns its width in bytes, the opcode included.
+// For an unknown opcode or missing operands the width is what is left to skip past it
+func (ins Instructions) Decode(offset int) (*Defination, []int, int, error) {
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return nil, nil, 1, err
+	}
+	width := 1
+	for _, operandWidth := range def.OperandWidths {
+		width += operandWidth
+	}
+	if offset+width > len(ins) {
+		return nil, nil, len(ins) - offset, fmt.Errorf("%s is missing operands", def.Name)
+	}
+	operands, _ := ReadOperands(def, ins[offset+1:])
+	return def, operands, width, nil
+}
+
 func (ins Instructions) fmtInstruction(def *Defination, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
 	if len(operands) != operandCount {
 		return fmt.Sprintf("ERROR: operand len%d does not match defined %d\n", len(operands), operandCount)
 	}
-	switch operandCount {
-	case 0:
-		return def.Name
-	case 1:
-		return fmt.Sprintf("%s %d", def.Name, operands[0])
-	case 2:
-		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	var out bytes.Buffer
+	out.WriteString(def.Name)
+	for _, operand := range operands {
+		fmt.Fprintf(&out, " %d", operand)
 	}
-	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+	return out.String()
 }
 
 func ReadOperands(def *Defination, ins Instructions) ([]int, int) {
@@ -182,3 +258,23 @@ func ReadUint8(ins Instructions) uint8 {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+// SourceMap maps instruction offsets to the source position they were compiled from,
+// entries are kept sorted by Offset
+type SourceMap []SourceMapEntry
+
+type SourceMapEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Lookup returns the source position of the instruction at offset
+func (sm SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(sm), func(i int) bool {
+		return sm[i].Offset > offset
+	})
+	if i == 0 {
+		return token.Position{}
+	}
+	return sm[i-1].Pos
+}
@@ -1,6 +1,9 @@
 package code
 
-import "testing"
+import (
+	"testing"
+	"z/token"
+)
 
 func TestMake(t *testing.T) {
 	tests := []struct {
@@ -88,3 +91,46 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestSourceMapLookup(t *testing.T) {
+	sourceMap := SourceMap{
+		{Offset: 0, Pos: token.Position{Line: 1, Column: 1}},
+		{Offset: 3, Pos: token.Position{Line: 2, Column: 5}},
+		{Offset: 7, Pos: token.Position{Line: 4, Column: 2}},
+	}
+	tests := []struct {
+		offset   int
+		expected int
+	}{
+		{0, 1},
+		{2, 1},
+		{3, 2},
+		{6, 2},
+		{7, 4},
+		{20, 4},
+	}
+	for _, tt := range tests {
+		pos := sourceMap.Lookup(tt.offset)
+		if pos.Line != tt.expected {
+			t.Errorf("wrong line for offset %d, want=%d, got=%d", tt.offset, tt.expected, pos.Line)
+		}
+	}
+	if (SourceMap{}).Lookup(0).IsValid() {
+		t.Errorf("empty source map should not resolve a position")
+	}
+}
+
+func TestInstructionStringUnknownOpcode(t *testing.T) {
+	concated := Instructions{}
+	concated = append(concated, 255)
+	concated = append(concated, Make(OpClass, 1, 2, 3)...)
+	concated = append(concated, byte(OpConstant), 1)
+
+	expected := `0000 ERROR: opcode 255 undefined
+0001 OpClass 1 2 3
+0007 ERROR: OpConstant is missing operands
+`
+	if concated.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\nnot=%q", expected, concated.String())
+	}
+}
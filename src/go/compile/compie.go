@@ -2,10 +2,13 @@ package compile
 
 import (
 	"fmt"
+	"path"
 	"sort"
+	"strings"
 	"z/ast"
 	"z/code"
 	"z/object"
+	"z/token"
 )
 
 type EmittedInstruction struct {
@@ -17,15 +20,43 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+	tryHandlers         []tryHandler
+	loops               []*loopScope
 }
 
-type Compile struct {
-	constants   []object.Object
-	scopes      []CompilationScope
-	scopeIndex  int
+// tryHandler is an open OpTry handler, finally is nil for a catch handler. A break, continue or return
+// compiles the finally block again with the names of where it was written, not of where it is left
+type tryHandler struct {
+	finally     *ast.BlockStatement
 	symbolTable *SymbolTable
 }
 
+// loopScope is a loop being compiled, its break and continue jumps are patched once the end of the loop is known
+type loopScope struct {
+	label     string  // empty when the loop has no label
+	tryDepth  int     // open try handlers outside the loop
+	iterator  *Symbol // the hidden iterator of a for in loop, closed when the loop is left
+	breaks    []int
+	continues []int
+}
+
+// names of compiler generated variables, they can not clash with identifiers in source code
+const (
+	hiddenErrorName    = "$error"
+	hiddenReturnName   = "$return"
+	hiddenIteratorName = "$iterator"
+)
+
+type Compile struct {
+	constants    []object.Object
+	scopes       []CompilationScope
+	scopeIndex   int
+	symbolTable  *SymbolTable
+	position     token.Position      // source position of the node being compiled
+	classMembers map[Symbol][]string // members of the classes compiled so far, visible in the methods of subclasses
+}
+
 func New() *Compile {
 	symbolTable := NewSymbolTable()
 	mainScope := CompilationScope{
@@ -37,10 +68,11 @@ func New() *Compile {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
 	return &Compile{
-		constants:   []object.Object{},
-		symbolTable: symbolTable,
-		scopes:      []CompilationScope{mainScope},
-		scopeIndex:  0,
+		constants:    []object.Object{},
+		symbolTable:  symbolTable,
+		scopes:       []CompilationScope{mainScope},
+		scopeIndex:   0,
+		classMembers: map[Symbol][]string{},
 	}
 }
 
@@ -52,8 +84,14 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compile {
 }
 
 func (c *Compile) Compile(node ast.Node) error {
+	if node != nil && node.Pos().IsValid() {
+		outerPosition := c.position
+		c.position = node.Pos()
+		defer func() { c.position = outerPosition }()
+	}
 	switch node := node.(type) {
 	case *ast.Program:
+		c.declareGlobals(node.Statements)
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -61,6 +99,9 @@ func (c *Compile) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.ExpressionStatement:
+		if node.Expression == nil { // an empty statement such as a lone ;
+			return nil
+		}
 		{
 			err := c.Compile(node.Expression)
 			if err != nil {
@@ -69,6 +110,25 @@ func (c *Compile) Compile(node ast.Node) error {
 			c.emit(code.OpPop)
 		}
 	case *ast.InfixExpression:
+		switch node.Operator {
+		case token.ASSIGN, token.PLUSASSIGN, token.MINUSASSIGN, token.ASTERISKASSIGN, token.SLASHASSIGN,
+			token.PLUSPLUS, token.MINUSMINUS:
+			return c.compileAssign(node)
+		case token.OBJET_GET, token.CLASS_GET, token.OPTIONAL_GET:
+			return c.compileChain(node)
+		case token.NULLISH:
+			err := c.Compile(node.Left)
+			if err != nil {
+				return err
+			}
+			jumpNotNull := c.emit(code.OpJumpNotNull, 9999)
+			err = c.Compile(node.Right)
+			if err != nil {
+				return err
+			}
+			c.changeOperand(jumpNotNull, len(c.currentInstructions()))
+			return nil
+		}
 		if node.Operator == "<" || node.Operator == "<=" {
 			err := c.Compile(node.Right)
 			if err != nil {
@@ -103,6 +163,20 @@ func (c *Compile) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
 		case ">":
 			c.emit(code.OpGreaterThan)
 		case ">=":
@@ -111,8 +185,12 @@ func (c *Compile) Compile(node ast.Node) error {
 			c.emit(code.OpEqual)
 		case "!=":
 			c.emit(code.OpNotEqual)
+		case "&&":
+			c.emit(code.OpAnd)
+		case "||":
+			c.emit(code.OpOr)
 		default:
-			return fmt.Errorf("unkown operator %s", node.Operator)
+			return c.errorf("unkown operator %s", node.Operator)
 		}
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
@@ -129,48 +207,23 @@ func (c *Compile) Compile(node ast.Node) error {
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
 	case *ast.Boolean:
 		if node.Value {
 			c.emit(code.OpTrue)
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
 	case *ast.IfExpression:
-		err := c.Compile(node.Condition)
-		if err != nil {
-			return err
-		}
-
-		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
-
-		err = c.Compile(node.Consequence)
-
-		if err != nil {
-			return err
-		}
-
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
-
-		jumpPos := c.emit(code.OpJump, 9999)
-		afterConsequancePos := len(c.currentInstructions())
-		c.changeOperand(jumpNotTruthyPos, afterConsequancePos)
-
-		if node.Alternative == nil {
-			c.emit(code.OpNull)
-		} else {
-			err := c.Compile(node.Alternative)
-			if err != nil {
-				return err
-			}
-			if c.lastInstructionIs(code.OpPop) {
-				c.removeLastPop()
-			}
-		}
-		afterAlternativePost := len(c.currentInstructions())
-		c.changeOperand(jumpPos, afterAlternativePost)
+		return c.inBlock(c.symbolTable, func() error { return c.compileIf(node) })
 	case *ast.BlockStatement:
+		if len(node.DeferStatements) > 0 {
+			return c.compileDeferBlock(node)
+		}
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
@@ -178,68 +231,64 @@ func (c *Compile) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
-		err := c.Compile(node.Value)
+		symbol := c.symbolTable.Declare(qualifiedName(node.Name.Value, node.PackageName))
+		var err error
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok {
+			// the parser names the function after the let, it is stored once here
+			err = c.compileFunction(fn, false)
+		} else {
+			err = c.Compile(node.Value)
+		}
 		if err != nil {
 			return err
 		}
-		if symbol.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, symbol.Index)
-		} else {
-			c.emit(code.OpSetLocal, symbol.Index)
-		}
+		c.storeSymbol(symbol)
 	case *ast.Identifier:
-		symbol, ok := c.symbolTable.Resolve(node.Value)
-		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
-		}
-		c.loadSymbol(symbol)
+		return c.compileIdentifier(node)
 	case *ast.FunctionLiteral:
-		c.enterScope()
-
-		if node.Name != "" {
-			c.symbolTable.DefineFunctionName(node.Name)
-		}
-
-		for _, p := range node.Parameters {
-			c.symbolTable.Define(p.Value)
-		}
-
-		err := c.Compile(node.Body)
-
-		if c.lastInstructionIs(code.OpPop) {
-			c.replaceLastPopWithReturn()
+		if node.Name == "" {
+			return c.compileFunction(node, false)
 		}
-
-		if !c.lastInstructionIs(code.OpReturnValue) {
-			c.emit(code.OpReturn)
-		}
-
+		// a named function binds itself to its name, like a let statement
+		symbol := c.symbolTable.Declare(qualifiedName(node.Name, node.PackageName))
+		err := c.compileFunction(node, false)
 		if err != nil {
 			return err
 		}
-		freeSymbols := c.symbolTable.FreeSymbols
-		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
-		for _, s := range freeSymbols {
-			c.loadSymbol(s)
-		}
-		compiledFn := &object.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
-		}
-		fnIndex := c.addConstant(compiledFn)
-		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
 	case *ast.ReturnStatement:
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
+		c.closeIterators(c.scopes[c.scopeIndex].loops)
+		if len(c.scopes[c.scopeIndex].tryHandlers) > 0 {
+			err = c.leaveTryHandlers()
+			if err != nil {
+				return err
+			}
+		}
 		c.emit(code.OpReturnValue)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		return c.compileTryExpression(node, c.compileScopedBlockValue)
 	case *ast.StringLiteral:
 		str := &object.String{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpTemplate, len(node.Parts))
 	case *ast.ArrayLiteral:
 		for _, el := range node.Elements {
 			err := c.Compile(el)
@@ -249,13 +298,17 @@ func (c *Compile) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
+		// keys are compiled in source order, which is the order hashes are encoded to json in
+		keys := node.Keys
+		if len(keys) != len(node.Pairs) {
+			keys = []ast.Expression{}
+			for k := range node.Pairs {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				return keys[i].String() < keys[j].String()
+			})
 		}
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
 
 		for _, k := range keys {
 			err := c.Compile(k)
@@ -269,17 +322,451 @@ func (c *Compile) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpHash, len(node.Pairs)*2)
 	case *ast.IndexExpression:
-		err := c.Compile(node.Left)
+		return c.compileChain(node)
+	case *ast.CallExpression:
+		return c.compileChain(node)
+	case *ast.WhileExpression:
+		return c.inBlock(c.symbolTable, func() error {
+			return c.compileLoop(node.Label, c.condition(node.Condition), nil, node.Body, nil, nil)
+		})
+	case *ast.ForExpression:
+		return c.inBlock(c.symbolTable, func() error {
+			err := c.Compile(node.Initor)
+			if err != nil {
+				return err
+			}
+			return c.compileLoop(node.Label, c.condition(node.Condition), nil, node.Body, node.After, nil)
+		})
+	case *ast.ForInExpression:
+		return c.compileForIn(node)
+	case *ast.BreakExpression:
+		loop, err := c.exitLoop("break", node.Label)
+		if err != nil {
+			return err
+		}
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueExpression:
+		loop, err := c.exitLoop("continue", node.Label)
+		if err != nil {
+			return err
+		}
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+	case *ast.ClassExpress:
+		return c.compileClass(node)
+	case *ast.ObjectExpress:
+		err := c.compileIdentifier(node.Class)
+		if err != nil {
+			return err
+		}
+		for _, a := range node.Parameters {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpNew, len(node.Parameters))
+	case *ast.InterfaceExpress:
+		// interfaces are not checked yet, the evaluator ignores them as well
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// qualifiedName is the name a declaration of package packageName is stored under
+func qualifiedName(name string, packageName string) string {
+	if packageName == "" {
+		return name
+	}
+	return packageName + "." + name
+}
+
+// declareGlobals defines the functions, classes and variables declared at the top level of a program
+// before it is compiled, so functions can use the ones declared after them
+func (c *Compile) declareGlobals(statements []ast.Statement) {
+	for _, s := range statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			c.symbolTable.Declare(qualifiedName(s.Name.Value, s.PackageName))
+		case *ast.ExpressionStatement:
+			switch e := s.Expression.(type) {
+			case *ast.FunctionLiteral:
+				if e.Name != "" {
+					c.symbolTable.Declare(qualifiedName(e.Name, e.PackageName))
+				}
+			case *ast.ClassExpress:
+				c.symbolTable.Declare(e.Name.Value)
+			}
+		}
+	}
+}
+
+func (c *Compile) compileIdentifier(node *ast.Identifier) error {
+	// the names a program declares shadow the builtins but for the fields and methods of classes,
+	// like in the evaluator
+	symbol, ok := c.symbolTable.ResolveInPackage(node.Value, node.PackageName)
+	if builtin, isBuiltin := c.resolveBuiltin(node.Value); isBuiltin && (!ok || symbol.Scope == FieldScope) {
+		symbol, ok = builtin, true
+	}
+	if ok {
+		c.loadSymbol(symbol)
+		return nil
+	}
+	switch node.Value {
+	case "__FILE__":
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.FileName}))
+		return nil
+	case "__DIR__":
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: path.Dir(node.FileName)}))
+		return nil
+	}
+	return c.errorf("undefined variable %s", node.Value)
+}
+
+func (c *Compile) resolveBuiltin(name string) (Symbol, bool) {
+	for i, v := range object.Builtins {
+		if v.Name == name {
+			return Symbol{Name: name, Scope: BuiltinScope, Index: i}, true
+		}
+	}
+	return Symbol{}, false
+}
+
+// compileFunction compiles a function literal to a closure, a method does not bind its own name
+// so that inside it the name still refers to the class member or builtin
+func (c *Compile) compileFunction(node *ast.FunctionLiteral, isMethod bool) error {
+	c.enterScope()
+
+	if node.Name != "" && !isMethod {
+		c.symbolTable.DefineFunctionName(qualifiedName(node.Name, node.PackageName))
+	}
+
+	numDefaults := 0
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+		if p.Default != nil {
+			numDefaults++
+		}
+	}
+
+	err := c.compileDefaults(node.Parameters)
+	if err == nil {
+		err = c.Compile(node.Body)
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.names
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+	if err != nil {
+		return err
+	}
+	var freeNames []string
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+		freeNames = append(freeNames, s.Name)
+	}
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		NumDefaults:   numDefaults,
+		SourceMap:     sourceMap,
+		Name:          node.Name,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+		Source:        object.FunctionSource(node.Parameters, node.Body),
+	}
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+// compileDefaults sets the parameters left out by the caller, which the vm passes as null, to their default value
+func (c *Compile) compileDefaults(parameters []*ast.Identifier) error {
+	for i, p := range parameters {
+		if p.Default == nil {
+			continue
+		}
+		c.emit(code.OpGetLocal, i)
+		c.emit(code.OpNull)
+		c.emit(code.OpEqual)
+		jumpPos := c.emit(code.OpJumpNotTruthy, 9999)
+		err := c.Compile(p.Default)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetLocal, i)
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileLoop lays out while, for and for in loops, the value of a loop is the value of its body in the last
+// iteration, or null when the body never ran or the loop was left with break. A continue leaves null as
+// the value of the iteration and jumps to next, bind stores the names of a for in loop and iterator is its
+// hidden iterator, closed at the end
+//
+//	OpNull
+//	start: <condition> OpJumpNotTruthy end
+//	<bind> OpPop <body>
+//	next: <after> OpPop OpJump start
+//	end: [OpGet $iterator OpIteratorClose]
+func (c *Compile) compileLoop(label *ast.Identifier, condition func() error, bind func(), body *ast.BlockStatement, after ast.Expression, iterator *Symbol) error {
+	c.emit(code.OpNull)
+	startPos := len(c.currentInstructions())
+	err := condition()
+	if err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+	if bind != nil {
+		bind()
+	}
+	c.emit(code.OpPop)
+
+	loop := &loopScope{tryDepth: len(c.scopes[c.scopeIndex].tryHandlers), iterator: iterator}
+	if label != nil {
+		loop.label = label.Value
+	}
+	c.scopes[c.scopeIndex].loops = append(c.scopes[c.scopeIndex].loops, loop)
+	err = c.compileBlockValue(body)
+	loops := c.scopes[c.scopeIndex].loops
+	c.scopes[c.scopeIndex].loops = loops[:len(loops)-1]
+	if err != nil {
+		return err
+	}
+	nextPos := len(c.currentInstructions())
+	for _, continuePos := range loop.continues {
+		c.changeOperand(continuePos, nextPos)
+	}
+	if after != nil {
+		err = c.Compile(after)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	}
+	c.emit(code.OpJump, startPos)
+
+	endPos := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, endPos)
+	for _, breakPos := range loop.breaks {
+		c.changeOperand(breakPos, endPos)
+	}
+	c.closeIterators([]*loopScope{loop})
+	return nil
+}
+
+// closeIterators closes the iterators of the for in loops a jump leaves, innermost first
+func (c *Compile) closeIterators(loops []*loopScope) {
+	for i := len(loops) - 1; i >= 0; i-- {
+		if loops[i].iterator != nil {
+			c.loadSymbol(*loops[i].iterator)
+			c.emit(code.OpIteratorClose)
+		}
+	}
+}
+
+func (c *Compile) condition(condition ast.Expression) func() error {
+	return func() error { return c.Compile(condition) }
+}
+
+// compileForIn keeps an iterator over the collection in a hidden variable, each iteration
+// OpIteratorNext pushes the values of the names and true, or only false when there are no more elements
+//
+//	<collection> OpIterator OpSet $iterator
+//	<loop with condition OpGet $iterator OpIteratorNext, binding the names in reverse order>
+//	OpGet $iterator OpIteratorClose
+func (c *Compile) compileForIn(node *ast.ForInExpression) error {
+	err := c.Compile(node.Collection)
+	if err != nil {
+		return err
+	}
+	// the collection is what can not be iterated over, or fails to give its next element
+	collection := node.Collection.Pos()
+	position := c.position
+	c.position = collection
+	c.emit(code.OpIterator)
+	c.position = position
+	return c.inBlock(c.symbolTable, func() error { return c.compileForInLoop(node, collection) })
+}
+
+// compileForInLoop is a for in loop once the iterator is on the stack, the names are the loop's own
+func (c *Compile) compileForInLoop(node *ast.ForInExpression, collection token.Position) error {
+	iterator := c.symbolTable.Define(hiddenIteratorName)
+	c.storeSymbol(iterator)
+	names := []Symbol{}
+	for _, name := range node.Names {
+		names = append(names, c.symbolTable.Declare(qualifiedName(name.Value, name.PackageName)))
+	}
+	next := func() error {
+		c.loadSymbol(iterator)
+		position := c.position
+		c.position = collection
+		c.emit(code.OpIteratorNext, len(names))
+		c.position = position
+		return nil
+	}
+	bind := func() {
+		for i := len(names) - 1; i >= 0; i-- {
+			c.storeSymbol(names[i])
+		}
+	}
+	return c.compileLoop(node.Label, next, bind, node.Body, nil, &iterator)
+}
+
+// exitLoop closes the try handlers inside the loop a break or a continue leaves and the iterators of the loops
+// inside it, and leaves null as the value of its body, the loop is the innermost one or the one with label
+func (c *Compile) exitLoop(keyword string, label *ast.Identifier) (*loopScope, error) {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil, c.errorf("%s outside of a loop", keyword)
+	}
+	index := len(loops) - 1
+	if label != nil {
+		for index >= 0 && loops[index].label != label.Value {
+			index--
+		}
+		if index < 0 {
+			return nil, c.errorf("undefined label %s", label.Value)
+		}
+	}
+	loop := loops[index]
+	err := c.closeTryHandlers(loop.tryDepth)
+	if err != nil {
+		return nil, err
+	}
+	c.closeIterators(loops[index+1:])
+	c.emit(code.OpNull)
+	return loop, nil
+}
+
+// compileAssign compiles the assignment operators, the value of an assignment is the assigned value
+func (c *Compile) compileAssign(node *ast.InfixExpression) error {
+	if target, ok := node.Left.(*ast.IndexExpression); ok {
+		return c.compileIndexAssign(node, target)
+	}
+	identifier, ok := node.Left.(*ast.Identifier)
+	if !ok {
+		return c.errorf("cannot assign to %s", node.Left.String())
+	}
+	symbol, ok := c.symbolTable.ResolveInPackage(identifier.Value, identifier.PackageName)
+	if !ok {
+		return c.errorf("undefined variable %s", identifier.Value)
+	}
+	if symbol.Scope == BuiltinScope || symbol.Scope == FunctionScope || symbol.Scope == ThisScope {
+		return c.errorf("cannot assign to %s", identifier.Value)
+	}
+	if node.Operator != token.ASSIGN {
+		c.loadSymbol(symbol)
+	}
+	err := c.compileAssignValue(node)
+	if err != nil {
+		return err
+	}
+	c.storeSymbol(symbol)
+	c.loadSymbol(symbol)
+	return nil
+}
+
+// compileIndexAssign compiles left[index] = value and left[index] += value and the like, the array or hash
+// is changed in place. The left side and the index are evaluated once, before the value
+//
+//	<left> <index> [OpIndexKeep] <value> [OpAdd] OpSetIndex
+func (c *Compile) compileIndexAssign(node *ast.InfixExpression, target *ast.IndexExpression) error {
+	if target.Optional || target.Slice {
+		return c.errorf("cannot assign to %s", target.String())
+	}
+	err := c.Compile(target.Left)
+	if err != nil {
+		return err
+	}
+	err = c.Compile(target.Index)
+	if err != nil {
+		return err
+	}
+	if node.Operator != token.ASSIGN {
+		c.emit(code.OpIndexKeep)
+	}
+	err = c.compileAssignValue(node)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+// compileAssignValue compiles the value an assignment stores, for x += y and the like the current value is on the stack already
+func (c *Compile) compileAssignValue(node *ast.InfixExpression) error {
+	err := c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	switch node.Operator {
+	case token.PLUSASSIGN, token.PLUSPLUS:
+		c.emit(code.OpAdd)
+	case token.MINUSASSIGN, token.MINUSMINUS:
+		c.emit(code.OpSub)
+	case token.ASTERISKASSIGN:
+		c.emit(code.OpMul)
+	case token.SLASHASSIGN:
+		c.emit(code.OpDiv)
+	}
+	return nil
+}
+
+// compileChain compiles a member access, an index or a call together with the ones its left side is made of.
+// A ?-> or a ?.[] that finds null jumps to the end of the whole chain with the null on the stack
+//
+//	<left> OpJumpNull end OpGetProperty member ... end:
+func (c *Compile) compileChain(node ast.Expression) error {
+	jumps := []int{}
+	err := c.compileChainLink(node, &jumps)
+	if err != nil {
+		return err
+	}
+	for _, jump := range jumps {
+		c.changeOperand(jump, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileChainLink compiles one link of a chain after the links on its left, jumps collects the jumps of the optional ones
+func (c *Compile) compileChainLink(node ast.Expression, jumps *[]int) error {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		if node.Operator != token.OBJET_GET && node.Operator != token.CLASS_GET && node.Operator != token.OPTIONAL_GET {
+			break
+		}
+		return c.compileMemberGet(node, jumps)
+	case *ast.IndexExpression:
+		err := c.compileChainLink(node.Left, jumps)
 		if err != nil {
 			return err
 		}
+		if node.Optional {
+			*jumps = append(*jumps, c.emit(code.OpJumpNull, 9999))
+		}
+		if node.Slice {
+			return c.compileSlice(node)
+		}
 		err = c.Compile(node.Index)
 		if err != nil {
 			return err
 		}
 		c.emit(code.OpIndex)
+		return nil
 	case *ast.CallExpression:
-		err := c.Compile(node.Function)
+		err := c.compileChainLink(node.Function, jumps)
 		if err != nil {
 			return err
 		}
@@ -290,22 +777,137 @@ func (c *Compile) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpCall, len(node.Arguments))
-	case *ast.WhileExpression:
-		err := c.Compile(node.Condition)
+		return nil
+	}
+	return c.Compile(node)
+}
+
+// compileSlice compiles the bounds of left[low:high] after its left side, a bound left out is null
+func (c *Compile) compileSlice(node *ast.IndexExpression) error {
+	for _, bound := range []ast.Expression{node.Index, node.High} {
+		if bound == nil {
+			c.emit(code.OpNull)
+			continue
+		}
+		err := c.Compile(bound)
 		if err != nil {
 			return err
 		}
-		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
-		err = c.Compile(node.Body)
+	}
+	c.emit(code.OpSlice)
+	return nil
+}
+
+// compileMemberGet compiles object->member, object?->member and Class::member
+func (c *Compile) compileMemberGet(node *ast.InfixExpression, jumps *[]int) error {
+	member, ok := node.Right.(*ast.Identifier)
+	if !ok {
+		return c.errorf("%s needs a member name, got %s", node.Operator, node.Right.String())
+	}
+	err := c.compileChainLink(node.Left, jumps)
+	if err != nil {
+		return err
+	}
+	name := c.addConstant(&object.String{Value: member.Value})
+	switch node.Operator {
+	case token.OPTIONAL_GET:
+		*jumps = append(*jumps, c.emit(code.OpJumpNull, 9999))
+		c.emit(code.OpGetProperty, name)
+	case token.OBJET_GET:
+		c.emit(code.OpGetProperty, name)
+	default:
+		c.emit(code.OpGetStatic, name)
+	}
+	return nil
+}
+
+// compileClass pushes the name and value of every member, then the parent classes, and builds the class with OpClass.
+// Methods are compiled in a class symbol table, so the members they use are looked up on the object they are bound to
+func (c *Compile) compileClass(node *ast.ClassExpress) error {
+	symbol := c.symbolTable.Declare(node.Name.Value)
+
+	members := []string{}
+	parentSymbols := []Symbol{}
+	for _, parent := range node.Parents {
+		parentSymbol, ok := c.symbolTable.ResolveInPackage(parent.Value, parent.PackageName)
+		if !ok {
+			return c.errorf("parent class not exists: %s", parent.Value)
+		}
+		parentSymbols = append(parentSymbols, parentSymbol)
+		for _, name := range c.classMembers[parentSymbol] {
+			if !isPrivateMember(name) {
+				members = append(members, name)
+			}
+		}
+	}
+	for _, let := range node.LetStatements {
+		members = append(members, let.Name.Value)
+	}
+	for _, function := range node.Functions {
+		members = append(members, function.Name)
+	}
+	classTable := NewClassSymbolTable(c.symbolTable)
+	for _, name := range members {
+		classTable.DefineField(name)
+	}
+
+	for _, let := range node.LetStatements {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: let.Name.Value}))
+		function, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			err := c.Compile(let.Value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := c.compileMethod(classTable, function)
 		if err != nil {
 			return err
 		}
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
+	}
+	for _, function := range node.Functions {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: function.Name}))
+		err := c.compileMethod(classTable, function)
+		if err != nil {
+			return err
 		}
-		afterConsequancePos := len(c.currentInstructions())
-		c.changeOperand(jumpNotTruthyPos, afterConsequancePos)
 	}
+	for _, parentSymbol := range parentSymbols {
+		c.loadSymbol(parentSymbol)
+	}
+	numMembers := len(node.LetStatements) + len(node.Functions)
+	c.emit(code.OpClass, c.addConstant(&object.String{Value: node.Name.Value}), numMembers*2, len(node.Parents))
+	c.classMembers[symbol] = members
+
+	c.storeSymbol(symbol)
+	c.loadSymbol(symbol)
+	return nil
+}
+
+func (c *Compile) compileMethod(classTable *SymbolTable, function *ast.FunctionLiteral) error {
+	outer := c.symbolTable
+	c.symbolTable = classTable
+	defer func() { c.symbolTable = outer }()
+	return c.compileFunction(function, true)
+}
+
+// isPrivateMember reports whether a member is hidden from subclasses, __ members such as __init are not
+func isPrivateMember(name string) bool {
+	return strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "__")
+}
+
+// compileDeferBlock runs the defer statements of block whenever the block is left, the same way as a finally block.
+// Unlike a try block the block has no names of its own, the defer statements see the ones it declares
+func (c *Compile) compileDeferBlock(block *ast.BlockStatement) error {
+	body := &ast.BlockStatement{Token: block.Token, Statements: block.Statements}
+	deferred := &ast.BlockStatement{Token: block.Token, Statements: block.DeferStatements}
+	try := &ast.TryExpression{Token: block.Token, Block: body, Finally: deferred}
+	err := c.compileTryExpression(try, c.compileBlockValue)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpPop)
 	return nil
 }
 
@@ -328,7 +930,222 @@ func (c *Compile) loadSymbol(s Symbol) {
 		c.emit(code.OpGetFree, s.Index)
 	case FunctionScope:
 		c.emit(code.OpCurrentClosure)
+	case FieldScope:
+		c.emit(code.OpGetField, c.addConstant(&object.String{Value: s.Name}))
+	case ThisScope:
+		c.emit(code.OpThis)
+	}
+}
+
+// captureSymbol loads a variable a closure captures, the closure shares a local or a free variable
+// with the function around it, so that an assignment on either side is seen by the other
+func (c *Compile) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	default:
+		c.loadSymbol(s)
+	}
+}
+
+func (c *Compile) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	case FieldScope:
+		c.emit(code.OpSetField, c.addConstant(&object.String{Value: s.Name}))
+	}
+}
+
+func (c *Compile) compileIf(node *ast.IfExpression) error {
+	err := c.Compile(node.Condition)
+	if err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	err = c.compileBlockValue(node.Consequence)
+
+	if err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	afterConsequancePos := len(c.currentInstructions())
+	c.changeOperand(jumpNotTruthyPos, afterConsequancePos)
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else {
+		err := c.compileBlockValue(node.Alternative)
+		if err != nil {
+			return err
+		}
+	}
+	afterAlternativePost := len(c.currentInstructions())
+	c.changeOperand(jumpPos, afterAlternativePost)
+	return nil
+}
+
+// compileBlockValue compiles block so that it leaves the value of its last expression on the stack
+func (c *Compile) compileBlockValue(block *ast.BlockStatement) error {
+	if len(block.Statements) == 0 && len(block.DeferStatements) == 0 {
+		c.emit(code.OpNull)
+		return nil
+	}
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileTryExpression lays out a try expression as
+//
+//	OpTry finallyHandler        (only with a finally block)
+//	OpTry catchHandler
+//	<try block>
+//	OpEndTry
+//	OpJump afterCatch
+//	catchHandler: <store error> <catch block>
+//	afterCatch: OpEndTry <finally block> OpJump end
+//	finallyHandler: <store error> <finally block> <load error> OpThrow
+//	end:
+//
+// compileBlock compiles the try block and leaves its value on the stack
+func (c *Compile) compileTryExpression(node *ast.TryExpression, compileBlock func(*ast.BlockStatement) error) error {
+	if node.Finally == nil {
+		return c.compileTryCatch(node, compileBlock)
+	}
+	tryPos := c.emit(code.OpTry, 9999)
+	c.pushTryHandler(node.Finally)
+	err := c.compileTryCatch(node, compileBlock)
+	c.popTryHandler()
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	err = c.compileScopedBlock(node.Finally)
+	if err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	errorSymbol := c.symbolTable.Define(hiddenErrorName)
+	c.storeSymbol(errorSymbol)
+	err = c.compileScopedBlock(node.Finally)
+	if err != nil {
+		return err
 	}
+	c.loadSymbol(errorSymbol)
+	c.emit(code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compile) compileTryCatch(node *ast.TryExpression, compileBlock func(*ast.BlockStatement) error) error {
+	if node.Catch == nil {
+		return compileBlock(node.Block)
+	}
+	tryPos := c.emit(code.OpTry, 9999)
+	c.pushTryHandler(nil)
+	err := compileBlock(node.Block)
+	c.popTryHandler()
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	err = c.inBlock(c.symbolTable, func() error {
+		if node.Parameter != nil {
+			c.storeSymbol(c.symbolTable.Define(node.Parameter.Value))
+		} else {
+			c.emit(code.OpPop)
+		}
+		return c.compileBlockValue(node.Catch)
+	})
+	if err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// inBlock compiles a block whose names are its own inside outer, the names it declares hide those of outer
+// until it ends, as in the environment the evaluator gives the block
+func (c *Compile) inBlock(outer *SymbolTable, compile func() error) error {
+	symbolTable := c.symbolTable
+	c.symbolTable = NewBlockSymbolTable(outer)
+	err := compile()
+	c.symbolTable = symbolTable
+	return err
+}
+
+func (c *Compile) compileScopedBlock(block *ast.BlockStatement) error {
+	return c.inBlock(c.symbolTable, func() error { return c.Compile(block) })
+}
+
+func (c *Compile) compileScopedBlockValue(block *ast.BlockStatement) error {
+	return c.inBlock(c.symbolTable, func() error { return c.compileBlockValue(block) })
+}
+
+// leaveTryHandlers closes every try handler open in the current function before a return,
+// running finally blocks from the innermost outwards, the return value stays on the stack
+func (c *Compile) leaveTryHandlers() error {
+	returnSymbol := c.symbolTable.Define(hiddenReturnName)
+	c.storeSymbol(returnSymbol)
+	err := c.closeTryHandlers(0)
+	if err != nil {
+		return err
+	}
+	c.loadSymbol(returnSymbol)
+	return nil
+}
+
+// closeTryHandlers closes the try handlers open in the current function above depth, innermost first,
+// running their finally blocks
+func (c *Compile) closeTryHandlers(depth int) error {
+	handlers := c.scopes[c.scopeIndex].tryHandlers
+	defer func() { c.scopes[c.scopeIndex].tryHandlers = handlers }()
+	for i := len(handlers) - 1; i >= depth; i-- {
+		c.emit(code.OpEndTry)
+		if handlers[i].finally == nil {
+			continue
+		}
+		c.scopes[c.scopeIndex].tryHandlers = handlers[:i]
+		finally := handlers[i].finally
+		err := c.inBlock(handlers[i].symbolTable, func() error { return c.Compile(finally) })
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compile) pushTryHandler(finally *ast.BlockStatement) {
+	handler := tryHandler{finally: finally, symbolTable: c.symbolTable}
+	c.scopes[c.scopeIndex].tryHandlers = append(c.scopes[c.scopeIndex].tryHandlers, handler)
+}
+
+func (c *Compile) popTryHandler() {
+	handlers := c.scopes[c.scopeIndex].tryHandlers
+	c.scopes[c.scopeIndex].tryHandlers = handlers[:len(handlers)-1]
 }
 
 func (c *Compile) replaceLastPopWithReturn() {
@@ -358,6 +1175,12 @@ func (c *Compile) removeLastPop() {
 	new := old[:last.Position]
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Offset >= last.Position {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sourceMap
 }
 
 func (c *Compile) setLastInstruction(op code.OpCode, pos int) {
@@ -371,9 +1194,29 @@ func (c *Compile) emit(op code.OpCode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 	c.setLastInstruction(op, pos)
+	c.addSourcePosition(pos)
 	return pos
 }
 
+// errorf creates a compile error prefixed with the source position of the node being compiled
+func (c *Compile) errorf(format string, a ...interface{}) error {
+	if c.position.IsValid() {
+		return fmt.Errorf("%s: "+format, append([]interface{}{c.position}, a...)...)
+	}
+	return fmt.Errorf(format, a...)
+}
+
+func (c *Compile) addSourcePosition(offset int) {
+	if !c.position.IsValid() {
+		return
+	}
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	if len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Pos == c.position {
+		return
+	}
+	c.scopes[c.scopeIndex].sourceMap = append(sourceMap, code.SourceMapEntry{Offset: offset, Pos: c.position})
+}
+
 func (c *Compile) addInstruction(ins []byte) int {
 	posNewInstruction := len(c.currentInstructions())
 	updatedInstructions := append(c.currentInstructions(), ins...)
@@ -390,6 +1233,8 @@ func (c *Compile) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		GlobalNames:  c.symbolTable.globals.names,
 	}
 }
 
@@ -400,6 +1245,8 @@ func (c *Compile) currentInstructions() code.Instructions {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap
+	GlobalNames  []string // names of the globals by index, for the debugger
 }
 
 func (c *Compile) enterScope() {
@@ -2,6 +2,7 @@ package compile
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"z/ast"
 	"z/code"
@@ -313,6 +314,18 @@ func TestIndexExpress(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			input:             "[1][:1]",
+			expectedConstants: []interface{}{1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompileTests(t, tests)
 }
@@ -788,7 +801,7 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -818,13 +831,13 @@ func TestClosures(t *testing.T) {
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 0, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 1, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -868,15 +881,15 @@ func TestClosures(t *testing.T) {
 				[]code.Instructions{
 					code.Make(code.OpConstant, 2),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetFree, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureFree, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 4, 2),
 					code.Make(code.OpReturnValue),
 				},
 				[]code.Instructions{
 					code.Make(code.OpConstant, 1),
 					code.Make(code.OpSetLocal, 0),
-					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
 					code.Make(code.OpClosure, 5, 1),
 					code.Make(code.OpReturnValue),
 				},
@@ -1075,3 +1088,257 @@ func parse(input string) *ast.Program {
 	p := parser.New(l)
 	return p.ParseProgram()
 }
+
+func TestSourceMap(t *testing.T) {
+	program := parse("1;\n  2 + 3;")
+	compiler := New()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	tests := []struct {
+		offset int
+		line   int
+		column int
+	}{
+		{0, 1, 1},  // OpConstant 0
+		{4, 2, 3},  // OpConstant 1
+		{10, 2, 5}, // OpAdd
+	}
+	for _, tt := range tests {
+		pos := bytecode.SourceMap.Lookup(tt.offset)
+		if pos.Line != tt.line || pos.Column != tt.column {
+			t.Errorf("wrong position for offset %d, want=%d:%d, got=%s", tt.offset, tt.line, tt.column, pos)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	tests := []compileTestCase{
+		{
+			input:             `try { 1 } catch (e) { 2 };`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 16),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpConstant, 1),
+				// 0016
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `throw 1;`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpThrow),
+			},
+		},
+	}
+
+	runCompileTests(t, tests)
+}
+
+func TestWhileExpression(t *testing.T) {
+	tests := []compileTestCase{
+		{
+			input:             `let a = 1; while (a < 3) { a = a + 1 }`,
+			expectedConstants: []interface{}{1, 3, 1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpNull),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				// 0013
+				code.Make(code.OpGreaterThan),
+				// 0014
+				code.Make(code.OpJumpNotTruthy, 34),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpGetGlobal, 0),
+				// 0021
+				code.Make(code.OpConstant, 2),
+				// 0024
+				code.Make(code.OpAdd),
+				// 0025
+				code.Make(code.OpSetGlobal, 0),
+				// 0028
+				code.Make(code.OpGetGlobal, 0),
+				// 0031
+				code.Make(code.OpJump, 7),
+				// 0034
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `while (true) { break }`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpNull),
+				// 0001
+				code.Make(code.OpTrue),
+				// 0002
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0005
+				code.Make(code.OpPop),
+				// 0006
+				code.Make(code.OpNull),
+				// 0007
+				code.Make(code.OpJump, 13),
+				// 0010
+				code.Make(code.OpJump, 1),
+				// 0013
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompileTests(t, tests)
+}
+
+func TestAssignExpression(t *testing.T) {
+	tests := []compileTestCase{
+		{
+			input:             `let a = 1; a += 2`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let h = {}; h["a"] = 1`,
+			expectedConstants: []interface{}{"a", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpHash, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `let a = [1]; a[0] *= 2`,
+			expectedConstants: []interface{}{1, 0, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpIndexKeep),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompileTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compileTestCase{
+		{
+			input:             `true && false`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpFalse),
+				code.Make(code.OpAnd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `true || false`,
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpFalse),
+				code.Make(code.OpOr),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompileTests(t, tests)
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`break`, "1:1: break outside of a loop"},
+		{`for (x in [1]) { x }; continue`, "1:23: continue outside of a loop"},
+	}
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+		if err == nil {
+			t.Fatalf("%s: expected compile error", tt.input)
+		}
+		if err.Error() != tt.expected {
+			t.Fatalf("%s: wrong error. got=%q", tt.input, err)
+		}
+	}
+}
+
+func TestVariableNames(t *testing.T) {
+	input := `
+	let base = 1
+	let adder = fn(n) {
+		fn(x) {
+			let sum = base + n + x
+			sum
+		}
+	}
+	`
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	if !reflect.DeepEqual(bytecode.GlobalNames, []string{"base", "adder"}) {
+		t.Errorf("wrong global names. got=%v", bytecode.GlobalNames)
+	}
+	inner := bytecode.Constants[1].(*object.CompiledFunction)
+	if !reflect.DeepEqual(inner.LocalNames, []string{"x", "sum"}) {
+		t.Errorf("wrong local names. got=%v", inner.LocalNames)
+	}
+	if !reflect.DeepEqual(inner.FreeNames, []string{"n"}) {
+		t.Errorf("wrong free names. got=%v", inner.FreeNames)
+	}
+	outer := bytecode.Constants[2].(*object.CompiledFunction)
+	if !reflect.DeepEqual(outer.LocalNames, []string{"n"}) {
+		t.Errorf("wrong local names. got=%v", outer.LocalNames)
+	}
+}
@@ -0,0 +1,154 @@
+package compile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"z/code"
+	"z/object"
+	"z/token"
+)
+
+// jumpOperations have an instruction offset as first operand
+var jumpOperations = map[code.OpCode]bool{
+	code.OpJump:          true,
+	code.OpJumpNotTruthy: true,
+	code.OpJumpNull:      true,
+	code.OpJumpNotNull:   true,
+	code.OpTry:           true,
+}
+
+// constantOperations have a constant index as first operand
+var constantOperations = map[code.OpCode]bool{
+	code.OpConstant:    true,
+	code.OpClosure:     true,
+	code.OpGetProperty: true,
+	code.OpGetStatic:   true,
+	code.OpGetField:    true,
+	code.OpSetField:    true,
+	code.OpClass:       true,
+}
+
+// Disassemble prints bytecode for reading: the constant pool, the main program and then every
+// compiled function of the pool, jump targets are shown as labels
+func Disassemble(bytecode *Bytecode) string {
+	var out bytes.Buffer
+	out.WriteString("constants:\n")
+	for i, constant := range bytecode.Constants {
+		fmt.Fprintf(&out, "  %4d  %s\n", i, describeConstant(constant))
+	}
+
+	out.WriteString("\nmain:\n")
+	disassembleInstructions(&out, bytecode.Instructions, bytecode.SourceMap, bytecode.Constants)
+
+	for i, constant := range bytecode.Constants {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&out, "\nconstant %d, %s:\n", i, describeConstant(fn))
+		disassembleInstructions(&out, fn.Instructions, fn.SourceMap, bytecode.Constants)
+	}
+	return out.String()
+}
+
+func describeConstant(constant object.Object) string {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		return fmt.Sprintf("integer %d", constant.Value)
+	case *object.Float:
+		return fmt.Sprintf("float %s", constant.Inspect())
+	case *object.String:
+		return fmt.Sprintf("string %q", constant.Value)
+	case *object.CompiledFunction:
+		name := constant.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		return fmt.Sprintf("fn %s params=%d defaults=%d locals=%d",
+			name, constant.NumParameters, constant.NumDefaults, constant.NumLocals)
+	default:
+		return fmt.Sprintf("%s %s", constant.Type(), constant.Inspect())
+	}
+}
+
+func disassembleInstructions(out *bytes.Buffer, ins code.Instructions, sourceMap code.SourceMap, constants []object.Object) {
+	labels := jumpLabels(ins)
+	var lastPos token.Position
+	for i := 0; i < len(ins); {
+		def, operands, width, err := ins.Decode(i)
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(out, "%s:\n", label)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "  %04d  ERROR: %s\n", i, err)
+			i += width
+			continue
+		}
+		op := code.OpCode(ins[i])
+
+		text := def.Name
+		for j, operand := range operands {
+			if j == 0 && jumpOperations[op] {
+				text += " " + labels[operand]
+			} else {
+				text += fmt.Sprintf(" %d", operand)
+			}
+		}
+		comment := operandComment(op, operands, constants)
+		if pos := sourceMap.Lookup(i); pos.IsValid() && pos != lastPos {
+			if comment != "" {
+				comment += " "
+			}
+			comment += "@ " + pos.String()
+			lastPos = pos
+		}
+		if comment != "" {
+			fmt.Fprintf(out, "  %04d  %-24s ; %s\n", i, text, comment)
+		} else {
+			fmt.Fprintf(out, "  %04d  %s\n", i, text)
+		}
+		i += width
+	}
+	// a jump to the end of the instructions
+	if label, ok := labels[len(ins)]; ok {
+		fmt.Fprintf(out, "%s:\n", label)
+	}
+}
+
+// jumpLabels names the jump targets of ins L1, L2... in the order they appear
+func jumpLabels(ins code.Instructions) map[int]string {
+	targets := []int{}
+	for i := 0; i < len(ins); {
+		_, operands, width, err := ins.Decode(i)
+		if err == nil && jumpOperations[code.OpCode(ins[i])] {
+			targets = append(targets, operands[0])
+		}
+		i += width
+	}
+	sort.Ints(targets)
+	labels := map[int]string{}
+	for _, target := range targets {
+		if _, ok := labels[target]; !ok {
+			labels[target] = fmt.Sprintf("L%d", len(labels)+1)
+		}
+	}
+	return labels
+}
+
+// operandComment explains the operand of an instruction referring to a constant or a builtin
+func operandComment(op code.OpCode, operands []int, constants []object.Object) string {
+	switch {
+	case constantOperations[op]:
+		if operands[0] < len(constants) {
+			return describeConstant(constants[operands[0]])
+		}
+		return "constant out of range"
+	case op == code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return "builtin " + object.Builtins[operands[0]].Name
+		}
+		return "builtin out of range"
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package compile
+
+import (
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `fn f(a) {
+  if (a) { 1 } else { 2 }
+}
+f(true)`
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	expected := `constants:
+     0  integer 1
+     1  integer 2
+     2  fn f params=1 defaults=0 locals=1
+
+main:
+  0000  OpClosure 2 0            ; fn f params=1 defaults=0 locals=1 @ 1:1
+  0004  OpSetGlobal 0
+  0007  OpGetGlobal 0
+  0010  OpPop
+  0011  OpGetGlobal 0            ; @ 4:1
+  0014  OpTrue                   ; @ 4:3
+  0015  OpCall 1                 ; @ 4:2
+  0017  OpPop                    ; @ 4:1
+
+constant 2, fn f params=1 defaults=0 locals=1:
+  0000  OpGetLocal 0             ; @ 2:7
+  0002  OpJumpNotTruthy L1       ; @ 2:3
+  0005  OpConstant 0             ; integer 1 @ 2:12
+  0008  OpJump L2                ; @ 2:3
+L1:
+  0011  OpConstant 1             ; integer 2 @ 2:23
+L2:
+  0014  OpReturnValue            ; @ 2:3
+`
+	if got := Disassemble(compiler.Bytecode()); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestDisassembleUnknownOpcode(t *testing.T) {
+	bytecode := &Bytecode{Instructions: []byte{255, 255}}
+	expected := `constants:
+
+main:
+  0000  ERROR: opcode 255 undefined
+  0001  ERROR: opcode 255 undefined
+`
+	if got := Disassemble(bytecode); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%q\ngot=%q", expected, got)
+	}
+}
+
+func TestDisassembleNullJumps(t *testing.T) {
+	input := `let a = null
+a ?? 1
+a?.[0]`
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	expected := `constants:
+     0  integer 1
+     1  integer 0
+
+main:
+  0000  OpNull                   ; @ 1:9
+  0001  OpSetGlobal 0            ; @ 1:1
+  0004  OpGetGlobal 0            ; @ 2:1
+  0007  OpJumpNotNull L1         ; @ 2:3
+  0010  OpConstant 0             ; integer 1 @ 2:6
+L1:
+  0013  OpPop                    ; @ 2:1
+  0014  OpGetGlobal 0            ; @ 3:1
+  0017  OpJumpNull L2            ; @ 3:2
+  0020  OpConstant 1             ; integer 0 @ 3:5
+  0023  OpIndex                  ; @ 3:2
+L2:
+  0024  OpPop                    ; @ 3:1
+`
+	if got := Disassemble(compiler.Bytecode()); got != expected {
+		t.Errorf("wrong disassembly.\nwant=%s\ngot=%s", expected, got)
+	}
+}
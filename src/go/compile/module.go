@@ -0,0 +1,30 @@
+package compile
+
+import "z/module"
+
+// CompileModule compiles a program from its main module, every module once and after the modules it imports.
+// Each module has a global symbol table of its own, holding the names the modules it imports export
+func (c *Compile) CompileModule(main *module.Module) error {
+	mainTable := c.symbolTable
+	defer func() { c.symbolTable = mainTable }()
+	tables := map[*module.Module]*SymbolTable{}
+	for _, m := range main.Order() {
+		table := mainTable
+		if m != main {
+			table = NewModuleSymbolTable(mainTable)
+		}
+		for _, imported := range m.Imports {
+			for _, name := range imported.Exports() {
+				if symbol, ok := tables[imported].ResolveInPackage(name, imported.PackageName); ok {
+					table.DefineImport(imported.Qualified(name), symbol)
+				}
+			}
+		}
+		tables[m] = table
+		c.symbolTable = table
+		if err := c.Compile(m.Program); err != nil {
+			return err
+		}
+	}
+	return nil
+}
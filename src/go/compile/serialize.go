@@ -0,0 +1,312 @@
+package compile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"z/code"
+	"z/config"
+	"z/object"
+	"z/token"
+)
+
+// bytecodeMagic starts every .zc file
+const bytecodeMagic = "ZC"
+
+// bytecodeFormat is the version of the .zc layout and of the instructions in it, bump it whenever either changes:
+// an opcode is added, removed or renumbered or its operands change, or a section or a constant is written differently
+const bytecodeFormat = 4
+
+// tags of the constants in a .zc file
+const (
+	integerConstant  byte = 'i'
+	floatConstant    byte = 'f'
+	stringConstant   byte = 's'
+	functionConstant byte = 'c'
+)
+
+var ErrNotBytecode = errors.New("not a z bytecode file")
+
+// VersionError is returned when a .zc file was written by another version of z
+type VersionError struct {
+	Version float64
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("bytecode was compiled by z %.1f, this is z %.1f, compile it again", e.Version, config.GetZVersion())
+}
+
+// FormatError is returned when a .zc file was written in another bytecode format, or when the builtins it calls
+// by index are not at those indexes in this z
+type FormatError struct {
+	Format  uint64
+	Builtin string // the first builtin of the file that this z does not have at its index, empty when the format differs
+}
+
+func (e *FormatError) Error() string {
+	if e.Builtin != "" {
+		return fmt.Sprintf("bytecode was compiled with other builtins, %s is not where this z has it, compile it again", e.Builtin)
+	}
+	return fmt.Sprintf("bytecode is in format %d, this z reads format %d, compile it again", e.Format, bytecodeFormat)
+}
+
+// WriteBytecode writes bytecode in the .zc format: the magic, the z version, the bytecode format, the names of the
+// builtins by index, the instructions with their source map, the global names, then the constants
+func WriteBytecode(w io.Writer, bytecode *Bytecode) error {
+	bw := &bytecodeWriter{w: bufio.NewWriter(w)}
+	bw.bytes([]byte(bytecodeMagic))
+	bw.uint64(math.Float64bits(config.GetZVersion()))
+	bw.uvarint(bytecodeFormat)
+	bw.strings(builtinNames())
+	bw.instructions(bytecode.Instructions, bytecode.SourceMap)
+	bw.strings(bytecode.GlobalNames)
+	bw.uvarint(uint64(len(bytecode.Constants)))
+	for _, constant := range bytecode.Constants {
+		bw.constant(constant)
+	}
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+// ReadBytecode reads bytecode written by WriteBytecode
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	br := &bytecodeReader{r: bufio.NewReader(r)}
+	magic := br.bytes(len(bytecodeMagic))
+	if br.err != nil || string(magic) != bytecodeMagic {
+		return nil, ErrNotBytecode
+	}
+	version := math.Float64frombits(br.uint64())
+	if br.err == nil && version != config.GetZVersion() {
+		return nil, &VersionError{Version: version}
+	}
+	format := br.uvarint()
+	if br.err == nil && format != bytecodeFormat {
+		return nil, &FormatError{Format: format}
+	}
+	// builtins added after the file was written are at the end, the ones it calls are where they were
+	builtins := builtinNames()
+	for i, name := range br.strings() {
+		if i >= len(builtins) || builtins[i] != name {
+			return nil, &FormatError{Format: format, Builtin: name}
+		}
+	}
+	bytecode := &Bytecode{}
+	bytecode.Instructions, bytecode.SourceMap = br.instructions()
+	bytecode.GlobalNames = br.strings()
+	constants := br.uvarint()
+	for i := uint64(0); i < constants && br.err == nil; i++ {
+		bytecode.Constants = append(bytecode.Constants, br.constant())
+	}
+	if br.err != nil {
+		return nil, fmt.Errorf("read bytecode: %w", br.err)
+	}
+	return bytecode, nil
+}
+
+// builtinNames are the names of the builtins by the index OpGetBuiltin has for them
+func builtinNames() []string {
+	names := make([]string, len(object.Builtins))
+	for i, builtin := range object.Builtins {
+		names[i] = builtin.Name
+	}
+	return names
+}
+
+// bytecodeWriter keeps the first error, so a sequence of writes is checked once
+type bytecodeWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (bw *bytecodeWriter) bytes(b []byte) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(b)
+	}
+}
+
+func (bw *bytecodeWriter) uint64(value uint64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], value)
+	bw.bytes(buf[:])
+}
+
+func (bw *bytecodeWriter) uvarint(value uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	bw.bytes(buf[:binary.PutUvarint(buf[:], value)])
+}
+
+func (bw *bytecodeWriter) varint(value int64) {
+	var buf [binary.MaxVarintLen64]byte
+	bw.bytes(buf[:binary.PutVarint(buf[:], value)])
+}
+
+func (bw *bytecodeWriter) string(value string) {
+	bw.uvarint(uint64(len(value)))
+	bw.bytes([]byte(value))
+}
+
+func (bw *bytecodeWriter) strings(values []string) {
+	bw.uvarint(uint64(len(values)))
+	for _, value := range values {
+		bw.string(value)
+	}
+}
+
+func (bw *bytecodeWriter) instructions(ins code.Instructions, sourceMap code.SourceMap) {
+	bw.uvarint(uint64(len(ins)))
+	bw.bytes(ins)
+	bw.uvarint(uint64(len(sourceMap)))
+	for _, entry := range sourceMap {
+		bw.uvarint(uint64(entry.Offset))
+		bw.string(entry.Pos.FileName)
+		bw.uvarint(uint64(entry.Pos.Line))
+		bw.uvarint(uint64(entry.Pos.Column))
+	}
+}
+
+func (bw *bytecodeWriter) constant(constant object.Object) {
+	switch constant := constant.(type) {
+	case *object.Integer:
+		bw.bytes([]byte{integerConstant})
+		bw.varint(constant.Value)
+	case *object.Float:
+		bw.bytes([]byte{floatConstant})
+		bw.uint64(math.Float64bits(constant.Value))
+	case *object.String:
+		bw.bytes([]byte{stringConstant})
+		bw.string(constant.Value)
+	case *object.CompiledFunction:
+		bw.bytes([]byte{functionConstant})
+		bw.string(constant.Name)
+		bw.uvarint(uint64(constant.NumLocals))
+		bw.uvarint(uint64(constant.NumParameters))
+		bw.uvarint(uint64(constant.NumDefaults))
+		bw.instructions(constant.Instructions, constant.SourceMap)
+		bw.strings(constant.LocalNames)
+		bw.strings(constant.FreeNames)
+		bw.string(constant.Source)
+	default:
+		if bw.err == nil {
+			bw.err = fmt.Errorf("constant of type %s can not be written", constant.Type())
+		}
+	}
+}
+
+// bytecodeReader keeps the first error like bytecodeWriter, reads after an error return zero values
+type bytecodeReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+// bytes reads n bytes, the buffer grows with the data read so a corrupt length can not make it allocate too much
+func (br *bytecodeReader) bytes(n int) []byte {
+	if br.err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	_, br.err = io.CopyN(&buf, br.r, int64(n))
+	if br.err == io.EOF {
+		br.err = io.ErrUnexpectedEOF
+	}
+	return buf.Bytes()
+}
+
+func (br *bytecodeReader) byte() byte {
+	b := br.bytes(1)
+	if br.err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (br *bytecodeReader) uint64() uint64 {
+	b := br.bytes(8)
+	if br.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (br *bytecodeReader) uvarint() uint64 {
+	if br.err != nil {
+		return 0
+	}
+	var value uint64
+	value, br.err = binary.ReadUvarint(br.r)
+	return value
+}
+
+func (br *bytecodeReader) varint() int64 {
+	if br.err != nil {
+		return 0
+	}
+	var value int64
+	value, br.err = binary.ReadVarint(br.r)
+	return value
+}
+
+func (br *bytecodeReader) string() string {
+	return string(br.bytes(br.length()))
+}
+
+func (br *bytecodeReader) length() int {
+	length := br.uvarint()
+	if br.err == nil && length > math.MaxInt32 {
+		br.err = fmt.Errorf("length %d out of range", length)
+	}
+	return int(length)
+}
+
+// strings reads a list written by bytecodeWriter.strings, an empty list is read as nil
+func (br *bytecodeReader) strings() []string {
+	var values []string
+	count := br.length()
+	for i := 0; i < count && br.err == nil; i++ {
+		values = append(values, br.string())
+	}
+	return values
+}
+
+func (br *bytecodeReader) instructions() (code.Instructions, code.SourceMap) {
+	ins := code.Instructions(br.bytes(br.length()))
+	entries := br.length()
+	sourceMap := code.SourceMap{}
+	for i := 0; i < entries && br.err == nil; i++ {
+		entry := code.SourceMapEntry{Offset: int(br.uvarint())}
+		entry.Pos = token.Position{FileName: br.string(), Line: int(br.uvarint()), Column: int(br.uvarint())}
+		sourceMap = append(sourceMap, entry)
+	}
+	return ins, sourceMap
+}
+
+func (br *bytecodeReader) constant() object.Object {
+	switch tag := br.byte(); tag {
+	case integerConstant:
+		return &object.Integer{Value: br.varint()}
+	case floatConstant:
+		return &object.Float{Value: math.Float64frombits(br.uint64())}
+	case stringConstant:
+		return &object.String{Value: br.string()}
+	case functionConstant:
+		fn := &object.CompiledFunction{Name: br.string()}
+		fn.NumLocals = int(br.uvarint())
+		fn.NumParameters = int(br.uvarint())
+		fn.NumDefaults = int(br.uvarint())
+		fn.Instructions, fn.SourceMap = br.instructions()
+		fn.LocalNames = br.strings()
+		fn.FreeNames = br.strings()
+		fn.Source = br.string()
+		return fn
+	default:
+		if br.err == nil {
+			br.err = fmt.Errorf("unknown constant tag %q", tag)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package compile
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"z/object"
+)
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `
+	let rate = 1.5
+	let name = "seven"
+	fn greet(who, greeting = "hello") {
+		let message = greeting + " " + who
+		message
+	}
+	greet(name)
+	-42
+	`
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	var buf bytes.Buffer
+	err = WriteBytecode(&buf, bytecode)
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	read, err := ReadBytecode(&buf)
+	if err != nil {
+		t.Fatalf("read error: %s", err)
+	}
+
+	if !reflect.DeepEqual(read, bytecode) {
+		t.Errorf("bytecode changed after a round trip.\nwant=%#v\ngot=%#v", bytecode, read)
+	}
+}
+
+func TestReadBytecodeErrors(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteBytecode(&buf, &Bytecode{})
+	if err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	oldVersion := append([]byte{}, valid...)
+	copy(oldVersion[len(bytecodeMagic):], []byte{0x3f, 0xb9, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}) // 0.1
+	_, err = ReadBytecode(bytes.NewReader(oldVersion))
+	var versionError *VersionError
+	if !errors.As(err, &versionError) {
+		t.Fatalf("expected a VersionError, got=%v", err)
+	}
+	if math.Abs(versionError.Version-0.1) > 1e-9 {
+		t.Errorf("wrong version. got=%f", versionError.Version)
+	}
+
+	_, err = ReadBytecode(bytes.NewReader([]byte("let a = 1")))
+	if err != ErrNotBytecode {
+		t.Errorf("expected ErrNotBytecode, got=%v", err)
+	}
+
+	_, err = ReadBytecode(bytes.NewReader(valid[:len(valid)-1]))
+	if err == nil {
+		t.Errorf("expected an error for a truncated file")
+	}
+
+	otherFormat := append([]byte{}, valid...)
+	otherFormat[len(bytecodeMagic)+8] = bytecodeFormat + 1
+	_, err = ReadBytecode(bytes.NewReader(otherFormat))
+	var formatError *FormatError
+	if !errors.As(err, &formatError) || formatError.Format != bytecodeFormat+1 || formatError.Builtin != "" {
+		t.Errorf("expected a FormatError for format %d, got=%v", bytecodeFormat+1, err)
+	}
+}
+
+// TestReadBytecodeBuiltins checks that a file calling builtins that moved is rejected,
+// and that one written before builtins were added at the end is not
+func TestReadBytecodeBuiltins(t *testing.T) {
+	builtins := object.Builtins
+	defer func() { object.Builtins = builtins }()
+	write := func(written []object.BuiltinFn) []byte {
+		object.Builtins = written
+		defer func() { object.Builtins = builtins }()
+		var buf bytes.Buffer
+		if err := WriteBytecode(&buf, &Bytecode{}); err != nil {
+			t.Fatalf("write error: %s", err)
+		}
+		return buf.Bytes()
+	}
+
+	swapped := append([]object.BuiltinFn{builtins[1], builtins[0]}, builtins[2:]...)
+	_, err := ReadBytecode(bytes.NewReader(write(swapped)))
+	var formatError *FormatError
+	if !errors.As(err, &formatError) || formatError.Builtin != builtins[1].Name {
+		t.Errorf("expected a FormatError for %s, got=%v", builtins[1].Name, err)
+	}
+
+	_, err = ReadBytecode(bytes.NewReader(write(builtins[:len(builtins)-1])))
+	if err != nil {
+		t.Errorf("bytecode written before a builtin was added is rejected: %s", err)
+	}
+}
@@ -8,6 +8,8 @@ const (
 	BuiltinScope  SymbolScope = "BUILTIN"
 	FreeScope     SymbolScope = "FREE"
 	FunctionScope SymbolScope = "FUNCTION"
+	FieldScope    SymbolScope = "FIELD" // member of the class a method belongs to, looked up on the bound object
+	ThisScope     SymbolScope = "THIS"
 )
 
 type Symbol struct {
@@ -21,34 +23,96 @@ type SymbolTable struct {
 	store          map[string]Symbol
 	numDefinitions int
 	FreeSymbols    []Symbol
+	names          []string     // names of the definitions by index, for the debugger
+	isClass        bool         // class bodies only hold fields, other names resolve through them to the outer table
+	isBlock        bool         // a block has names of its own, numbered in the function or the globals it is part of
+	globals        *globalNames // the globals of the program, a global table numbers its definitions with them
+}
+
+// globalNames are the names of the globals of all the modules of a program by index, the vm keeps them in one array
+type globalNames struct {
+	names []string
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
 	free := []Symbol{}
-	return &SymbolTable{store: s, FreeSymbols: free}
+	return &SymbolTable{store: s, FreeSymbols: free, globals: &globalNames{}}
+}
+
+// NewModuleSymbolTable creates the global table of another module of the program whose global table is s,
+// the module has names of its own but its globals are numbered after those of the other modules
+func NewModuleSymbolTable(s *SymbolTable) *SymbolTable {
+	module := NewSymbolTable()
+	module.globals = s.globals
+	for name, symbol := range s.store {
+		if symbol.Scope == BuiltinScope {
+			module.store[name] = symbol
+		}
+	}
+	return module
 }
 
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions, Scope: GlobalScope}
-	if s.Outer == nil {
-		symbol.Scope = GlobalScope
-	} else {
-		symbol.Scope = LocalScope
+	owner := s.owner()
+	if owner.Outer == nil {
+		symbol := Symbol{Name: name, Index: len(s.globals.names), Scope: GlobalScope}
+		s.store[name] = symbol
+		s.globals.names = append(s.globals.names, name)
+		owner.numDefinitions++
+		return symbol
+	}
+	symbol := Symbol{Name: name, Index: owner.numDefinitions, Scope: LocalScope}
+	s.store[name] = symbol
+	owner.names = append(owner.names, name)
+	owner.numDefinitions++
+	return symbol
+}
+
+// owner is the table of the function, or the global table, whose frame holds the names defined in s
+func (s *SymbolTable) owner() *SymbolTable {
+	for s.isBlock {
+		s = s.Outer
 	}
+	return s
+}
+
+// DefineImport gives a global of another module a name in this one
+func (s *SymbolTable) DefineImport(name string, symbol Symbol) Symbol {
 	s.store[name] = symbol
-	s.numDefinitions++
 	return symbol
 }
 
+// Declare returns the global or local symbol name already has in this table, defining it when there is none
+func (s *SymbolTable) Declare(name string) Symbol {
+	symbol, ok := s.store[name]
+	if ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	return s.Define(name)
+}
+
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.ResolveInPackage(name, "")
+}
+
+// ResolveInPackage resolves name used by code of package packageName, in each table
+// the plain name is tried before the package qualified one, like object.Environment.Get
+func (s *SymbolTable) ResolveInPackage(name string, packageName string) (Symbol, bool) {
 	obj, ok := s.store[name]
+	// a name of the package hides a builtin, like file.append hides append in the file package
+	if (!ok || obj.Scope == BuiltinScope) && packageName != "" {
+		if qualified, found := s.store[packageName+"."+name]; found {
+			obj, ok = qualified, true
+		}
+	}
 	if !ok && s.Outer != nil {
-		obj, ok = s.Outer.Resolve(name)
+		obj, ok = s.Outer.ResolveInPackage(name, packageName)
 		if !ok {
 			return obj, ok
 		}
-		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		if s.isClass || s.isBlock || obj.Scope == GlobalScope || obj.Scope == BuiltinScope ||
+			obj.Scope == FieldScope || obj.Scope == ThisScope {
 			return obj, ok
 		}
 		free := s.defineFree(obj)
@@ -62,6 +126,29 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	s.Outer = outer
 	return s
 }
+
+// NewBlockSymbolTable creates the table for a block, the names it declares hide the ones outside it until the block ends,
+// like the environment the evaluator gives a block. They share the frame of the function the block is in
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.globals = outer.globals
+	s.isBlock = true
+	return s
+}
+
+// NewClassSymbolTable creates the table for a class body, methods compiled in it see the class members
+func NewClassSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.isClass = true
+	s.store["this"] = Symbol{Name: "this", Scope: ThisScope}
+	return s
+}
+
+func (s *SymbolTable) DefineField(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FieldScope}
+	s.store[name] = symbol
+	return symbol
+}
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
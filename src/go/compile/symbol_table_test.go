@@ -335,3 +335,71 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected %s resovle to %+v,got=%+v", expected.Name, expected, result)
 	}
 }
+
+func TestDeclare(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Declare("a")
+	if again := global.Declare("a"); again != a {
+		t.Errorf("expected a to be declared once, got=%+v and %+v", a, again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("b")
+	expected := Symbol{Name: "b", Scope: LocalScope, Index: 0}
+	if result := local.Declare("b"); result != expected {
+		t.Errorf("expected b to shadow the function name as %+v, got=%+v", expected, result)
+	}
+}
+
+func TestResolveInPackage(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("string.prefix")
+	global.Define("a")
+	global.Define("string.a")
+
+	expected := map[string]Symbol{
+		"prefix": {Name: "string.prefix", Scope: GlobalScope, Index: 0},
+		"a":      {Name: "a", Scope: GlobalScope, Index: 1},
+	}
+	for name, symbol := range expected {
+		result, ok := global.ResolveInPackage(name, "string")
+		if !ok {
+			t.Fatalf("name %s not resolvable", name)
+		}
+		if result != symbol {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", name, symbol, result)
+		}
+	}
+	if _, ok := global.ResolveInPackage("prefix", ""); ok {
+		t.Errorf("prefix resolved outside of its package")
+	}
+}
+
+func TestResolveClassMembers(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	class := NewClassSymbolTable(global)
+	class.DefineField("name")
+	method := NewEnclosedSymbolTable(class)
+	method.Define("b")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "name", Scope: FieldScope},
+		{Name: "this", Scope: ThisScope},
+		{Name: "b", Scope: LocalScope, Index: 0},
+	}
+	for _, symbol := range expected {
+		result, ok := method.Resolve(symbol.Name)
+		if !ok {
+			t.Fatalf("name %s not resolvable", symbol.Name)
+		}
+		if result != symbol {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", symbol.Name, symbol, result)
+		}
+	}
+	if len(method.FreeSymbols) != 0 {
+		t.Errorf("class members should not be free symbols, got=%+v", method.FreeSymbols)
+	}
+}
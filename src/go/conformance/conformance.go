@@ -0,0 +1,274 @@
+// Package conformance runs a corpus of z programs under every engine and reports
+// where their behavior differs from the expectations written in the programs
+package conformance
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"z/build"
+	"z/cli"
+	"z/compile"
+	"z/evaluator"
+	"z/lexer"
+	"z/object"
+	"z/parser"
+	"z/vm"
+)
+
+type Engine string
+
+const (
+	Evaluator Engine = "eval"
+	VM        Engine = "vm"
+	C         Engine = "c" // the gcc backend of z build, it only supports a small part of the language
+)
+
+// ErrUnavailable is returned by Run when the engine can not run on this machine
+var ErrUnavailable = errors.New("engine unavailable")
+
+const (
+	stdoutAnnotation  = "// stdout:"
+	resultAnnotation  = "// result:"
+	errorAnnotation   = "// error:"
+	enginesAnnotation = "// engines:"
+)
+
+// Case is a program of the corpus, its expectations are written as comments:
+//
+//	// stdout: one line of the expected output, repeated for every line
+//	// result: the inspected value of the last expression, not checked when missing
+//	// error: the uncaught error as position: message
+//	// engines: the engines to run, eval and vm when missing
+type Case struct {
+	Name      string
+	Source    string
+	Stdout    string
+	Result    string
+	HasResult bool
+	Error     string
+	Engines   []Engine
+}
+
+// Outcome is what a program did when run by one engine
+type Outcome struct {
+	Stdout string
+	Result string
+	Error  string
+}
+
+// Divergence is an observed behavior that does not match the case
+type Divergence struct {
+	Engine Engine
+	Field  string
+	Want   string
+	Got    string
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s: %s want=%q, got=%q", d.Engine, d.Field, d.Want, d.Got)
+}
+
+// Load reads the .z programs of dir, sorted by name
+func Load(dir string) ([]*Case, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.z"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	cases := []*Case{}
+	for _, file := range files {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, Parse(strings.TrimSuffix(filepath.Base(file), ".z"), string(source)))
+	}
+	return cases, nil
+}
+
+// Parse reads the expectations of a program from its annotations
+func Parse(name string, source string) *Case {
+	c := &Case{Name: name, Source: source}
+	stdout := []string{}
+	for _, line := range strings.Split(source, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, stdoutAnnotation):
+			stdout = append(stdout, annotationValue(line, stdoutAnnotation))
+		case strings.HasPrefix(line, resultAnnotation):
+			c.Result = annotationValue(line, resultAnnotation)
+			c.HasResult = true
+		case strings.HasPrefix(line, errorAnnotation):
+			c.Error = annotationValue(line, errorAnnotation)
+		case strings.HasPrefix(line, enginesAnnotation):
+			for _, engine := range strings.Fields(annotationValue(line, enginesAnnotation)) {
+				c.Engines = append(c.Engines, Engine(engine))
+			}
+		}
+	}
+	c.Stdout = strings.Join(stdout, "\n")
+	if len(c.Engines) == 0 {
+		c.Engines = []Engine{Evaluator, VM}
+	}
+	return c
+}
+
+func annotationValue(line string, annotation string) string {
+	value := strings.TrimPrefix(line, annotation)
+	return strings.TrimPrefix(value, " ")
+}
+
+// Check runs the case under each of its engines, engines that are unavailable are skipped
+func Check(c *Case) ([]Divergence, error) {
+	divergences := []Divergence{}
+	for _, engine := range c.Engines {
+		outcome, err := Run(engine, c.Source)
+		if errors.Is(err, ErrUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", engine, err)
+		}
+		got := strings.TrimSuffix(outcome.Stdout, "\n")
+		if got != c.Stdout {
+			divergences = append(divergences, Divergence{engine, "stdout", c.Stdout, got})
+		}
+		if engine == C { // the C backend has no result value and no runtime errors
+			continue
+		}
+		if c.HasResult && outcome.Result != c.Result {
+			divergences = append(divergences, Divergence{engine, "result", c.Result, outcome.Result})
+		}
+		if outcome.Error != c.Error {
+			divergences = append(divergences, Divergence{engine, "error", c.Error, outcome.Error})
+		}
+	}
+	return divergences, nil
+}
+
+// Run runs source with engine, the output of puts is captured so Run must not be called concurrently
+func Run(engine Engine, source string) (Outcome, error) {
+	if engine == C {
+		return runC(source)
+	}
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return Outcome{}, fmt.Errorf("parse error: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	var stdout bytes.Buffer
+	defer func(previous io.Writer) { object.Stdout = previous }(object.Stdout)
+	object.Stdout = &stdout
+
+	var outcome Outcome
+	switch engine {
+	case Evaluator:
+		outcome = evalOutcome(evaluator.Eval(program, object.NewEnvironment()))
+	case VM:
+		comp := compile.New()
+		if err := comp.Compile(program); err != nil {
+			outcome.Error = "compile error: " + err.Error()
+			break
+		}
+		outcome = vmOutcome(vm.New(comp.Bytecode()))
+	default:
+		return Outcome{}, fmt.Errorf("unknown engine %q", engine)
+	}
+	outcome.Stdout = stdout.String()
+	return outcome, nil
+}
+
+// RunFile runs the program of a file with the files it imports and the prelude, like z run does.
+// The c engine does not run files
+func RunFile(engine Engine, path string) (Outcome, error) {
+	main, err := cli.LoadFile(path)
+	if err != nil {
+		return Outcome{}, err
+	}
+
+	var stdout bytes.Buffer
+	defer func(previous io.Writer) { object.Stdout = previous }(object.Stdout)
+	object.Stdout = &stdout
+
+	var outcome Outcome
+	switch engine {
+	case Evaluator:
+		outcome = evalOutcome(evaluator.EvalModule(main))
+	case VM:
+		comp := compile.New()
+		if err := comp.CompileModule(main); err != nil {
+			outcome.Error = "compile error: " + err.Error()
+			break
+		}
+		outcome = vmOutcome(vm.New(comp.Bytecode()))
+	default:
+		return Outcome{}, fmt.Errorf("engine %q does not run files", engine)
+	}
+	outcome.Stdout = stdout.String()
+	return outcome, nil
+}
+
+func evalOutcome(result object.Object) Outcome {
+	if errorObject, ok := result.(*object.Error); ok && !errorObject.Caught {
+		return Outcome{Error: errorMessage(errorObject)}
+	}
+	return Outcome{Result: inspect(result)}
+}
+
+func vmOutcome(machine *vm.VM) Outcome {
+	if err := machine.Run(); err != nil {
+		return Outcome{Error: err.Error()}
+	}
+	return Outcome{Result: inspect(machine.LastPoppedStackElem())}
+}
+
+func errorMessage(err *object.Error) string {
+	if err.Position.IsValid() {
+		return err.Position.String() + ": " + err.Message
+	}
+	return err.Message
+}
+
+func inspect(result object.Object) string {
+	if result == nil {
+		return ""
+	}
+	return result.Inspect()
+}
+
+// runC builds source with gcc in a temporary directory and runs the binary
+func runC(source string) (Outcome, error) {
+	gcc, err := exec.LookPath("gcc")
+	if err != nil {
+		return Outcome{}, ErrUnavailable
+	}
+	dir, err := os.MkdirTemp("", "z-conformance")
+	if err != nil {
+		return Outcome{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	cFile := filepath.Join(dir, "main.c")
+	binary := filepath.Join(dir, "main")
+	err = os.WriteFile(cFile, []byte(cli.ConvertZToC(source, true)), 0644)
+	if err != nil {
+		return Outcome{}, err
+	}
+	output, err := exec.Command(gcc, append([]string{cFile, "-o", binary}, build.CFlags...)...).CombinedOutput()
+	if err != nil {
+		return Outcome{}, fmt.Errorf("gcc: %s", output)
+	}
+	stdout, err := exec.Command(binary).Output()
+	if err != nil {
+		return Outcome{}, err
+	}
+	return Outcome{Stdout: string(stdout)}, nil
+}
@@ -0,0 +1,121 @@
+package conformance
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"z/cli"
+	"z/format"
+)
+
+func TestConformance(t *testing.T) {
+	cases, err := Load("testdata")
+	if err != nil {
+		t.Fatalf("load corpus: %s", err)
+	}
+	if len(cases) == 0 {
+		t.Fatalf("corpus is empty")
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			divergences, err := Check(c)
+			if err != nil {
+				t.Fatalf("run failed: %s", err)
+			}
+			for _, divergence := range divergences {
+				t.Errorf("%s", divergence)
+			}
+		})
+	}
+}
+
+// TestFormatted checks that z fmt changes the layout of the programs, not what they do
+func TestFormatted(t *testing.T) {
+	cases, err := Load("testdata")
+	if err != nil {
+		t.Fatalf("load corpus: %s", err)
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			formatted, err := format.Source(c.Source, c.Name)
+			if err != nil {
+				t.Fatalf("format failed: %s", err)
+			}
+			again, err := format.Source(formatted, c.Name)
+			if err != nil || again != formatted {
+				t.Fatalf("formatting is not stable. got=%q, err=%v", again, err)
+			}
+			divergences, err := Check(Parse(c.Name, formatted))
+			if err != nil {
+				t.Fatalf("run failed: %s", err)
+			}
+			for _, divergence := range divergences {
+				t.Errorf("%s", divergence)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	c := Parse("example", `
+puts("a", "\n")
+1
+// stdout: a
+// stdout:
+// result: 1
+// engines: vm
+`)
+	if c.Stdout != "a\n" {
+		t.Errorf("wrong stdout. got=%q", c.Stdout)
+	}
+	if !c.HasResult || c.Result != "1" {
+		t.Errorf("wrong result. got=%q", c.Result)
+	}
+	if c.Error != "" {
+		t.Errorf("wrong error. got=%q", c.Error)
+	}
+	if len(c.Engines) != 1 || c.Engines[0] != VM {
+		t.Errorf("wrong engines. got=%v", c.Engines)
+	}
+}
+
+// TestExamples runs the examples of the repository with both engines, they must print the same and fail the same,
+// z run does not show the value a program ends with.
+// The examples that need a database, the network or a server, or print the process id, are only loaded and compiled
+var machineDependent = map[string]bool{
+	"http_server.z": true, "mysql_execute.z": true, "mysql_standard.z": true, "fetch.z": true, "syscall.z": true,
+}
+
+func TestExamples(t *testing.T) {
+	files, err := filepath.Glob("../../../examples/*.z")
+	if err != nil {
+		t.Fatalf("list examples: %s", err)
+	}
+	more, _ := filepath.Glob("../../../examples/*/*.z")
+	files = append(files, more...)
+	if len(files) == 0 {
+		t.Fatalf("no examples")
+	}
+	for _, file := range files {
+		t.Run(strings.TrimPrefix(file, "../../../examples/"), func(t *testing.T) {
+			if machineDependent[filepath.Base(file)] {
+				if _, err := cli.CompileFile(file); err != nil {
+					t.Fatalf("%s", err)
+				}
+				return
+			}
+			eval, err := RunFile(Evaluator, file)
+			if err != nil {
+				t.Fatalf("eval: %s", err)
+			}
+			machine, err := RunFile(VM, file)
+			if err != nil {
+				t.Fatalf("vm: %s", err)
+			}
+			eval.Result, machine.Result = "", ""
+			if eval != machine {
+				t.Errorf("engines differ\neval: %+v\nvm:   %+v", eval, machine)
+			}
+		})
+	}
+}
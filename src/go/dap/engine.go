@@ -0,0 +1,152 @@
+package dap
+
+import (
+	"fmt"
+	"z/cli"
+	"z/debug"
+	"z/evaluator"
+	"z/module"
+	"z/object"
+	"z/vm"
+)
+
+// engine runs the launched program under a debugger, z debugs with the vm or with the evaluator.
+// The engine calls Server.pause where the program pauses, the other methods are called while it is paused
+// but for stepper, whose breakpoints and interrupt are safe to use while the program runs
+type engine interface {
+	// run runs the program to its end and returns what to report of the error that ended it,
+	// nothing when it ended well or was stopped
+	run() string
+	stepper() *debug.Stepper
+	callStack() object.Stack
+	scopes(frame int) []frameScope
+	lookup(frame int, name string) (object.Object, bool)
+}
+
+// frameScope is a scope of a frame with its variables
+type frameScope struct {
+	name      string
+	variables []namedValue
+}
+
+type namedValue struct {
+	name  string
+	value object.Object
+}
+
+// newEngine loads the program for mode, "vm" or "eval", the vm when it is empty
+func newEngine(s *Server, program string, mode string) (engine, error) {
+	switch mode {
+	case "", "vm":
+		bytecode, err := cli.CompileFile(program)
+		if err != nil {
+			return nil, err
+		}
+		e := &vmEngine{machine: vm.New(bytecode)}
+		e.debugger = vm.NewDebugger(func(machine *vm.VM, reason debug.PauseReason) debug.StepMode {
+			return s.pause(machine.Position(), reason)
+		})
+		e.machine.SetDebugger(e.debugger)
+		return e, nil
+	case "eval":
+		main, err := cli.LoadFile(program)
+		if err != nil {
+			return nil, err
+		}
+		e := &evalEngine{main: main}
+		e.debugger = evaluator.NewDebugger(func(d *evaluator.Debugger, reason debug.PauseReason) debug.StepMode {
+			return s.pause(d.Position(), reason)
+		})
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q, it is vm or eval", mode)
+	}
+}
+
+// vmEngine debugs the compiled program, its frames have locals, free variables and the globals
+type vmEngine struct {
+	machine  *vm.VM
+	debugger *vm.Debugger
+}
+
+func (e *vmEngine) run() string {
+	err := e.machine.Run()
+	if err == nil || err == vm.ErrStopped {
+		return ""
+	}
+	output := fmt.Sprintf("ERROR: %s\n", err)
+	if runtimeError, ok := err.(*vm.RuntimeError); ok {
+		output += runtimeError.Stack.String()
+	}
+	return output
+}
+
+func (e *vmEngine) stepper() *debug.Stepper {
+	return e.debugger.Stepper
+}
+
+func (e *vmEngine) callStack() object.Stack {
+	return e.machine.CallStack()
+}
+
+func (e *vmEngine) scopes(frame int) []frameScope {
+	scopes := []frameScope{}
+	if locals := e.machine.Locals(frame); len(locals) > 0 {
+		scopes = append(scopes, frameScope{localsScope, vmValues(locals)})
+	}
+	if free := e.machine.FreeVariables(frame); len(free) > 0 {
+		scopes = append(scopes, frameScope{closureScope, vmValues(free)})
+	}
+	return append(scopes, frameScope{globalsScope, vmValues(e.machine.Globals())})
+}
+
+func vmValues(variables []vm.Variable) []namedValue {
+	values := []namedValue{}
+	for _, v := range variables {
+		values = append(values, namedValue{v.Name, v.Value})
+	}
+	return values
+}
+
+func (e *vmEngine) lookup(frame int, name string) (object.Object, bool) {
+	return e.machine.LookupVariable(frame, name)
+}
+
+// evalEngine debugs the program with the evaluator, the scopes of its frames are their environment chains
+type evalEngine struct {
+	main     *module.Module
+	debugger *evaluator.Debugger
+}
+
+func (e *evalEngine) run() string {
+	result := e.debugger.EvalModule(e.main)
+	err, ok := result.(*object.Error)
+	if !ok || err.Caught || e.debugger.Stopped() {
+		return ""
+	}
+	return err.Inspect() + "\n" + err.Stack.String()
+}
+
+func (e *evalEngine) stepper() *debug.Stepper {
+	return e.debugger.Stepper
+}
+
+func (e *evalEngine) callStack() object.Stack {
+	return e.debugger.CallStack()
+}
+
+func (e *evalEngine) scopes(frame int) []frameScope {
+	scopes := []frameScope{}
+	for _, scope := range e.debugger.Scopes(frame) {
+		values := []namedValue{}
+		for _, v := range scope.Variables {
+			values = append(values, namedValue{v.Name, v.Value})
+		}
+		scopes = append(scopes, frameScope{scope.Name, values})
+	}
+	return scopes
+}
+
+func (e *evalEngine) lookup(frame int, name string) (object.Object, bool) {
+	return e.debugger.LookupVariable(frame, name)
+}
@@ -0,0 +1,463 @@
+// Package dap serves the Debug Adapter Protocol, so editors can debug z programs run by the vm or by the evaluator
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"z/debug"
+	"z/object"
+	"z/token"
+)
+
+// threadID is the only thread of a z program
+const threadID = 1
+
+var errNotPaused = errors.New("the program is not paused")
+
+// Server debugs one program for a client, Serve handles its requests until it disconnects
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	writeMu sync.Mutex // a message is written at once, the program sends events while requests are handled
+	seq     int
+
+	program        string // the absolute name of the launched file
+	stopOnEntry    bool
+	engine         engine
+	breakpoints    map[string][]int // the lines by file
+	launched       bool
+	configured     bool
+	resume         chan debug.StepMode
+	resuming       bool // the program goes on with mode after the response to the step request
+	mode           debug.StepMode
+	done           chan struct{}
+	previousStdout io.Writer
+
+	mu       sync.Mutex // guards the fields below, the goroutine running the program uses them too
+	started  bool       // the program reached the launched file, the prelude is run without pausing
+	paused   bool
+	stopping bool
+	handles  []handle // the values of the variablesReference numbers of the current pause, the number is the index+1
+}
+
+// handle is a variables container shown by the client: a scope of a frame, or a value with members
+type handle struct {
+	frame int
+	scope string
+	value object.Object
+}
+
+const (
+	localsScope  = "Locals"
+	closureScope = "Closure"
+	globalsScope = "Globals"
+)
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		breakpoints: map[string][]int{},
+		resume:      make(chan debug.StepMode),
+		done:        make(chan struct{}),
+	}
+}
+
+// Serve handles requests until the client disconnects or closes the input
+func (s *Server) Serve() error {
+	defer s.stop()
+	for {
+		request, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if request.Type != "request" {
+			continue
+		}
+		body, err := s.handle(request)
+		s.respond(request, body, err)
+		if s.resuming {
+			s.resuming = false
+			s.resume <- s.mode
+		}
+		if request.Command == "initialize" && err == nil {
+			s.sendEvent("initialized", nil)
+		}
+		if request.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(request *message) (interface{}, error) {
+	switch request.Command {
+	case "initialize":
+		return capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "configurationDone":
+		s.configured = true
+		s.start()
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return s.stackTrace()
+	case "scopes":
+		var args frameArguments
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args.FrameID - 1)
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args.VariablesReference)
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.step(debug.Continue)
+	case "next":
+		return nil, s.step(debug.StepOver)
+	case "stepIn":
+		return nil, s.step(debug.StepInto)
+	case "stepOut":
+		return nil, s.step(debug.StepOut)
+	case "pause":
+		if s.engine != nil {
+			s.engine.stepper().Interrupt()
+		}
+		return nil, nil
+	case "terminate", "disconnect":
+		s.stop()
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported request %q", request.Command)
+	}
+}
+
+// launch loads the program for the engine of the mode argument, it starts running once the client is done with the configuration
+func (s *Server) launch(args launchArguments) error {
+	if s.launched {
+		return errors.New("a program was launched already")
+	}
+	if args.Cwd != "" {
+		if err := os.Chdir(args.Cwd); err != nil {
+			return err
+		}
+	}
+	program, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	e, err := newEngine(s, program, args.Mode)
+	if err != nil {
+		return err
+	}
+	s.program = program
+	s.stopOnEntry = args.StopOnEntry
+	s.engine = e
+	s.engine.stepper().SetBreakpoints(s.engineBreakpoints())
+	s.launched = true
+	s.start()
+	return nil
+}
+
+// start runs the program when it was launched and configured, the output of puts is sent as output events
+func (s *Server) start() {
+	if !s.launched || !s.configured {
+		return
+	}
+	s.previousStdout = object.Stdout
+	object.Stdout = &outputWriter{s, "stdout"}
+	go func() {
+		defer close(s.done)
+		exitCode := 0
+		if output := s.engine.run(); output != "" {
+			exitCode = 1
+			s.sendEvent("output", outputEvent{Category: "stderr", Output: output})
+		}
+		s.sendEvent("exited", exitedEvent{ExitCode: exitCode})
+		s.sendEvent("terminated", nil)
+	}()
+}
+
+// stop ends a running program and waits for it
+func (s *Server) stop() {
+	if !s.launched || !s.configured {
+		return
+	}
+	s.mu.Lock()
+	s.stopping = true
+	paused := s.paused
+	s.paused = false
+	s.mu.Unlock()
+	if paused {
+		s.resume <- debug.Stop
+	} else {
+		s.engine.stepper().Interrupt()
+	}
+	<-s.done
+	if s.previousStdout != nil {
+		object.Stdout = s.previousStdout
+		s.previousStdout = nil
+	}
+}
+
+// stopReasons are the reasons of the stopped events
+var stopReasons = map[debug.PauseReason]string{debug.PausedStep: "step", debug.PausedBreakpoint: "breakpoint", debug.PausedInterrupt: "pause"}
+
+// pause is called by the program's goroutine where it is paused at pos for reason.
+// It waits for the client to resume the program
+func (s *Server) pause(pos token.Position, reason debug.PauseReason) debug.StepMode {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return debug.Stop
+	}
+	stopped := stoppedEvent{Reason: stopReasons[reason], ThreadID: threadID, AllThreadsStopped: true}
+	if !s.started && reason == debug.PausedStep {
+		if pos.FileName != s.program {
+			s.mu.Unlock()
+			return debug.StepInto
+		}
+		s.started = true
+		if !s.stopOnEntry {
+			s.mu.Unlock()
+			return debug.Continue
+		}
+		stopped.Reason = "entry"
+	}
+	s.started = true
+	s.paused = true
+	s.handles = nil
+	s.mu.Unlock()
+
+	s.sendEvent("stopped", stopped)
+	return <-s.resume
+}
+
+// step lets the paused program go on with mode once the request is answered
+func (s *Server) step(mode debug.StepMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.paused {
+		return errNotPaused
+	}
+	s.paused = false
+	s.resuming = true
+	s.mode = mode
+	return nil
+}
+
+// engineBreakpoints are the breakpoints of all files for the stepper of the engine
+func (s *Server) engineBreakpoints() []debug.Breakpoint {
+	breakpoints := []debug.Breakpoint{}
+	for path, lines := range s.breakpoints {
+		for _, line := range lines {
+			breakpoints = append(breakpoints, debug.Breakpoint{FileName: path, Line: line})
+		}
+	}
+	return breakpoints
+}
+
+func (s *Server) isPaused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+func (s *Server) setBreakpoints(args setBreakpointsArguments) interface{} {
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		path = args.Source.Path
+	}
+	lines := []int{}
+	verified := []breakpoint{}
+	for _, b := range args.Breakpoints {
+		lines = append(lines, b.Line)
+		verified = append(verified, breakpoint{Verified: true, Line: b.Line})
+	}
+	s.breakpoints[path] = lines
+	if s.engine != nil {
+		s.engine.stepper().SetBreakpoints(s.engineBreakpoints())
+	}
+	return map[string]interface{}{"breakpoints": verified}
+}
+
+// stackTrace lists the frames innermost first, the id of a frame is its index+1
+func (s *Server) stackTrace() (interface{}, error) {
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+	frames := []stackFrame{}
+	for i, frame := range s.engine.callStack() {
+		frames = append(frames, stackFrame{
+			ID:     i + 1,
+			Name:   frame.Function,
+			Source: &source{Name: filepath.Base(frame.Position.FileName), Path: frame.Position.FileName},
+			Line:   frame.Position.Line,
+			Column: frame.Position.Column,
+		})
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *Server) scopes(frame int) (interface{}, error) {
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+	if frame < 0 || frame >= len(s.engine.callStack()) {
+		return nil, fmt.Errorf("no frame %d", frame+1)
+	}
+	scopes := []scope{}
+	for _, frameScope := range s.engine.scopes(frame) {
+		scopes = append(scopes, scope{Name: frameScope.name, VariablesReference: s.newHandle(handle{frame: frame, scope: frameScope.name})})
+	}
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *Server) variables(reference int) (interface{}, error) {
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+	s.mu.Lock()
+	if reference < 1 || reference > len(s.handles) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("no variables %d", reference)
+	}
+	h := s.handles[reference-1]
+	s.mu.Unlock()
+
+	members := valueMembers(h.value)
+	if h.scope != "" {
+		for _, frameScope := range s.engine.scopes(h.frame) {
+			if frameScope.name == h.scope {
+				members = frameScope.variables
+			}
+		}
+	}
+	variables := []variable{}
+	for _, member := range members {
+		variables = append(variables, s.variable(member.name, member.value))
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// evaluate shows the value of a variable name, for hovers and watches
+func (s *Server) evaluate(args evaluateArguments) (interface{}, error) {
+	if !s.isPaused() {
+		return nil, errNotPaused
+	}
+	value, ok := s.engine.lookup(args.FrameID-1, args.Expression)
+	if !ok {
+		return nil, fmt.Errorf("%s is not defined here", args.Expression)
+	}
+	v := s.variable(args.Expression, value)
+	return evaluateResult{Result: v.Value, Type: v.Type, VariablesReference: v.VariablesReference}, nil
+}
+
+// variable describes a value, values with members get a reference to expand them
+func (s *Server) variable(name string, value object.Object) variable {
+	v := variable{Name: name, Value: value.Inspect(), Type: string(value.Type())}
+	if len(valueMembers(value)) > 0 {
+		v.VariablesReference = s.newHandle(handle{value: value})
+	}
+	return v
+}
+
+func (s *Server) newHandle(h handle) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handles = append(s.handles, h)
+	return len(s.handles)
+}
+
+// valueMembers are the elements of an array, the pairs of a hash in their order, or the fields of an object
+func valueMembers(value object.Object) []namedValue {
+	members := []namedValue{}
+	switch value := value.(type) {
+	case *object.Array:
+		for i, element := range value.Elements {
+			members = append(members, namedValue{fmt.Sprint(i), element})
+		}
+	case *object.Hash:
+		for _, pair := range value.Pairs() {
+			members = append(members, namedValue{pair.Key.Inspect(), pair.Value})
+		}
+	case *object.ObjectInstance:
+		fields := value.Environment.GetAll()
+		names := []string{}
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			members = append(members, namedValue{name, fields[name]})
+		}
+	}
+	return members
+}
+
+func (s *Server) respond(request *message, body interface{}, err error) {
+	success := err == nil
+	response := &message{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: &success, Body: body}
+	if err != nil {
+		response.Message = err.Error()
+	}
+	s.send(response)
+}
+
+func (s *Server) sendEvent(event string, body interface{}) {
+	s.send(&message{Type: "event", Event: event, Body: body})
+}
+
+func (s *Server) send(msg *message) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	msg.Seq = s.seq
+	writeMessage(s.out, msg)
+}
+
+// outputWriter sends what the program prints as output events
+type outputWriter struct {
+	s        *Server
+	category string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.sendEvent("output", outputEvent{Category: w.category, Output: string(p)})
+	return len(p), nil
+}
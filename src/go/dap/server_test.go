@@ -0,0 +1,315 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testProgram = `let scores = {"ann": 3, "bob": 5}
+let total = fn(points) {
+	let sum = 0
+	let names = ["ann", "bob"]
+	let i = 0
+	while (i < len(names)) {
+		sum = sum + points[names[i]]
+		i = i + 1
+	}
+	return sum
+}
+puts(total(scores))
+`
+
+// client talks to a Server through pipes like an editor would
+type client struct {
+	t       *testing.T
+	in      io.Writer
+	out     *bufio.Reader
+	seq     int
+	pending []*message // events read while waiting for something else
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	root, err := filepath.Abs("../../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("Z_ROOT", root)
+
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	server := NewServer(serverReader, serverWriter)
+	done := make(chan error)
+	go func() { done <- server.Serve() }()
+	t.Cleanup(func() {
+		clientWriter.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("serve error: %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("the server did not end")
+		}
+	})
+	return &client{t: t, in: clientWriter, out: bufio.NewReader(clientReader)}
+}
+
+// request sends a request and returns the body of its response, decoded into body
+func (c *client) request(command string, arguments interface{}, body interface{}) {
+	c.t.Helper()
+	c.seq++
+	content, _ := json.Marshal(arguments)
+	go writeMessage(c.in, &message{Seq: c.seq, Type: "request", Command: command, Arguments: content})
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.pending = append(c.pending, msg)
+			continue
+		}
+		if msg.RequestSeq != c.seq || msg.Command != command {
+			c.t.Fatalf("unexpected response %+v", msg)
+		}
+		if msg.Success == nil || !*msg.Success {
+			c.t.Fatalf("%s failed: %s", command, msg.Message)
+		}
+		if body != nil {
+			decode(c.t, msg.Body, body)
+		}
+		return
+	}
+}
+
+// event waits for an event and decodes its body into body
+func (c *client) event(event string, body interface{}) {
+	c.t.Helper()
+	for {
+		var msg *message
+		if len(c.pending) > 0 {
+			msg, c.pending = c.pending[0], c.pending[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type == "event" && msg.Event == event {
+			if body != nil {
+				decode(c.t, msg.Body, body)
+			}
+			return
+		}
+	}
+}
+
+func (c *client) read() *message {
+	c.t.Helper()
+	read := make(chan *message)
+	go func() {
+		msg, err := readMessage(c.out)
+		if err != nil {
+			c.t.Errorf("read error: %s", err)
+		}
+		read <- msg
+	}()
+	select {
+	case msg := <-read:
+		if msg == nil {
+			c.t.FailNow()
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("no message from the server")
+		return nil
+	}
+}
+
+func decode(t *testing.T, body interface{}, value interface{}) {
+	t.Helper()
+	content, _ := json.Marshal(body)
+	if err := json.Unmarshal(content, value); err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+}
+
+func writeProgram(t *testing.T) string {
+	t.Helper()
+	program := filepath.Join(t.TempDir(), "scores.z")
+	if err := os.WriteFile(program, []byte(testProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+// modes are the engines a program is debugged with
+var modes = []string{"vm", "eval"}
+
+func TestBreakpointAndVariables(t *testing.T) {
+	for _, mode := range modes {
+		t.Run(mode, func(t *testing.T) { testBreakpointAndVariables(t, mode) })
+	}
+}
+
+func testBreakpointAndVariables(t *testing.T, mode string) {
+	program := writeProgram(t)
+	c := newClient(t)
+	c.request("initialize", map[string]string{"adapterID": "z"}, nil)
+	c.event("initialized", nil)
+	c.request("launch", launchArguments{Program: program, Mode: mode}, nil)
+	c.request("setBreakpoints", setBreakpointsArguments{Source: source{Path: program}, Breakpoints: []sourceBreakpoint{{Line: 10}}}, nil)
+	c.request("configurationDone", nil, nil)
+
+	var stopped stoppedEvent
+	c.event("stopped", &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("wrong stop reason. got=%q", stopped.Reason)
+	}
+
+	var trace struct{ StackFrames []stackFrame }
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[0].Name != "total" || trace.StackFrames[0].Line != 10 ||
+		trace.StackFrames[1].Name != "main" || trace.StackFrames[1].Line != 12 {
+		t.Fatalf("wrong stack frames. got=%+v", trace.StackFrames)
+	}
+	if trace.StackFrames[0].Source.Path != program {
+		t.Errorf("wrong source. got=%+v", trace.StackFrames[0].Source)
+	}
+
+	var scopes struct{ Scopes []scope }
+	c.request("scopes", frameArguments{FrameID: trace.StackFrames[0].ID}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != localsScope || scopes.Scopes[1].Name != globalsScope {
+		t.Fatalf("wrong scopes. got=%+v", scopes.Scopes)
+	}
+
+	var locals struct{ Variables []variable }
+	c.request("variables", variablesArguments{scopes.Scopes[0].VariablesReference}, &locals)
+	values := map[string]variable{}
+	for _, v := range locals.Variables {
+		values[v.Name] = v
+	}
+	if values["sum"].Value != "8" || values["i"].Value != "2" {
+		t.Errorf("wrong locals. got=%+v", locals.Variables)
+	}
+
+	var elements struct{ Variables []variable }
+	c.request("variables", variablesArguments{values["names"].VariablesReference}, &elements)
+	if len(elements.Variables) != 2 || elements.Variables[1].Name != "1" || elements.Variables[1].Value != "bob" {
+		t.Errorf("wrong array elements. got=%+v", elements.Variables)
+	}
+
+	var pairs struct{ Variables []variable }
+	c.request("variables", variablesArguments{values["points"].VariablesReference}, &pairs)
+	if len(pairs.Variables) != 2 || pairs.Variables[0].Name != "ann" || pairs.Variables[0].Value != "3" {
+		t.Errorf("wrong hash pairs. got=%+v", pairs.Variables)
+	}
+
+	var result evaluateResult
+	c.request("evaluate", evaluateArguments{Expression: "sum", FrameID: trace.StackFrames[0].ID}, &result)
+	if result.Result != "8" {
+		t.Errorf("wrong evaluate result. got=%+v", result)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	var output outputEvent
+	c.event("output", &output)
+	if output.Category != "stdout" || output.Output != "8" {
+		t.Errorf("wrong output. got=%+v", output)
+	}
+	var exited exitedEvent
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code. got=%d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+	c.request("disconnect", nil, nil)
+}
+
+func TestStepping(t *testing.T) {
+	for _, mode := range modes {
+		t.Run(mode, func(t *testing.T) { testStepping(t, mode) })
+	}
+}
+
+func testStepping(t *testing.T, mode string) {
+	program := writeProgram(t)
+	c := newClient(t)
+	c.request("initialize", nil, nil)
+	c.request("launch", launchArguments{Program: program, StopOnEntry: true, Mode: mode}, nil)
+	c.request("configurationDone", nil, nil)
+
+	steps := []struct {
+		command string
+		reason  string
+		line    int
+	}{
+		{"", "entry", 1},
+		{"next", "step", 2},
+		{"next", "step", 12},
+		{"stepIn", "step", 3},
+		{"stepOut", "step", 12},
+	}
+	for _, step := range steps {
+		if step.command != "" {
+			c.request(step.command, map[string]int{"threadId": threadID}, nil)
+		}
+		var stopped stoppedEvent
+		c.event("stopped", &stopped)
+		var trace struct{ StackFrames []stackFrame }
+		c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+		if stopped.Reason != step.reason || trace.StackFrames[0].Line != step.line {
+			t.Fatalf("after %q: want %s at %d, got %s at %d", step.command, step.reason, step.line, stopped.Reason, trace.StackFrames[0].Line)
+		}
+	}
+	c.request("disconnect", nil, nil)
+}
+
+const closureProgram = `let counter = fn(step) {
+	let count = 0
+	return fn() {
+		count = count + step
+		return count
+	}
+}
+let next = counter(2)
+puts(next())
+`
+
+func TestClosureScope(t *testing.T) {
+	for _, mode := range modes {
+		t.Run(mode, func(t *testing.T) {
+			program := filepath.Join(t.TempDir(), "counter.z")
+			if err := os.WriteFile(program, []byte(closureProgram), 0644); err != nil {
+				t.Fatal(err)
+			}
+			c := newClient(t)
+			c.request("initialize", nil, nil)
+			c.request("launch", launchArguments{Program: program, Mode: mode}, nil)
+			c.request("setBreakpoints", setBreakpointsArguments{Source: source{Path: program}, Breakpoints: []sourceBreakpoint{{Line: 5}}}, nil)
+			c.request("configurationDone", nil, nil)
+			c.event("stopped", nil)
+
+			var trace struct{ StackFrames []stackFrame }
+			c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+			if len(trace.StackFrames) != 2 || trace.StackFrames[1].Line != 9 {
+				t.Fatalf("wrong stack frames. got=%+v", trace.StackFrames)
+			}
+			var scopes struct{ Scopes []scope }
+			c.request("scopes", frameArguments{FrameID: trace.StackFrames[0].ID}, &scopes)
+			if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != closureScope || scopes.Scopes[1].Name != globalsScope {
+				t.Fatalf("wrong scopes. got=%+v", scopes.Scopes)
+			}
+			var free struct{ Variables []variable }
+			c.request("variables", variablesArguments{scopes.Scopes[0].VariablesReference}, &free)
+			values := map[string]string{}
+			for _, v := range free.Variables {
+				values[v.Name] = v.Value
+			}
+			if len(values) != 2 || values["count"] != "2" || values["step"] != "2" {
+				t.Errorf("wrong closure variables. got=%+v", free.Variables)
+			}
+			c.request("disconnect", nil, nil)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Package debug decides where a debugged program pauses, at breakpoints and after steps.
+// The debuggers of the vm and of the evaluator share it, so that both engines pause at the same lines
+package debug
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"z/token"
+)
+
+// StepMode tells the debugger where to pause after the program goes on
+type StepMode int
+
+const (
+	Continue StepMode = iota // pause at the next breakpoint
+	StepInto                 // pause at the next line, inside a called function too
+	StepOver                 // pause at the next line of the current function or of a caller
+	StepOut                  // pause when the current function has returned
+	Stop                     // end the program
+)
+
+// PauseReason tells why the debugger paused
+type PauseReason int
+
+const (
+	PausedStep       PauseReason = iota // a step ended, or the program started
+	PausedBreakpoint                    // a breakpoint was reached
+	PausedInterrupt                     // Interrupt was called
+)
+
+// Breakpoint pauses the program before the first instruction or statement of a line.
+// An empty FileName matches every file, otherwise it matches the end of the file name
+type Breakpoint struct {
+	FileName string
+	Line     int
+}
+
+func (b Breakpoint) matches(pos token.Position) bool {
+	if b.Line != pos.Line {
+		return false
+	}
+	return b.FileName == "" || b.FileName == pos.FileName || strings.HasSuffix(pos.FileName, "/"+b.FileName)
+}
+
+// Stepper follows the lines a program runs and tells when it pauses.
+// Breakpoints may be changed and Interrupt called from other goroutines while the program runs
+type Stepper struct {
+	mu          sync.Mutex
+	breakpoints []Breakpoint
+	interrupted atomic.Bool
+
+	mode      StepMode
+	depth     int // calls of the pause the program went on from
+	lastPos   token.Position
+	lastDepth int
+}
+
+// NewStepper makes a stepper that pauses before the first line of the program
+func NewStepper() *Stepper {
+	return &Stepper{mode: StepInto}
+}
+
+// SetBreakpoints replaces the breakpoints
+func (s *Stepper) SetBreakpoints(breakpoints []Breakpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints = breakpoints
+}
+
+// Breakpoints returns the breakpoints
+func (s *Stepper) Breakpoints() []Breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.breakpoints
+}
+
+// Interrupt pauses the program at the next line it reaches
+func (s *Stepper) Interrupt() {
+	s.interrupted.Store(true)
+}
+
+// Before is called before the program runs the code at pos with depth calls in progress, it calls pause
+// when the program pauses there and tells if pause returned Stop.
+// Only the first code of a line can pause: the line changed in the same call, a function was entered,
+// or a function returned to its caller. An interrupt pauses at once, so a loop on a single line can be interrupted too
+func (s *Stepper) Before(pos token.Position, depth int, pause func(reason PauseReason) StepMode) bool {
+	if !pos.IsValid() {
+		return false
+	}
+	entered := depth > s.lastDepth || (depth == s.lastDepth && (pos.Line != s.lastPos.Line || pos.FileName != s.lastPos.FileName))
+	returned := depth < s.lastDepth
+	s.lastPos, s.lastDepth = pos, depth
+	if !entered && !returned && !s.interrupted.Load() {
+		return false
+	}
+
+	var paused bool
+	reason := PausedStep
+	switch {
+	case s.interrupted.Swap(false):
+		paused, reason = true, PausedInterrupt
+	case entered && s.atBreakpoint(pos):
+		paused, reason = true, PausedBreakpoint
+	case s.mode == StepInto:
+		paused = true
+	case s.mode == StepOver:
+		paused = (entered && depth <= s.depth) || depth < s.depth
+	case s.mode == StepOut:
+		paused = depth < s.depth
+	}
+	if !paused {
+		return false
+	}
+	s.mode = pause(reason)
+	s.depth = depth
+	return s.mode == Stop
+}
+
+func (s *Stepper) atBreakpoint(pos token.Position) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, b := range s.breakpoints {
+		if b.matches(pos) {
+			return true
+		}
+	}
+	return false
+}
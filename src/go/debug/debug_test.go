@@ -0,0 +1,65 @@
+package debug
+
+import (
+	"reflect"
+	"testing"
+	"z/token"
+)
+
+func TestBreakpointMatches(t *testing.T) {
+	pos := token.Position{FileName: "/src/lib/a.z", Line: 3}
+	tests := []struct {
+		breakpoint Breakpoint
+		expected   bool
+	}{
+		{Breakpoint{Line: 3}, true},
+		{Breakpoint{Line: 4}, false},
+		{Breakpoint{FileName: "/src/lib/a.z", Line: 3}, true},
+		{Breakpoint{FileName: "lib/a.z", Line: 3}, true},
+		{Breakpoint{FileName: "b/a.z", Line: 3}, false},
+		{Breakpoint{FileName: "ib/a.z", Line: 3}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.breakpoint.matches(pos); got != tt.expected {
+			t.Errorf("%+v matches %v, want %v", tt.breakpoint, got, tt.expected)
+		}
+	}
+}
+
+// TestStepper runs the lines of a call of f on line 5 from line 2, f has the lines 5 and 6
+func TestStepper(t *testing.T) {
+	type at struct{ line, depth int }
+	run := []at{{1, 1}, {2, 1}, {5, 2}, {6, 2}, {2, 1}, {3, 1}}
+	tests := []struct {
+		name        string
+		breakpoints []Breakpoint
+		modes       []StepMode
+		expected    []int
+	}{
+		{"step into", nil, []StepMode{StepInto, StepInto, StepInto, StepInto, StepInto, StepInto}, []int{1, 2, 5, 6, 2, 3}},
+		{"step over", nil, []StepMode{StepOver, StepOver, StepOver}, []int{1, 2, 3}},
+		{"step out", nil, []StepMode{StepInto, StepInto, StepOut, StepOver}, []int{1, 2, 5, 2, 3}},
+		{"breakpoint", []Breakpoint{{Line: 6}}, []StepMode{Continue}, []int{1, 6}},
+		{"stop", nil, []StepMode{StepInto, Stop}, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		s := NewStepper()
+		s.SetBreakpoints(tt.breakpoints)
+		lines := []int{}
+		for _, a := range run {
+			stop := s.Before(token.Position{FileName: "a.z", Line: a.line}, a.depth, func(reason PauseReason) StepMode {
+				lines = append(lines, a.line)
+				if len(lines) > len(tt.modes) {
+					return Continue
+				}
+				return tt.modes[len(lines)-1]
+			})
+			if stop {
+				break
+			}
+		}
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("%s: paused at %v, want %v", tt.name, lines, tt.expected)
+		}
+	}
+}
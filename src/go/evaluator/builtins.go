@@ -14,11 +14,30 @@ var Builtins = map[string]*object.Builtin{
 	"typeof":            object.GetBuiltinByName("typeof"),
 	"fetch":             object.GetBuiltinByName("fetch"),
 	"json_encode":       object.GetBuiltinByName("json_encode"),
+	"json_decode":       object.GetBuiltinByName("json_decode"),
+	"json_stream":       object.GetBuiltinByName("json_stream"),
 	"with_error":        object.GetBuiltinByName("with_error"),
 	"is_with_error":     object.GetBuiltinByName("is_with_error"),
 	"get_error_message": object.GetBuiltinByName("get_error_message"),
 	"syscall":           object.GetBuiltinByName("syscall"),
+	"stack_trace":       object.GetBuiltinByName("stack_trace"),
 	"version":           object.GetBuiltinByName("version"),
 	"file_get_contents": object.GetBuiltinByName("file_get_contents"),
 	"file_put_contents": object.GetBuiltinByName("file_put_contents"),
+	"byte_len":          object.GetBuiltinByName("byte_len"),
+	"bytes":             object.GetBuiltinByName("bytes"),
+	"from_bytes":        object.GetBuiltinByName("from_bytes"),
+	"keys":              object.GetBuiltinByName("keys"),
+	"values":            object.GetBuiltinByName("values"),
+	"delete":            object.GetBuiltinByName("delete"),
+	"has_key":           object.GetBuiltinByName("has_key"),
+	"merge":             object.GetBuiltinByName("merge"),
+	"append":            object.GetBuiltinByName("append"),
+	"pop":               object.GetBuiltinByName("pop"),
+	"shift":             object.GetBuiltinByName("shift"),
+	"insert":            object.GetBuiltinByName("insert"),
+	"remove":            object.GetBuiltinByName("remove"),
+	"sort":              object.GetBuiltinByName("sort"),
+	"reverse":           object.GetBuiltinByName("reverse"),
+	"http_server":       object.GetBuiltinByName("http_server"),
 }
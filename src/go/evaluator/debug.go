@@ -0,0 +1,158 @@
+package evaluator
+
+import (
+	"sort"
+	"z/debug"
+	"z/module"
+	"z/object"
+	"z/token"
+)
+
+// Debugger pauses an evaluation at breakpoints and after steps, like the debugger of the vm.
+// Pause is called with the evaluation stopped before a statement, or where a call returned, and returns how to go on,
+// the evaluation can be inspected with Position, CallStack and Scopes meanwhile.
+// Breakpoints may be changed and Interrupt called from other goroutines while the program runs
+type Debugger struct {
+	Pause func(d *Debugger, reason debug.PauseReason) debug.StepMode
+	*debug.Stepper
+
+	stopped bool
+
+	pos token.Position      // where the evaluation is paused
+	env *object.Environment // the environment it is paused in
+}
+
+// NewDebugger makes a debugger that pauses before the first line of the program
+func NewDebugger(pause func(d *Debugger, reason debug.PauseReason) debug.StepMode) *Debugger {
+	return &Debugger{Pause: pause, Stepper: debug.NewStepper()}
+}
+
+// EvalModule runs a program like EvalModule does, with the debugger pausing it
+func (d *Debugger) EvalModule(main *module.Module) object.Object {
+	return evalModule(main, d)
+}
+
+// Stopped tells if the program ended because Pause returned Stop
+func (d *Debugger) Stopped() bool {
+	return d.stopped
+}
+
+// debugStop lets the debugger of the evaluation of env pause at pos, the error it returns stops the evaluation
+func debugStop(pos token.Position, env *object.Environment) *object.Error {
+	if stop := env.Calls().Debug; stop != nil {
+		return stop(pos, env)
+	}
+	return nil
+}
+
+// before is called before each statement and where each call returns.
+// Once stopped, every statement stops again, so a catch can not keep the program going
+func (d *Debugger) before(pos token.Position, env *object.Environment) *object.Error {
+	if d.stopped {
+		return newError("stopped by the debugger")
+	}
+	d.stopped = d.Before(pos, len(env.Calls().Frames), func(reason debug.PauseReason) debug.StepMode {
+		d.pos, d.env = pos, env
+		defer func() { d.pos, d.env = token.Position{}, nil }()
+		return d.Pause(d, reason)
+	})
+	if d.stopped {
+		return newError("stopped by the debugger")
+	}
+	return nil
+}
+
+// Position is where the evaluation is paused
+func (d *Debugger) Position() token.Position {
+	return d.pos
+}
+
+// CallStack lists the calls in progress, innermost first
+func (d *Debugger) CallStack() object.Stack {
+	return captureStack(d.pos, d.env.Calls())
+}
+
+// Variable is a named value shown by the debugger
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Scope is the variables of a part of the environment chain of a call
+type Scope struct {
+	Name      string // Locals, Closure or Globals
+	Variables []Variable
+}
+
+// Scopes are the variables the call at index of CallStack sees, innermost first:
+// its locals with those of the blocks it is in, those of the functions it was defined in, and the globals of its module.
+// An inner name hides an outer one, a scope without variables is left out but for the globals
+func (d *Debugger) Scopes(index int) []Scope {
+	frames := d.env.Calls().Frames
+	if index < 0 || index > len(frames) {
+		return nil
+	}
+	env := d.env
+	var closure *object.Environment // the environment of the function, the locals end there
+	if index > 0 {
+		env = frames[len(frames)-index].Caller
+	}
+	if index < len(frames) {
+		closure = frames[len(frames)-1-index].Closure
+	}
+
+	scopes := []Scope{}
+	seen := map[string]bool{}
+	current := Scope{Name: "Locals"}
+	for {
+		outer := env.Outer()
+		if outer == env { // the environment of the module
+			break
+		}
+		if env == closure {
+			scopes = appendScope(scopes, current)
+			current = Scope{Name: "Closure"}
+		}
+		current.Variables = append(current.Variables, unseen(env, seen)...)
+		env = outer
+	}
+	scopes = appendScope(scopes, current)
+	return append(scopes, Scope{Name: "Globals", Variables: unseen(env, seen)})
+}
+
+func appendScope(scopes []Scope, scope Scope) []Scope {
+	if len(scope.Variables) == 0 {
+		return scopes
+	}
+	return append(scopes, scope)
+}
+
+// unseen are the variables of env, sorted by name, that an inner environment did not hide
+func unseen(env *object.Environment, seen map[string]bool) []Variable {
+	store := env.GetAll()
+	names := []string{}
+	for name := range store {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	variables := []Variable{}
+	for _, name := range names {
+		variables = append(variables, Variable{name, store[name]})
+	}
+	return variables
+}
+
+// LookupVariable finds a name like the call at index of CallStack would
+func (d *Debugger) LookupVariable(index int, name string) (object.Object, bool) {
+	for _, scope := range d.Scopes(index) {
+		for _, variable := range scope.Variables {
+			if variable.Name == name {
+				return variable.Value, true
+			}
+		}
+	}
+	return nil, false
+}
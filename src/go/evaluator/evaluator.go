@@ -1,7 +1,6 @@
 package evaluator
 
 import (
-	"encoding/json"
 	"fmt"
 	"path"
 	"strings"
@@ -11,19 +10,20 @@ import (
 )
 
 var (
-	NULL         = &object.Null{}
-	TRUE         = &object.Boolean{Value: true}
-	FALSE        = &object.Boolean{Value: false}
-	initedEnv    object.Environment
-	withBreakKey = "is_with_break"
-	isWithBreak  = "Y"
-	notWithBreak = "N"
-	breakKeyWord = "break"
+	NULL           = object.NULL
+	TRUE           = object.TRUE
+	FALSE          = object.FALSE
+	withBreakKey   = "is_with_break"
+	isWithBreak    = "Y"
+	isWithContinue = "C"
+	notWithBreak   = "N"
+	breakLabelKey  = "break_label" // the label a break or a continue names, empty for the innermost loop
 )
 
+// isError reports whether obj is an error that is still unwinding evaluation
 func isError(obj object.Object) bool {
-	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+	if err, ok := obj.(*object.Error); ok {
+		return !err.Caught
 	}
 	return false
 }
@@ -31,12 +31,13 @@ func isError(obj object.Object) bool {
 func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		initedEnv = *env
 		return evalProgram(node, env)
 	case *ast.ExpressionStatement:
 		return Eval(node.Expression, env)
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		env.Set(node.Name.Value, val, node.PackageName)
@@ -46,32 +47,33 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withPosition(evalPrefixExpression(node.Operator, right), node, env)
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return withPosition(evalIdentifier(node, env), node, env)
 	case *ast.InfixExpression:
+		if isMemberOperator(node.Operator) {
+			value, _ := evalChain(node, env)
+			return value
+		}
+		if target, ok := node.Left.(*ast.IndexExpression); ok && isAssignOperator(node.Operator) {
+			return withPosition(evalIndexAssign(node, target, env), node, env)
+		}
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
+		if node.Operator == token.NULLISH {
+			if !isNull(left) {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) && node.Operator != token.OBJET_GET && node.Operator != token.CLASS_GET {
+		if isError(right) {
 			return right
 		}
-		if node.Operator == token.OBJET_GET || node.Operator == token.CLASS_GET { // object get not need eval
-			right = &object.String{Value: node.Right.String()}
-		}
-		infixValue := evalInfixExpression(node.Operator, left, right)
-		resetOperators := []string{
-			"+=",
-			"-=",
-			"*=",
-			"/=",
-			"++",
-			"--",
-			"=",
-		}
-		if isInStringArray(resetOperators, node.Operator) { // need reset env data
+		infixValue := withPosition(evalInfixExpression(node.Operator, left, right), node, env)
+		if isAssignOperator(node.Operator) { // need reset env data
 			leftIdentifier, ok := node.Left.(*ast.Identifier)
 			if ok {
 				isFromOuter := env.IsFormOuter(leftIdentifier.Value, leftIdentifier.PackageName)
@@ -97,6 +99,14 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return withPosition(throwValue(val), node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
@@ -106,19 +116,12 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return function
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
-		}
-		return applyFunction(function, args)
+		value, _ := evalChain(node, env)
+		return value
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
@@ -126,50 +129,20 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
-			return left
-		}
-		index := Eval(node.Index, env)
-		if isError(index) {
-			return index
-		}
-		return evalIndexExpression(left, index)
+		value, _ := evalChain(node, env)
+		return value
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
-	case *ast.HashAssignExpress:
-		hashObject, ok := env.Get(node.Hash.Value, node.Hash.PackageName)
-		if !ok {
-			return newError("hash variable " + node.Hash.Value + " not found")
-		}
-		index := Eval(node.Index, env)
-		val := Eval(node.Value, env)
-		hash, ok := hashObject.(*object.Hash)
-		if !ok {
-			return newError("object is not hash")
-		}
-		hashKey, ok := index.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s,", index.Type())
-		}
-		hashed := hashKey.HashKey()
-		_, ok = hash.Pairs[hashed]
-		hashMaxIndex := hash.MaxIndex
-		if !ok {
-			hashMaxIndex = hash.MaxIndex + 1
-		}
-		hash.Pairs[hashed] = object.HashPair{Key: index, Value: val, Index: hashMaxIndex}
-		hash.MaxIndex = hashMaxIndex
-		env.Set(node.Hash.Value, hash, node.Hash.PackageName)
-		return val
+		return withPosition(evalHashLiteral(node, env), node, env)
 	case *ast.FloatLiteral:
 		return &object.Float{Value: node.Value}
 	case *ast.ForExpression:
 		return evalForExpression(node, env)
+	case *ast.ForInExpression:
+		return evalForInExpression(node, env)
 	case *ast.ClassExpress:
-		return evalClassExpression(node, env)
+		return withPosition(evalClassExpression(node, env), node, env)
 	case *ast.ObjectExpress:
-		evaledObject := evalObjectExpression(node, env)
+		evaledObject := withPosition(evalObjectExpression(node, env), node, env)
 		objectExpression, ok := evaledObject.(*object.ObjectInstance)
 		if ok {
 			init, ok := objectExpression.Environment.Get("__init", "")
@@ -181,7 +154,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 					for index := range initFn.Parameters {
 						initFn.Env.Set(initFn.Parameters[index].Value, args[index], "")
 					}
-					applyFunction(initFn, args)
+					applyFunction(initFn, args, env.Calls())
 				}
 			}
 		}
@@ -191,9 +164,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
-
-	hashMaxIndex := 0
+	hash := &object.Hash{}
 	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
@@ -210,73 +181,105 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		hashMaxIndex++
-		pairs[hashed] = object.HashPair{Key: key, Value: value, Index: int8(hashMaxIndex)}
+		hash.Set(hashKey, value)
 	}
-	return &object.Hash{Pairs: pairs, MaxIndex: int8(hashMaxIndex)}
+	return hash
 }
 
-func evalIndexExpression(left, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalStringIndexExpress(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
-	default:
-		return newError("index operator not supported: %s ", left.Type())
+// isAssignOperator tells whether operator assigns to its left side
+func isAssignOperator(operator string) bool {
+	switch operator {
+	case "=", "+=", "-=", "*=", "/=", "++", "--":
+		return true
 	}
+	return false
 }
 
-func evalStringIndexExpress(str, index object.Object) object.Object {
-	stringObject, _ := str.(*object.String)
-	key, _ := index.(*object.Integer)
-	idx := key.Value
-	max := len(stringObject.Value)
-	if idx < 0 || idx > int64(max) {
-		return NULL
+// evalIndexAssign evaluates left[index] = value and left[index] += value and the like, in place.
+// The left side and the index are evaluated once, before the value
+func evalIndexAssign(node *ast.InfixExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	if target.Optional || target.Slice {
+		return newError("cannot assign to %s", target.String())
+	}
+	left := Eval(target.Left, env)
+	if isError(left) {
+		return left
+	}
+	index := Eval(target.Index, env)
+	if isError(index) {
+		return index
+	}
+	value := Eval(node.Right, env)
+	if isError(value) {
+		return value
 	}
-	returnStringObject := object.String{}
-	char := stringObject.Value[idx]
-	singleString := string(char)
-	if char == '\n' {
-		singleString = "\\n"
+	if node.Operator != token.ASSIGN {
+		current := object.Index(left, index)
+		if isError(current) {
+			return current
+		}
+		value = evalInfixExpression(arithmeticOperator(node.Operator), current, value)
+		if isError(value) {
+			return value
+		}
 	}
-	returnStringObject.Value = singleString
-	return &returnStringObject
+	return object.SetIndex(left, index, value)
 }
-func evalHashIndexExpression(hash, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
 
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+// evalTemplateLiteral joins the text of a string with its ${...} values, printed the way puts prints them
+func evalTemplateLiteral(tl *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+	for _, part := range tl.Parts {
+		value := Eval(part, env)
+		if isError(value) {
+			return value
+		}
+		if value == nil {
+			value = NULL
+		}
+		out.WriteString(value.Inspect())
 	}
+	return &object.String{Value: out.String()}
+}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
-
+// callFunction applies fn while keeping it on the call stack of env, so errors raised inside it can report a stack trace
+func callFunction(fn object.Object, args []object.Object, node *ast.CallExpression, env *object.Environment) object.Object {
+	calls := env.Calls()
+	function, ok := fn.(*object.Function)
 	if !ok {
-		return NULL
+		return applyFunction(fn, args, calls)
+	}
+	calls.Frames = append(calls.Frames, object.CallFrame{Function: functionName(function), CallSite: node.Pos(), Caller: env, Closure: function.Env})
+	result := applyFunction(fn, args, calls)
+	calls.Frames = calls.Frames[:len(calls.Frames)-1]
+	if stop := debugStop(node.Pos(), env); stop != nil { // the function returned to its caller
+		return stop
 	}
-	return pair.Value
+	return result
 }
 
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObj := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObj.Elements) - 1)
-	if idx < 0 || idx > max {
-		return NULL
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "fn"
 	}
-	return arrayObj.Elements[idx]
+	return fn.Name
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// captureStack returns the calls in progress, innermost first, for an error raised at pos
+func captureStack(pos token.Position, calls *object.CallStack) object.Stack {
+	stack := object.Stack{}
+	for i := len(calls.Frames) - 1; i >= 0; i-- {
+		stack = append(stack, object.StackFrame{Function: calls.Frames[i].Function, Position: pos})
+		pos = calls.Frames[i].CallSite
+	}
+	return append(stack, object.StackFrame{Function: "main", Position: pos})
+}
+
+// applyFunction calls fn in the evaluation whose calls are in progress on calls
+func applyFunction(fn object.Object, args []object.Object, calls *object.CallStack) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendEnv := extendFunctionEnv(fn, args)
+		extendEnv := extendFunctionEnv(fn, args, calls)
 		if fn.Env != nil {
 			extendEnv := fn.Env
 			this, ok := fn.Env.Get("this", "")
@@ -287,7 +290,13 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		evaluated := Eval(fn.Body, extendEnv)
 		return unwrapReturnValue(evaluated)
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		var result object.Object
+		if fn.CallFn != nil {
+			result = fn.CallFn(callBack(calls), args...)
+		} else {
+			result = fn.Fn(args...)
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
@@ -296,8 +305,19 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
-	env := object.NewEnclosedEnviroment(fn.Env)
+// callBack calls functions of the program for a builtin like sort
+func callBack(calls *object.CallStack) object.Caller {
+	return func(fn object.Object, args ...object.Object) object.Object {
+		result := applyFunction(fn, args, calls)
+		if result == nil {
+			return NULL
+		}
+		return result
+	}
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object, calls *object.CallStack) *object.Environment {
+	env := object.NewEnclosedEnviroment(fn.Env).WithCalls(calls)
 	for paramIdx, param := range fn.Parameters {
 		if paramIdx < len(args) {
 			env.Set(param.Value, args[paramIdx], "")
@@ -345,15 +365,11 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 
 	if isTruthy(condition) {
 		consequenceVal := Eval(ie.Consequence, env)
-		if env.Context[withBreakKey] == isWithBreak {
-			env.Outer().Context[withBreakKey] = isWithBreak
-		}
+		passLoopExit(env, env.Outer())
 		return consequenceVal
 	} else if ie.Alternative != nil {
 		alternativeVal := Eval(ie.Alternative, env)
-		if env.Context[withBreakKey] == isWithBreak {
-			env.Outer().Context[withBreakKey] = isWithBreak
-		}
+		passLoopExit(env, env.Outer())
 		return alternativeVal
 	} else {
 		return NULL
@@ -370,8 +386,14 @@ func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) objec
 
 	for isTruthy(condition) {
 		bodyResult := Eval(we.Body, env)
-		if env.Context[withBreakKey] == isWithBreak {
-			break
+		if isLoopResult(bodyResult) {
+			return bodyResult
+		}
+		switch endIteration(env, we.Label) {
+		case isWithBreak:
+			return NULL
+		case isWithContinue:
+			bodyResult = NULL
 		}
 		condition := Eval(we.Condition, env)
 		if !isTruthy(condition) {
@@ -381,6 +403,64 @@ func evalWhileExpression(we *ast.WhileExpression, env *object.Environment) objec
 	return NULL
 }
 
+// isLoopResult tells whether the value of the body of a loop ends the loop, a return or an error
+func isLoopResult(result object.Object) bool {
+	return result != nil && (result.Type() == object.RETURN_VALUE_OBJ || isError(result))
+}
+
+// loopExit tells whether statement is a break or a continue, it returns what it does and the label it names
+func loopExit(statement ast.Statement) (string, string, bool) {
+	stmt, ok := statement.(*ast.ExpressionStatement)
+	if !ok {
+		return "", "", false
+	}
+	switch exit := stmt.Expression.(type) {
+	case *ast.BreakExpression:
+		return isWithBreak, labelName(exit.Label), true
+	case *ast.ContinueExpression:
+		return isWithContinue, labelName(exit.Label), true
+	}
+	return "", "", false
+}
+
+func labelName(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Value
+}
+
+// leavingLoop tells whether a break or a continue is leaving the code running in env
+func leavingLoop(env *object.Environment) bool {
+	exit := env.Context[withBreakKey]
+	return exit == isWithBreak || exit == isWithContinue
+}
+
+// passLoopExit passes a break or a continue leaving the code running in from on to the enclosing code
+func passLoopExit(from *object.Environment, to *object.Environment) {
+	if leavingLoop(from) {
+		to.Context[withBreakKey] = from.Context[withBreakKey]
+		to.Context[breakLabelKey] = from.Context[breakLabelKey]
+	}
+}
+
+// endIteration handles a break or a continue reaching the loop with label running in env at the end of an iteration,
+// it returns isWithBreak when the loop stops, isWithContinue when it goes on after a continue and notWithBreak otherwise.
+// A break or a continue naming another loop stops this one and is passed on to the loop around it
+func endIteration(env *object.Environment, label *ast.Identifier) string {
+	if !leavingLoop(env) {
+		return notWithBreak
+	}
+	exit := env.Context[withBreakKey]
+	if target := env.Context[breakLabelKey]; target != "" && target != labelName(label) {
+		passLoopExit(env, env.Outer())
+		return isWithBreak
+	}
+	env.Context[withBreakKey] = notWithBreak
+	env.Context[breakLabelKey] = ""
+	return exit
+}
+
 func isTruthy(obj object.Object) bool {
 	boolean, ok := obj.(*object.Boolean) // question ?
 	if ok {
@@ -408,12 +488,13 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 		return right
 	case operator == token.ASSIGN:
 		return right
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		if result, ok := object.Compare(operator, left, right); ok {
+			return nativeBoolToBooleanObject(result)
+		}
+		return object.Arithmetic(arithmeticOperator(operator), left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
-	case left.Type() == object.FLOAT_OBJ && right.Type() == object.FLOAT_OBJ:
-		return evalFloatInfixExpression(operator, left, right)
 	case operator == token.EQ:
 		return nativeBoolToBooleanObject(left == right)
 	case operator == token.NOT_EQ:
@@ -429,6 +510,21 @@ func evalInfixExpression(operator string, left object.Object, right object.Objec
 	}
 }
 
+// arithmeticOperator is the operator x += y, x++ and the like apply
+func arithmeticOperator(operator string) string {
+	switch operator {
+	case "++", "+=":
+		return "+"
+	case "--", "-=":
+		return "-"
+	case "*=":
+		return "*"
+	case "/=":
+		return "/"
+	}
+	return operator
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -444,78 +540,6 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		fallthrough
-	case "++":
-		fallthrough
-	case "+=":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		fallthrough
-	case "--":
-		fallthrough
-	case "-=":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		fallthrough
-	case "*=":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		fallthrough
-	case "/=":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "<=":
-		return nativeBoolToBooleanObject(leftVal <= rightVal)
-	case ">=":
-		return nativeBoolToBooleanObject(leftVal >= rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return NULL
-	}
-}
-
-func evalFloatInfixExpression(operator string, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.Float).Value
-	rightVal := right.(*object.Float).Value
-
-	switch operator {
-	case "+":
-		return &object.Float{Value: leftVal + rightVal}
-	case "-":
-		return &object.Float{Value: leftVal - rightVal}
-	case "*":
-		return &object.Float{Value: leftVal * rightVal}
-	case "/":
-		return &object.Float{Value: leftVal / rightVal}
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "<=":
-		return nativeBoolToBooleanObject(leftVal <= rightVal)
-	case ">=":
-		return nativeBoolToBooleanObject(leftVal >= rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return NULL
-	}
-}
-
 func evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
@@ -528,11 +552,13 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperationExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return newError("unknown operator: -%s", right.Type())
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -557,19 +583,26 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range block.Statements {
-		if statement.TokenLiteral() == breakKeyWord {
-			env.Context[withBreakKey] = isWithBreak
+		if stop := debugStop(statement.Pos(), env); stop != nil {
+			return stop
+		}
+		if exit, label, ok := loopExit(statement); ok {
+			env.Context[withBreakKey] = exit
+			env.Context[breakLabelKey] = label
 			evalDeferStatement(block.DeferStatements, env)
 			return result
 		}
 		result = Eval(statement, env)
 		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if result.Type() == object.RETURN_VALUE_OBJ || isError(result) {
 				evalDeferStatement(block.DeferStatements, env)
 				return result
 			}
 		}
+		if leavingLoop(env) { // break in a nested block leaves this one too
+			evalDeferStatement(block.DeferStatements, env)
+			return result
+		}
 	}
 	evalDeferStatement(block.DeferStatements, env)
 	return result
@@ -582,18 +615,15 @@ func evalDeferStatement(statements []ast.Statement, env *object.Environment) {
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value, node.PackageName)
-
-	if builtin, ok := Builtins[node.Value]; ok {
-		return builtin
-	}
-	if node.Value == "http_server" {
-		return init_builtin_http_server()
+	// the names a program declares shadow the builtins, but for the fields and methods of classes:
+	// a method push can still call the builtin push
+	builtin, isBuiltin := Builtins[node.Value]
+	if val, declaredIn, ok := env.Lookup(node.Value, node.PackageName); ok && !(isBuiltin && declaredIn.Members) {
+		return val
 	}
-	if node.Value == "json_decode" {
-		return init_builtin_json_decode()
+	if isBuiltin {
+		return builtin
 	}
-
 	if node.Value == "__FILE__" {
 		return &object.String{Value: node.FileName}
 	}
@@ -601,26 +631,112 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	if node.Value == "__DIR__" {
 		return &object.String{Value: path.Dir(node.FileName)}
 	}
+	return newError("undefined variable %s", node.Value)
+}
 
-	if !ok {
-		return newError("identifier not found:%s", node.Value)
+func isMemberOperator(operator string) bool {
+	return operator == token.OBJET_GET || operator == token.CLASS_GET || operator == token.OPTIONAL_GET
+}
+
+// isNull tells whether obj is null, what ?? and the optional ?-> and ?.[] look for
+func isNull(obj object.Object) bool {
+	return obj == nil || obj.Type() == object.NULL_OBJ
+}
+
+// evalChain evaluates a member access, an index or a call together with the ones its left side is made of.
+// When a ?-> or a ?.[] finds null on its left the rest of the chain is skipped, the chain is null and evalChain is true
+func evalChain(node ast.Expression, env *object.Environment) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.InfixExpression:
+		if !isMemberOperator(node.Operator) {
+			break
+		}
+		left, skipped := evalChain(node.Left, env)
+		if skipped || isError(left) {
+			return left, skipped
+		}
+		operator := node.Operator
+		if operator == token.OPTIONAL_GET {
+			if isNull(left) {
+				return NULL, true
+			}
+			operator = token.OBJET_GET
+		}
+		right := &object.String{Value: node.Right.String()} // the member name is not evaluated
+		return withPosition(evalInfixExpression(operator, left, right), node, env), false
+	case *ast.IndexExpression:
+		left, skipped := evalChain(node.Left, env)
+		if skipped || isError(left) {
+			return left, skipped
+		}
+		if node.Optional && isNull(left) {
+			return NULL, true
+		}
+		if node.Slice {
+			return withPosition(evalSliceExpression(node, left, env), node, env), false
+		}
+		index := Eval(node.Index, env)
+		if isError(index) {
+			return index, false
+		}
+		return withPosition(object.Index(left, index), node, env), false
+	case *ast.CallExpression:
+		function, skipped := evalChain(node.Function, env)
+		if skipped || isError(function) {
+			return function, skipped
+		}
+		args := evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0], false
+		}
+		return withPosition(callFunction(function, args, node, env), node, env), false
+	}
+	return Eval(node, env), false
+}
+
+// evalSliceExpression is left[low:high], a bound that is left out is nil
+func evalSliceExpression(node *ast.IndexExpression, left object.Object, env *object.Environment) object.Object {
+	var bounds [2]object.Object
+	for i, bound := range []ast.Expression{node.Index, node.High} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
 	}
-	return val
+	return object.Slice(left, bounds[0], bounds[1])
 }
 
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// withPosition records where node is in the source, and the calls of env leading to it,
+// on an error that does not know its position yet
+func withPosition(obj object.Object, node ast.Node, env *object.Environment) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Position.IsValid() {
+		err.Position = node.Pos()
+		err.Stack = captureStack(err.Position, env.Calls())
+	}
+	return obj
+}
+
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
+		if stop := debugStop(statement.Pos(), env); stop != nil {
+			return stop
+		}
 		result = Eval(statement, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
-			return result
+			if isError(result) {
+				return result
+			}
 		}
 		if returnValue, ok := result.(*object.ReturnValue); ok {
 			return returnValue.Value
@@ -636,17 +752,6 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func isInStringArray(array []string, findStr string) bool {
-	isFind := false
-	for _, str := range array {
-		if str == findStr {
-			isFind = true
-			break
-		}
-	}
-	return isFind
-}
-
 func evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Object {
 	env = object.NewEnclosedEnviroment(env)
 	Eval(fe.Initor, env)
@@ -658,10 +763,16 @@ func evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Ob
 
 	for isTruthy(condition) {
 		bodyResult := Eval(fe.Body, env)
-		Eval(fe.After, env)
-		if env.Context[withBreakKey] == isWithBreak {
-			break
+		if isLoopResult(bodyResult) {
+			return bodyResult
+		}
+		switch endIteration(env, fe.Label) {
+		case isWithBreak:
+			return NULL
+		case isWithContinue:
+			bodyResult = NULL
 		}
+		Eval(fe.After, env)
 		condition := Eval(fe.Condition, env)
 		if !isTruthy(condition) {
 			return bodyResult
@@ -670,12 +781,56 @@ func evalForExpression(fe *ast.ForExpression, env *object.Environment) object.Ob
 	return NULL
 }
 
+// evalForInExpression runs the body for each element of the collection, the value of the loop is the value
+// of its body in the last iteration, or null when the body never ran or the loop was left with break
+func evalForInExpression(fe *ast.ForInExpression, env *object.Environment) object.Object {
+	collection := Eval(fe.Collection, env)
+	if isError(collection) {
+		return collection
+	}
+	iterator, ok := object.NewIterator(collection)
+	if !ok {
+		return withPosition(newError("cannot iterate over %s", collection.Type()), fe.Collection, env)
+	}
+	defer iterator.Close()
+	env = object.NewEnclosedEnviroment(env)
+	env.Context[withBreakKey] = notWithBreak
+
+	var result object.Object = NULL
+	for {
+		values, ok := iterator.Next(len(fe.Names))
+		if !ok {
+			if err := iterator.Err(); err != nil {
+				return withPosition(newError("%s", err), fe.Collection, env)
+			}
+			return result
+		}
+		for i, name := range fe.Names {
+			env.Set(name.Value, values[i], name.PackageName)
+		}
+		result = Eval(fe.Body, env)
+		if isLoopResult(result) {
+			return result
+		}
+		switch endIteration(env, fe.Label) {
+		case isWithBreak:
+			return NULL
+		case isWithContinue:
+			result = NULL
+		}
+		if result == nil {
+			result = NULL
+		}
+	}
+}
+
 func evalClassExpression(ce *ast.ClassExpress, env *object.Environment) object.Object {
 	classObject := &object.Class{
 		Name:    ce.Name.Value,
 		Parents: []*object.Class{},
 	}
 	classEnv := object.NewEnclosedEnviroment(env)
+	classEnv.Members = true
 	for _, letStatement := range ce.LetStatements {
 		value := Eval(letStatement, classEnv)
 		classEnv.Set(letStatement.Name.Value, value, "")
@@ -686,7 +841,7 @@ func evalClassExpression(ce *ast.ClassExpress, env *object.Environment) object.O
 		classEnv.Set(function.Name, functionValue, "")
 	}
 	for _, parent := range ce.Parents {
-		parentObj, ok := env.Get(parent.Value, "")
+		parentObj, ok := env.Get(parent.Value, parent.PackageName)
 		if !ok {
 			return newError("parent class not exists")
 		}
@@ -703,11 +858,14 @@ func evalClassExpression(ce *ast.ClassExpress, env *object.Environment) object.O
 
 func evalObjectExpression(oe *ast.ObjectExpress, env *object.Environment) object.Object {
 	objectInstance := &object.ObjectInstance{}
-	class, ok := env.Get(oe.Class.Value, "")
+	class, ok := env.Get(oe.Class.Value, oe.Class.PackageName)
 	objectEnv := object.NewEnclosedEnviroment(env)
 	if ok {
 		instanceClass, ok := class.(*object.Class)
 		if ok {
+			// the methods see the names of the module the class is declared in
+			objectEnv = object.NewEnclosedEnviroment(instanceClass.Environment.Outer())
+			objectEnv.Members = true
 			objectInstance.InstanceClass = instanceClass
 			copyClassProperties(instanceClass, objectEnv, false)
 			objectInstance.Environment = objectEnv
@@ -721,6 +879,7 @@ func evalObjectExpression(oe *ast.ObjectExpress, env *object.Environment) object
 func copyClassProperties(class *object.Class, env *object.Environment, isParent bool) {
 	classEvnProperties := class.Environment.GetAll()
 	newEnv := object.NewEnclosedEnviroment(env)
+	newEnv.Members = true
 
 	if len(class.Parents) > 0 {
 		for _, parent := range class.Parents {
@@ -730,16 +889,16 @@ func copyClassProperties(class *object.Class, env *object.Environment, isParent
 
 	for name, classProperty := range classEvnProperties {
 		newClassProperty := classProperty
-		buffer, _ := json.Marshal(&classProperty)
-		json.Unmarshal([]byte(buffer), newClassProperty)
-
-		functionValue, ok := newClassProperty.(*object.Function)
+		functionValue, ok := classProperty.(*object.Function)
 		if ok {
+			// every object gets its own copy of the method, the Env of the copy is bound to the object
+			method := *functionValue
 			if isParent {
-				functionValue.Env = newEnv
+				method.Env = newEnv
 			} else {
-				functionValue.Env = nil
+				method.Env = nil
 			}
+			newClassProperty = &method
 		}
 		newEnv.Set(name, newClassProperty, "")
 		if isParent && (strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "__")) { // ignore parent _ start property
@@ -750,9 +909,12 @@ func copyClassProperties(class *object.Class, env *object.Environment, isParent
 }
 
 func evalObjectGetInfixExpress(left object.Object, right object.Object) object.Object {
+	if errorObject, ok := left.(*object.Error); ok {
+		return getErrorValue(errorObject, right)
+	}
 	objectInstance, ok := left.(*object.ObjectInstance)
 	if !ok {
-		return newError("left is not object")
+		return newError("cannot get member %s of %s", right.Inspect(), left.Type())
 	}
 	return getObjectInstanceValue(objectInstance, right)
 }
@@ -811,3 +973,51 @@ func getObjectInstanceValue(objectInstance *object.ObjectInstance, right object.
 	}
 	return NULL
 }
+
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := evalScopedBlock(te.Block, env)
+	if err, ok := result.(*object.Error); ok && isError(err) && te.Catch != nil {
+		err.Caught = true
+		catchEnv := object.NewEnclosedEnviroment(env)
+		if te.Parameter != nil {
+			catchEnv.Set(te.Parameter.Value, err, "")
+		}
+		result = evalScopedBlock(te.Catch, catchEnv)
+	}
+	if te.Finally != nil {
+		finallyResult := evalScopedBlock(te.Finally, env)
+		if finallyResult != nil && (finallyResult.Type() == object.RETURN_VALUE_OBJ || isError(finallyResult)) {
+			return finallyResult
+		}
+	}
+	return result
+}
+
+// evalScopedBlock evaluates block in its own environment, passing a break on to the enclosing loop
+func evalScopedBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	blockEnv := object.NewEnclosedEnviroment(env)
+	result := Eval(block, blockEnv)
+	passLoopExit(blockEnv, env)
+	return result
+}
+
+// throwValue turns the operand of a throw statement into an error, a caught error is raised again as it was
+func throwValue(val object.Object) *object.Error {
+	if err, ok := val.(*object.Error); ok {
+		rethrown := *err
+		rethrown.Caught = false
+		return &rethrown
+	}
+	return &object.Error{Message: val.Inspect(), ErrorType: object.THROWN_ERROR, Value: val}
+}
+
+func getErrorValue(err *object.Error, right object.Object) object.Object {
+	rightString, ok := right.(*object.String)
+	if !ok {
+		return newError("right is not string")
+	}
+	if value := err.Field(rightString.Value); value != nil {
+		return value
+	}
+	return NULL
+}
@@ -1,8 +1,13 @@
 package evaluator
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"z/lexer"
+	"z/module"
 	"z/object"
 	"z/parser"
 )
@@ -27,6 +32,11 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"-7 / 2", -3},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"0xff & 0b1010 | 1 << 4", 26},
+		{"1_000 ^ 0o7", 1007},
 	}
 
 	for _, tt := range tests {
@@ -127,7 +137,7 @@ func TestIfElseExpression(t *testing.T) {
 		{"if (1 > 2) { 10; } else { 20; }", 20},
 		{"if (1 < 2) { 10; } else { 20; }", 10},
 		{"let a = 1; if (a < 2) { a = a + 1; } else { 20; }; a", 2},
-		{`if (1 < 2) {let a = 7; }; a`, object.Error{Message: "identifier not found:a"}},
+		{`if (1 < 2) {let a = 7; }; a`, object.Error{Message: "undefined variable a"}},
 	}
 
 	for _, tt := range tests {
@@ -153,7 +163,8 @@ func TestWhileStatement(t *testing.T) {
 	}{
 		{"let a = 0; while(a<10) {a = a + 1 ;}; a;", 10},
 		{"let a = 0; while(a<10) {a = a + 1; if (a > 3) {break;}}; a;", 4},
-		{"let a = 0; while(a<10) {a = a + 1 ; let z = 9}; z;", object.Error{Message: "identifier not found:z"}},
+		{"let a = 0; while(a<10) {if (a > 3) {break;}; a = a + 1}; a;", 4},
+		{"let a = 0; while(a<10) {a = a + 1 ; let z = 9}; z;", object.Error{Message: "undefined variable z"}},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -351,7 +362,8 @@ func TestArrayIndexExpressions(t *testing.T) {
 		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
 		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i];", 2},
 		{"[1, 2, 3][3]", nil},
-		{"[1, 2, 3][-1]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-4]", nil},
 	}
 	for _, tt := range tests {
 		evaluted := testEval(tt.input)
@@ -392,11 +404,11 @@ func TestHashLiterals(t *testing.T) {
 		TRUE.HashKey():                             5,
 		FALSE.HashKey():                            6,
 	}
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong num of paris, got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of paris, got=%d", result.Len())
 	}
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, pair := range result.Pairs() {
+		expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 		if !ok {
 			t.Errorf("no pair for given key in pairs")
 		}
@@ -404,6 +416,45 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestArrayMutation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = [1, 2, 3]; a[0] = 5; a", "[5, 2, 3]"},
+		{"let a = [1, 2, 3]; a[-1] += 10; a[2]", 13},
+		{"let m = [[1], [2]]; m[1][0] = 7; m", "[[1], [7]]"},
+		{`let h = {"a": [1]}; h["a"][0]++; h`, "{a: [2]}"},
+		{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+		{"[1, 2, 3][:-1]", "[1, 2]"},
+		{"[1, 2, 3][5:9]", "[]"},
+		{`"héllo"[1:3]`, "él"},
+		{"let a = [1]; append(a, 2, 3); a", "[1, 2, 3]"},
+		{"let a = [1, 3]; insert(a, 1, 2); insert(a, -1, 4); a", "[1, 2, 3, 4]"},
+		{"let a = [1, 2, 3]; remove(a, -2) * 10 + len(a)", 22},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{"sort([1, 3, 2], fn(x, y) { y - x })", "[3, 2, 1]"},
+		{"let a = [1, 2]; for x in a { append(a, x) }; a", "[1, 2, 1, 2]"},
+		{"let a = [1, 2]; a[2] = 3", object.Error{Message: "index 2 out of range for array of length 2"}},
+		{"shift([])", object.Error{Message: "shift from an empty array"}},
+		{`sort([1, "a"], fn(x, y) { "x" })`, object.Error{Message: "sort: the comparator must return a number, got=STRING"}},
+		{"let a = [1]; a[0:1] = 2", object.Error{Message: "cannot assign to (a[0:1])"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s, expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case object.Error:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
 func TestHashIndexExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -430,6 +481,39 @@ func TestHashIndexExpression(t *testing.T) {
 	}
 }
 
+func TestHashBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"b": 1, "a": 2, 3: true}`, "{b: 1, a: 2, 3: true}"},
+		{`keys({"b": 1, "a": 2})`, "[b, a]"},
+		{`values({"b": 1, "a": 2})`, "[1, 2]"},
+		{`let h = {"a": 1}; delete(h, "a")`, true},
+		{`let h = {"a": 1}; delete(h, "b")`, false},
+		{`let h = {"a": 1, "b": 2}; delete(h, "a"); h["a"] = 3; h`, "{b: 2, a: 3}"},
+		{`has_key({"a": 0}, "a") == true`, true},
+		{`has_key({}, "a")`, false},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1, b: 3, c: 4}"},
+		{`keys(1)`, object.Error{Message: "argument 1 to `keys` must be Hash, got=INTEGER"}},
+		{`has_key({}, [])`, object.Error{Message: "unusable as hash key: ARRAY"}},
+	}
+
+	for _, tt := range tests {
+		evaluted := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBooleanObject(t, evaluted, expected)
+		case string:
+			if evaluted.Inspect() != expected {
+				t.Errorf("wrong result for %s, expected=%s, got=%s", tt.input, expected, evaluted.Inspect())
+			}
+		case object.Error:
+			testErrorObject(t, evaluted, expected)
+		}
+	}
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL, got=%T (%+v)", obj, obj)
@@ -510,6 +594,38 @@ func TestForStatement(t *testing.T) {
 	}
 }
 
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let s = 0; for (x in [1, 2, 3]) { s += x }; s", 6},
+		{`let s = 0; for (k, v in {"a": 1, "b": 20}) { s += v * len(k) }; s`, 21},
+		{`let n = 0; for (c in "日本語") { n += 1 }; n`, 3},
+		{"for (x in [1, 2, 3]) { x * 2 }", 6},
+		{"for (x in []) { x }", nil},
+		{"for (x in [1, 2]) { break }", nil},
+		{"let s = 0; for (let i = 0; i < 6; i++) { if (i % 2 == 0) { continue }; s += i }; s", 9},
+		{"let n = 0; outer: for (i in [1, 2, 3]) { for (j in [1, 2, 3]) { if (j == 2) { continue outer }; if (i == 3) { break outer }; n = n * 10 + i } }; n", 12},
+		{"let f = fn(items) { for (item in items) { if (item > 1) { return item } }; 0 }; f([1, 5, 7])", 5},
+		{"for (x in 1) { x }", object.Error{Message: "cannot iterate over INTEGER"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			objectError, ok := tt.expected.(object.Error)
+			if ok {
+				testErrorObject(t, evaluated, objectError)
+			} else {
+				testNullObject(t, evaluated)
+			}
+		}
+	}
+}
+
 func TestClassStatement(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -558,3 +674,233 @@ func TestObjectStatement(t *testing.T) {
 		}
 	}
 }
+
+func TestNullAndOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`null`, nil},
+		{`null ?? 5`, 5},
+		{`0 ?? 5`, 0},
+		{`{"a": 1}["b"] ?? 2`, 2},
+		{`[1][3] ?? 4`, 4},
+		{`let a = null; a?->b->c(1)[2]`, nil},
+		{`let a = null; a?.[0]["b"] ?? 3`, 3},
+		{`let h = {"a": [7]}; h?.["a"]?.[0]`, 7},
+		{`class A {let n = 1}; let a = new A(); a?->n + (a->m ?? 1)`, 2},
+		{`class A {}; A::missing ?? 6`, 6},
+		{`let a = 1; a->b`, object.Error{Message: "cannot get member b of INTEGER"}},
+		{`let a = 1; b ?? 1`, object.Error{Message: "undefined variable b"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case object.Error:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;\n  a + true", "2:5"},
+		{"let f = fn(x) {\n  x + y\n};\nf(1)", "2:7"},
+		{"\n-true", "2:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Position.String() != tt.expected {
+			t.Errorf("wrong error position, expected %q, got=%q", tt.expected, errObj.Position.String())
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `fn inner(x) {
+  return x + true
+}
+let outer = fn(y) {
+  inner(y)
+}
+outer(1)`
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	expected := "\tat inner (2:12)\n\tat outer (5:8)\n\tat main (7:6)\n"
+	if errObj.Stack.String() != expected {
+		t.Errorf("wrong stack trace, expected %q, got=%q", expected, errObj.Stack.String())
+	}
+}
+
+// TestConcurrentStackTraces calls functions of one program on several goroutines at once, like the http server
+// does, each call must get the stack trace of its own calls
+func TestConcurrentStackTraces(t *testing.T) {
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(`fn same(x) { x }
+fn inner(x) {
+  return x + true
+}
+fn outer(y) {
+  for (let i = 0; i < 50; i++) { same(y) }
+  inner(y)
+}`)).ParseProgram(), env)
+	call := parser.New(lexer.New("outer(1)")).ParseProgram().Statements[0]
+	expected := "\tat inner (3:12)\n\tat outer (7:8)\n\tat main (1:6)\n"
+	var wg sync.WaitGroup
+	stacks := make([]string, 8)
+	for i := range stacks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			callEnv := object.NewEnclosedEnviroment(env).WithCalls(&object.CallStack{})
+			if errObj, ok := Eval(call, callEnv).(*object.Error); ok {
+				stacks[i] = errObj.Stack.String()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, stack := range stacks {
+		if stack != expected {
+			t.Errorf("wrong stack trace, expected %q, got=%q", expected, stack)
+		}
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw 1; 2 } catch (e) { 3 }`, 3},
+		{`try { throw "boom"; } catch (e) { e->message }`, "boom"},
+		{`try { throw 5; } catch (e) { e->value }`, 5},
+		{`try { 1 + true } catch (e) { e->type }`, "RuntimeError"},
+		{`try { throw 1 } catch (e) { e->type }`, "Error"},
+		{`let a = 0; try { a = 1 } finally { a = a + 1 }; a`, 2},
+		{`let a = 0; let f = fn() { try { return 1; } finally { a = 5; } }; f() + a`, 6},
+		{`let a = 0; let f = fn() { try { throw 1; } finally { a = 5; } }; try { f() } catch { a }`, 5},
+		{`try { try { throw 1; } catch (e) { throw e; } } catch (e) { e->value }`, 1},
+		{`throw "boom";`, object.Error{Message: "boom"}},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String, got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value, got=%q, want=%q", str.Value, expected)
+			}
+		case object.Error:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+// TestStandardShadowsBuiltin checks that a function of the standard library named like a builtin,
+// file.append, is called by its qualified name and that the builtin is still there by its own
+func TestStandardShadowsBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.z")
+	src := "import \"file\"\ntypeof(file.append) + \" \" + typeof(append)"
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main, err := module.NewLoader(module.NewResolver(filepath.Join("..", "..", ".."), "")).Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluated := EvalModule(main)
+	if evaluated.Inspect() != "function builtin" {
+		t.Errorf("wrong result, expected=%q, got=%q", "function builtin", evaluated.Inspect())
+	}
+}
+
+func TestJson(t *testing.T) {
+	dir := t.TempDir()
+	rows := filepath.Join(dir, "rows.json")
+	if err := os.WriteFile(rows, []byte(`[{"n": 1}, {"n": 2}, {"n": 3}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`json_decode("{\"a\": [1, 2.5, true, null]}")`, "{a: [1, 2.5, true, null]}"},
+		{`json_decode("{\"a\": 1} 2")`, object.Error{Message: "json_decode: invalid character '2' after top-level value at 1:10"}},
+		{`json_decode("1 + 1")`, object.Error{Message: "json_decode: invalid character '+' after top-level value at 1:3"}},
+		{`json_encode({"a": "\t"}, "  ")`, "{\n  \"a\": \"\\t\"\n}"},
+		{`json_encode([fn() { 1 }])`, object.Error{Message: "json_encode: cannot encode FUNCTION"}},
+		{fmt.Sprintf("let sum = 0; for row in json_stream(`%s`) { sum += row[\"n\"] }; sum", rows), 6},
+		{`json_stream("/no/such.json")`, object.Error{Message: "json_stream: open /no/such.json: no such file or directory"}},
+		// a loop left early closes the stream, a loop over it again gets nothing
+		{fmt.Sprintf("let s = json_stream(`%s`); for row in s { break }; let n = 0; for row in s { n += 1 }; n", rows), 0},
+		{fmt.Sprintf("let s = json_stream(`%s`); outer: for i in [1, 2] { for row in s { continue outer } }; let n = 0; for row in s { n += 1 }; n", rows), 0},
+		{fmt.Sprintf("let s = json_stream(`%s`); let first = fn() { for row in s { return row } }; first(); let n = 0; for row in s { n += 1 }; n", rows), 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result for %s, expected=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		case object.Error:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestEvalModule(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"counter.z": "package counter\nexport let count = 0\nexport fn add() { count = count + 1 }\nlet hidden = 1\nexport class Base { fn get() { 40 } }",
+		"main.z":    "import \"counter\"\nclass Child extends counter.Base {}\ncounter.add()\ncounter.add()\ncounter.count + new Child()->get()",
+		"hidden.z":  "import \"counter\"\nhidden",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	main, err := module.NewLoader(module.NewResolver("", "")).Load(filepath.Join(dir, "main.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerObject(t, EvalModule(main), 42)
+
+	main, err = module.NewLoader(module.NewResolver("", "")).Load(filepath.Join(dir, "hidden.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errObj, ok := EvalModule(main).(*object.Error)
+	if !ok || errObj.Message != "undefined variable hidden" {
+		t.Errorf("a name that is not exported is seen. got=%v", errObj)
+	}
+}
@@ -0,0 +1,34 @@
+package evaluator
+
+import (
+	"z/module"
+	"z/object"
+)
+
+// EvalModule runs a program from its main module, every module runs once in an environment of its own,
+// after the modules it imports and with the names they export. An uncaught error stops the program
+func EvalModule(main *module.Module) object.Object {
+	return evalModule(main, nil)
+}
+
+func evalModule(main *module.Module, debugger *Debugger) object.Object {
+	envs := map[*module.Module]*object.Environment{}
+	var result object.Object
+	for _, m := range main.Order() {
+		env := object.NewEnvironment()
+		if debugger != nil {
+			env.Calls().Debug = debugger.before
+		}
+		for _, imported := range m.Imports {
+			for _, name := range imported.Exports() {
+				env.Import(imported.Qualified(name), envs[imported], name, imported.PackageName)
+			}
+		}
+		envs[m] = env
+		result = Eval(m.Program, env)
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
@@ -0,0 +1,137 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3 // the unchanged lines shown around a change
+
+type edit struct {
+	kind byte // ' ' kept, '-' removed, '+' added
+	line string
+}
+
+// Diff is the unified diff from a to b, empty when they are equal
+func Diff(oldName string, newName string, a string, b string) string {
+	if a == b {
+		return ""
+	}
+	edits := lineEdits(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		if edits[start].kind == ' ' {
+			start++
+			continue
+		}
+		// a hunk goes on while the next change is close enough for the contexts to touch
+		end := start
+		for i := start; i < len(edits) && i <= end+2*diffContext; i++ {
+			if edits[i].kind != ' ' {
+				end = i
+			}
+		}
+		from, to := start-diffContext, end+diffContext+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(edits) {
+			to = len(edits)
+		}
+
+		oldLine, newLine := 1, 1
+		for _, e := range edits[:from] {
+			if e.kind != '+' {
+				oldLine++
+			}
+			if e.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, e := range edits[from:to] {
+			if e.kind != '+' {
+				oldCount++
+			}
+			if e.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, e := range edits[from:to] {
+			out.WriteByte(e.kind)
+			out.WriteString(e.line)
+			out.WriteString("\n")
+		}
+		start = to
+	}
+	return out.String()
+}
+
+func hunkRange(line int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits the lines of s, a last line without a newline carries the marker diff prints for it
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += "\n\\ No newline at end of file"
+	}
+	return lines
+}
+
+// lineEdits turns a into b keeping their longest common subsequence of lines
+func lineEdits(a []string, b []string) []edit {
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
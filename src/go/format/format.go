@@ -0,0 +1,590 @@
+// Package format prints z source code in its canonical layout: two spaces of indentation, no semicolons,
+// one statement per line, at most one blank line in a row, comments kept where they were written
+package format
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+	"z/ast"
+	"z/lexer"
+	"z/parser"
+	"z/token"
+)
+
+const indentation = "  "
+
+// Source formats the source code of a file, it fails when the code does not parse
+func Source(src string, fileName string) (string, error) {
+	// package has to be the first token, the parser drops the statement so its position is taken from here
+	first := lexer.New(src).NextToken()
+
+	l := lexer.New(src)
+	l.SetFileName(fileName)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return "", errors.New(strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{src: src, lines: strings.Split(src, "\n"), comments: l.Comments, lineStart: true}
+	offset := 0
+	for _, line := range pr.lines {
+		pr.offsets = append(pr.offsets, offset)
+		offset += len(line) + 1
+	}
+	if first.Type == token.PACKAGE {
+		pr.leading(first.Pos)
+		pr.write("package " + l.PackageName)
+		pr.mark(first.Pos)
+		pr.newline()
+	}
+	pr.statements(program.Statements, token.Position{})
+	return pr.out.String(), nil
+}
+
+type printer struct {
+	out       strings.Builder
+	src       string
+	lines     []string // the source, to keep its blank lines
+	offsets   []int    // where each line starts in src
+	comments  []lexer.Comment
+	next      int // the first comment not printed yet
+	indent    int
+	lineStart bool // nothing was written on the current line
+	lastLine  int  // the last source line printed, the comments up to it are put at the end of the output line
+}
+
+func (p *printer) write(s string) {
+	if p.lineStart {
+		p.out.WriteString(strings.Repeat(indentation, p.indent))
+		p.lineStart = false
+	}
+	p.out.WriteString(s)
+}
+
+// mark records that the code at pos was printed
+func (p *printer) mark(pos token.Position) {
+	if pos.Line > p.lastLine {
+		p.lastLine = pos.Line
+	}
+}
+
+// newline ends the output line, after the comments written on the source lines printed so far
+func (p *printer) newline() {
+	for trailing := true; p.next < len(p.comments) && p.comments[p.next].Pos.Line <= p.lastLine; trailing = false {
+		if trailing {
+			p.write(" ")
+		} else {
+			p.out.WriteString("\n")
+			p.lineStart = true
+		}
+		p.write(commentText(p.comments[p.next]))
+		p.next++
+	}
+	p.out.WriteString("\n")
+	p.lineStart = true
+}
+
+// leading prints the comments written before pos on lines of their own, all of them when pos is not valid
+func (p *printer) leading(pos token.Position) {
+	for p.next < len(p.comments) && (!pos.IsValid() || before(p.comments[p.next].Pos, pos)) {
+		comment := p.comments[p.next]
+		p.blankLine(comment.Pos.Line)
+		p.write(commentText(comment))
+		p.mark(comment.Pos)
+		p.lastLine += strings.Count(comment.Text, "\n")
+		p.next++
+		p.out.WriteString("\n")
+		p.lineStart = true
+	}
+}
+
+// pending tells whether there are comments left before pos
+func (p *printer) pending(pos token.Position) bool {
+	return p.next < len(p.comments) && (!pos.IsValid() || before(p.comments[p.next].Pos, pos))
+}
+
+func commentText(comment lexer.Comment) string {
+	return strings.TrimRight(comment.Text, " \t\r")
+}
+
+func before(a token.Position, b token.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// blankLine keeps the blank line written above a source line, unless it would open a block or double a blank line
+func (p *printer) blankLine(line int) {
+	if line < 2 || line-2 >= len(p.lines) || strings.TrimSpace(p.lines[line-2]) != "" {
+		return
+	}
+	out := p.out.String()
+	if out == "" || strings.HasSuffix(out, "\n\n") || strings.HasSuffix(out, "{\n") {
+		return
+	}
+	p.out.WriteString("\n")
+	p.lineStart = true
+}
+
+// statements prints statements one per line with the comments around them, up to the end of their block
+func (p *printer) statements(stmts []ast.Statement, end token.Position) {
+	for _, stmt := range stmts {
+		p.leading(stmt.Pos())
+		p.blankLine(stmt.Pos().Line)
+		p.statement(stmt)
+		p.newline()
+	}
+	p.leading(end)
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	p.mark(stmt.Pos())
+	if exported(stmt) {
+		p.write("export ")
+	}
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let " + stmt.Name.Value + " = ")
+		// the parser names a function after the variable it is assigned to, that name is not written
+		if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && fn.Name == stmt.Name.Value {
+			p.function(fn, false)
+		} else {
+			p.expression(stmt.Value, parser.LOWEST)
+		}
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value, parser.LOWEST)
+	case *ast.ImportStatement:
+		p.write("import " + p.literal(stmt.PathPos))
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+	}
+}
+
+func exported(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Exported
+	case *ast.ExpressionStatement:
+		return stmt.Exported
+	}
+	return false
+}
+
+// block prints the statements and the defer blocks of a block in the order they were written
+func (p *printer) block(block *ast.BlockStatement) {
+	stmts := append([]ast.Statement{}, block.Statements...)
+	for _, deferBlock := range block.Defers {
+		stmts = append(stmts, &ast.ExpressionStatement{Token: deferBlock.Token, Expression: deferBlock})
+	}
+	sort.SliceStable(stmts, func(i, j int) bool { return before(stmts[i].Pos(), stmts[j].Pos()) })
+
+	p.write("{")
+	p.mark(block.Token.Pos)
+	if len(stmts) > 0 || p.pending(block.Rbrace) {
+		p.newline()
+		p.indent++
+		p.statements(stmts, block.Rbrace)
+		p.indent--
+	}
+	p.write("}")
+	p.mark(block.Rbrace)
+}
+
+// precedence is how tightly an expression binds, the way the parser reads it
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.IfExpression:
+		if isTernary(e) {
+			return parser.QUESTION
+		}
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression:
+		return parser.INDEX
+	}
+	return parser.INDEX + 1
+}
+
+func isTernary(e ast.Expression) bool {
+	ifExpression, ok := e.(*ast.IfExpression)
+	return ok && ifExpression.Token.Type == token.QUESTION
+}
+
+// expression prints an expression, in parentheses when it binds less tightly than min
+func (p *printer) expression(e ast.Expression, min int) {
+	if precedence(e) < min {
+		p.write("(")
+		p.expression(e, parser.LOWEST)
+		p.write(")")
+		return
+	}
+	p.mark(e.Pos())
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		p.write(e.Token.Literal)
+	case *ast.FloatLiteral:
+		p.write(e.Token.Literal)
+	case *ast.Boolean:
+		p.write(e.Token.Literal)
+	case *ast.NullLiteral:
+		p.write("null")
+	case *ast.StringLiteral, *ast.TemplateLiteral:
+		literal := p.literal(e.Pos())
+		p.write(literal)
+		p.lastLine += strings.Count(literal, "\n")
+	case *ast.BreakExpression:
+		p.write("break")
+		p.label(" ", e.Label, "")
+	case *ast.ContinueExpression:
+		p.write("continue")
+		p.label(" ", e.Label, "")
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		if right, ok := e.Right.(*ast.PrefixExpression); ok && right.Operator == e.Operator {
+			p.write("(") // --x would be read as a decrement
+			p.expression(e.Right, parser.LOWEST)
+			p.write(")")
+		} else {
+			p.expression(e.Right, parser.PREFIX)
+		}
+	case *ast.InfixExpression:
+		p.infix(e)
+	case *ast.CallExpression:
+		p.operand(e.Function, parser.CALL)
+		p.write("(")
+		p.list(e.Arguments)
+		p.write(")")
+	case *ast.IndexExpression:
+		p.operand(e.Left, parser.INDEX)
+		if e.Optional {
+			p.write("?.")
+		}
+		p.write("[")
+		if e.Index != nil {
+			p.expression(e.Index, parser.LOWEST)
+		}
+		if e.Slice {
+			p.write(":")
+			if e.High != nil {
+				p.expression(e.High, parser.LOWEST)
+			}
+		}
+		p.write("]")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.list(e.Elements)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.hash(e)
+	case *ast.IfExpression:
+		if isTernary(e) {
+			p.ternary(e)
+			break
+		}
+		p.write("if (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.WhileExpression:
+		p.label("", e.Label, ": ")
+		p.write("while (")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.ForExpression:
+		p.label("", e.Label, ": ")
+		p.write("for (")
+		p.statement(e.Initor)
+		p.write("; ")
+		p.expression(e.Condition, parser.LOWEST)
+		p.write("; ")
+		p.expression(e.After, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.ForInExpression:
+		p.label("", e.Label, ": ")
+		p.write("for (")
+		for i, name := range e.Names {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(name.Value)
+		}
+		p.write(" in ")
+		p.expression(e.Collection, parser.LOWEST)
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.BlockStatement:
+		if e.IsDeferBlock {
+			p.write("defer ")
+		}
+		p.block(e)
+	case *ast.FunctionLiteral:
+		p.function(e, true)
+	case *ast.ClassExpress:
+		p.class(e)
+	case *ast.InterfaceExpress:
+		p.write("interface " + e.Name.Value)
+		p.parents(e.Parents)
+		p.write(" ")
+		p.members(nil, e.Functions, e.Rbrace)
+	case *ast.ObjectExpress:
+		p.write("new " + e.Class.Value + "(")
+		p.list(e.Parameters)
+		p.write(")")
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(e.Block)
+		if e.Catch != nil {
+			p.write(" catch ")
+			if e.Parameter != nil {
+				p.write("(" + e.Parameter.Value + ") ")
+			}
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.write(" finally ")
+			p.block(e.Finally)
+		}
+	}
+}
+
+// operand prints the left side of an operator, a call or an index.
+// A call there needs no parentheses as what follows it applies to the whole call: a->b()->c,
+// a ternary expression always does as its else part would take what follows it
+func (p *printer) operand(e ast.Expression, min int) {
+	if isTernary(e) {
+		p.write("(")
+		p.expression(e, parser.LOWEST)
+		p.write(")")
+		return
+	}
+	if _, ok := e.(*ast.CallExpression); ok && min > parser.CALL {
+		min = parser.CALL
+	}
+	p.expression(e, min)
+}
+
+func (p *printer) infix(e *ast.InfixExpression) {
+	min := parser.Precedence(e.Token.Type)
+	if e.Operator == "**" { // right associative, and 2 ** -1 needs no parentheses
+		p.operand(e.Left, min+1)
+		p.write(" ** ")
+		if _, ok := e.Right.(*ast.PrefixExpression); ok {
+			min = parser.PREFIX
+		}
+		p.expression(e.Right, min)
+		return
+	}
+	p.operand(e.Left, min)
+	switch e.Operator {
+	case "->", "::", "?->":
+		p.write(e.Operator)
+		p.expression(e.Right, min+1)
+	case "++", "--":
+		// x++ is read as x ++ 1, with a 1 at the position of the operator
+		if one, ok := e.Right.(*ast.IntegerLiteral); ok && one.Token.Pos == e.Token.Pos {
+			p.write(e.Operator)
+			return
+		}
+		fallthrough
+	default:
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, min+1)
+	}
+}
+
+// label writes the label of a loop, or the one a break or a continue names, between before and after
+func (p *printer) label(before string, label *ast.Identifier, after string) {
+	if label != nil {
+		p.write(before + label.Value + after)
+	}
+}
+
+func (p *printer) ternary(e *ast.IfExpression) {
+	p.operand(e.Condition, parser.QUESTION+1)
+	p.write(" ? ")
+	// a ternary in the then part would take the : of this one
+	if len(e.Consequence.Statements) == 1 {
+		if stmt, ok := e.Consequence.Statements[0].(*ast.ExpressionStatement); ok && isTernary(stmt.Expression) {
+			p.write("(")
+			p.expression(stmt.Expression, parser.LOWEST)
+			p.write(")")
+		} else {
+			p.statement(e.Consequence.Statements[0])
+		}
+	}
+	if e.Alternative != nil && len(e.Alternative.Statements) == 1 {
+		p.write(" : ")
+		p.statement(e.Alternative.Statements[0])
+	}
+}
+
+// list prints the elements of an array or the arguments of a call, keeping the line breaks after commas
+func (p *printer) list(elements []ast.Expression) {
+	broken := false
+	for i, element := range elements {
+		if i > 0 {
+			p.write(",")
+			if start(element).Line > start(elements[i-1]).Line {
+				if !broken {
+					broken = true
+					p.indent++
+				}
+				p.newline()
+				p.leading(start(element))
+			} else {
+				p.write(" ")
+			}
+		}
+		p.expression(element, parser.LOWEST)
+	}
+	if broken {
+		p.indent--
+	}
+}
+
+// hash prints a hash on one line, or one pair per line with a trailing comma when it was written on several lines
+func (p *printer) hash(hash *ast.HashLiteral) {
+	p.write("{")
+	p.mark(hash.Token.Pos)
+	multiline := p.pending(hash.Rbrace)
+	for _, key := range hash.Keys {
+		if start(key).Line != hash.Token.Pos.Line {
+			multiline = true
+		}
+	}
+	if multiline {
+		p.indent++
+	}
+	for i, key := range hash.Keys {
+		if multiline {
+			p.newline()
+			p.leading(start(key))
+			p.blankLine(start(key).Line)
+		} else if i > 0 {
+			p.write(", ")
+		}
+		p.expression(key, parser.LOWEST)
+		p.write(": ")
+		p.expression(hash.Pairs[key], parser.LOWEST)
+		if multiline {
+			p.write(",")
+		}
+	}
+	if multiline {
+		p.newline()
+		p.leading(hash.Rbrace)
+		p.indent--
+	}
+	p.write("}")
+	p.mark(hash.Rbrace)
+}
+
+func (p *printer) function(fn *ast.FunctionLiteral, named bool) {
+	p.write("fn")
+	if named && fn.Name != "" {
+		p.write(" " + fn.Name)
+	}
+	p.write("(")
+	for i, param := range fn.Parameters {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.write(param.Value)
+		if param.Default != nil {
+			p.write(" = ")
+			p.expression(param.Default, parser.LOWEST)
+		}
+	}
+	p.write(") ")
+	p.block(fn.Body)
+}
+
+func (p *printer) class(class *ast.ClassExpress) {
+	p.write("class " + class.Name.Value)
+	p.parents(class.Parents)
+	if class.Interface != nil {
+		p.write(" implement " + class.Interface.Value)
+	}
+	p.write(" ")
+	p.members(class.LetStatements, class.Functions, class.Rbrace)
+}
+
+func (p *printer) parents(parents []*ast.Identifier) {
+	for i, parent := range parents {
+		if i == 0 {
+			p.write(" extends ")
+		} else {
+			p.write(", ")
+		}
+		p.write(parent.Value)
+	}
+}
+
+// members prints the body of a class or an interface, its fields come before its methods
+func (p *printer) members(lets []*ast.LetStatement, functions []*ast.FunctionLiteral, rbrace token.Position) {
+	stmts := []ast.Statement{}
+	for _, let := range lets {
+		stmts = append(stmts, let)
+	}
+	for _, fn := range functions {
+		stmts = append(stmts, &ast.ExpressionStatement{Token: fn.Token, Expression: fn})
+	}
+	p.write("{")
+	if len(stmts) > 0 || p.pending(rbrace) {
+		p.newline()
+		p.indent++
+		p.statements(stmts, rbrace)
+		p.indent--
+	}
+	p.write("}")
+	p.mark(rbrace)
+}
+
+// start is the position of the first token of an expression
+func start(e ast.Expression) token.Position {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return start(e.Left)
+	case *ast.CallExpression:
+		return start(e.Function)
+	case *ast.IndexExpression:
+		return start(e.Left)
+	case *ast.IfExpression:
+		if isTernary(e) {
+			return start(e.Condition)
+		}
+	}
+	return e.Pos()
+}
+
+// literal is the string literal at pos as it is written, with its escapes,
+// between double quotes unless it is a raw string that means something else between them
+func (p *printer) literal(pos token.Position) string {
+	offset := p.offsets[pos.Line-1]
+	for column := 1; column < pos.Column; column++ {
+		_, width := utf8.DecodeRuneInString(p.src[offset:])
+		offset += width
+	}
+	literal := lexer.Quoted(p.src[offset:])
+	if raw := strings.Trim(literal, "`"); strings.HasPrefix(literal, "`") && !strings.ContainsAny(raw, `"\$`) {
+		return `"` + raw + `"`
+	}
+	return literal
+}
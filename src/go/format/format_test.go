@@ -0,0 +1,165 @@
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"layout",
+			"let a = 1;\nlet b = fn(x, y = 2){\n\t\treturn x+y;\n}\n\n\n\nputs( b(a) )",
+			"let a = 1\nlet b = fn(x, y = 2) {\n  return x + y\n}\n\nputs(b(a))\n",
+		},
+		{
+			"comments",
+			"// add\n/* two\n   numbers */\nlet a = 1 // one\nfn f() { // f\n  a // a\n  // end\n}\n\n// last\n",
+			"// add\n/* two\n   numbers */\nlet a = 1 // one\nfn f() { // f\n  a // a\n  // end\n}\n\n// last\n",
+		},
+		{
+			"package",
+			"// the package\npackage geometry\nfn area(w, h) { w * h }",
+			"// the package\npackage geometry\nfn area(w, h) {\n  w * h\n}\n",
+		},
+		{
+			"precedence",
+			"(1 + 2) * 3\n1 + (2 * 3)\n1 - (2 - 3)\n(1 - 2) - 3\n-(1 + 2)\n-(-1)\n!(a && b) || c\nx = (a ? 1 : 2) + 3",
+			"(1 + 2) * 3\n1 + 2 * 3\n1 - (2 - 3)\n1 - 2 - 3\n-(1 + 2)\n-(-1)\n!(a && b) || c\nx = (a ? 1 : 2) + 3\n",
+		},
+		{
+			"ternary",
+			"let b = a?12:34\ne = c > d ? c : d",
+			"let b = a ? 12 : 34\ne = c > d ? c : d\n",
+		},
+		{
+			"increments and assignments",
+			"for(let i=0;i<10;i++){ i += 2 }\nh[\"a\"]=1\nh[\"a\"]",
+			"for (let i = 0; i < 10; i++) {\n  i += 2\n}\nh[\"a\"] = 1\nh[\"a\"]\n",
+		},
+		{
+			"hashes",
+			"let a = {\"x\":1,\"y\":2}\nlet b = {\n  \"x\": 1, // x\n\n  \"y\": {\"z\": [1,2]}\n}\nlet c = {}",
+			"let a = {\"x\": 1, \"y\": 2}\nlet b = {\n  \"x\": 1, // x\n\n  \"y\": {\"z\": [1, 2]},\n}\nlet c = {}\n",
+		},
+		{
+			"lists keep their line breaks",
+			"puts(1,\n2, 3,\n    4)",
+			"puts(1,\n  2, 3,\n  4)\n",
+		},
+		{
+			"strings",
+			"let a = `say \"hi\"`\nlet b = `plain`\nlet c = \"two\nlines\" // c",
+			"let a = `say \"hi\"`\nlet b = \"plain\"\nlet c = \"two\nlines\" // c\n",
+		},
+		{
+			"defer keeps its place",
+			"fn f() {\n  puts(1)\n  defer { puts(3) }\n  puts(2)\n}",
+			"fn f() {\n  puts(1)\n  defer {\n    puts(3)\n  }\n  puts(2)\n}\n",
+		},
+		{
+			"classes",
+			"class Dog extends Animal,Pet implement Named{\nlet name=\"rex\"\n\nfn bark(){\nreturn this->name+\" barks\"\n}\n}\ninterface Named { fn name() {}\nfn age() {} }\nlet d = new Dog()\nd->bark()->len\nDog::name",
+			"class Dog extends Animal, Pet implement Named {\n  let name = \"rex\"\n\n  fn bark() {\n    return this->name + \" barks\"\n  }\n}\ninterface Named {\n  fn name() {}\n  fn age() {}\n}\nlet d = new Dog()\nd->bark()->len\nDog::name\n",
+		},
+		{
+			"try",
+			"try { check(3) } catch(e) { -1 } finally { puts(e) }\nthrow \"boom\"",
+			"try {\n  check(3)\n} catch (e) {\n  -1\n} finally {\n  puts(e)\n}\nthrow \"boom\"\n",
+		},
+		{
+			"imports",
+			"import \"../standard/string\";\nif (a) { 1 } else { 2 }\nwhile (a) { break }",
+			"import \"../standard/string\"\nif (a) {\n  1\n} else {\n  2\n}\nwhile (a) {\n  break\n}\n",
+		},
+		{
+			"templates",
+			"puts(\"${a+b}\\t\\$ ${ {\"k\": `}`}[\"k\"] }\\n\")",
+			"puts(\"${a+b}\\t\\$ ${ {\"k\": `}`}[\"k\"] }\\n\")\n",
+		},
+		{
+			"unicode",
+			"let 名字 = \"\\u{4e2d}文\"\nputs(`\\u{4e2d}`)",
+			"let 名字 = \"\\u{4e2d}文\"\nputs(`\\u{4e2d}`)\n",
+		},
+		{
+			"numbers",
+			"let a=(2**3)**2+(-2)**2+2**-1\nlet b=0xff&1_000|a%3<<1",
+			"let a = (2 ** 3) ** 2 + (-2) ** 2 + 2 ** -1\nlet b = 0xff & 1_000 | a % 3 << 1\n",
+		},
+		{
+			"loops",
+			"outer:for k,v in h {\nfor (x in [k,v]) { if (x) {continue outer}\nbreak }\n}",
+			"outer: for (k, v in h) {\n  for (x in [k, v]) {\n    if (x) {\n      continue outer\n    }\n    break\n  }\n}\n",
+		},
+		{
+			"slices",
+			"a[0]=b[1:]\nc[i]+=d[:-1]\ne[:]",
+			"a[0] = b[1:]\nc[i] += d[:-1]\ne[:]\n",
+		},
+		{
+			"null",
+			"let a=null??b?->c?.[0]\nlet d=(a??b)*2",
+			"let a = null ?? b?->c?.[0]\nlet d = (a ?? b) * 2\n",
+		},
+		{
+			"exports",
+			"export let a=1\nexport fn f(x) { x }\nexport class A {}",
+			"export let a = 1\nexport fn f(x) {\n  x\n}\nexport class A {}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source(tt.input, "test.z")
+		if err != nil {
+			t.Errorf("%s: format failed: %s", tt.name, err)
+			continue
+		}
+		if formatted != tt.expected {
+			t.Errorf("%s: wrong output.\nexpected=%q\ngot=     %q", tt.name, tt.expected, formatted)
+			continue
+		}
+		again, err := Source(formatted, "test.z")
+		if err != nil || again != formatted {
+			t.Errorf("%s: formatting the output again changed it. got=%q, err=%v", tt.name, again, err)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("let a = 1\nlet = 2\n", "broken.z")
+	if err == nil || !strings.HasPrefix(err.Error(), "broken.z:2:") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n"
+	b := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk"
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -8,3 +8,4 @@
+ h
+ i
+ j
++k
+\ No newline at end of file
+`
+	if diff := Diff("old", "new", a, b); diff != expected {
+		t.Errorf("wrong diff.\nexpected=%q\ngot=     %q", expected, diff)
+	}
+	if diff := Diff("old", "new", a, a); diff != "" {
+		t.Errorf("equal texts have a diff. got=%q", diff)
+	}
+}
@@ -1,23 +1,41 @@
 package lexer
 
 import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
 	"z/token"
 )
 
-var preToken token.Token = token.Token{Literal: ""}
+// Comment is a // or /* */ comment, kept for the tools that print the source again
+type Comment struct {
+	Pos  token.Position
+	Text string
+}
+
+// Error is a token that could not be read, like a bad escape in a string, the parser reports it
+type Error struct {
+	Pos token.Position
+	Msg string
+}
 
 type Lexer struct {
-	input       string // 输入的字符串
-	position    int    // 已经读取的字符的位置
-	readPostion int    // 准备读取的字符的位置
-	ch          byte   // 已经读取的字符
-	FileName    string // 源码文件
-	PackageName string // 包名
+	input       string      // 输入的字符串
+	position    int         // 已经读取的字符的位置
+	readPostion int         // 准备读取的字符的位置
+	ch          rune        // 已经读取的字符，源码是 UTF-8
+	FileName    string      // 源码文件
+	PackageName string      // 包名
+	line        int         // 已经读取的字符所在行
+	column      int         // 已经读取的字符所在列
+	preToken    token.Token // 上一个词法单元，换行后是否是语句的结束取决于它
+	Comments    []Comment
+	Errors      []Error
 }
 
 func New(input string) *Lexer {
 	input = input + "\n"
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -30,20 +48,37 @@ func (l *Lexer) SetPackageName(packageName string) {
 	l.PackageName = packageName
 }
 
+// Line is the text of a line of the source, lines start from 1
+func (l *Lexer) Line(n int) string {
+	lines := strings.Split(l.input, "\n")
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return strings.TrimSuffix(lines[n-1], "\r")
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+	l.position = l.readPostion
 	if l.readPostion >= len(l.input) {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPostion]
+		l.readPostion += 1
+		return
 	}
-	l.position = l.readPostion
-	l.readPostion += 1
+	ch, width := utf8.DecodeRuneInString(l.input[l.readPostion:])
+	l.ch = ch
+	l.readPostion += width
 }
 
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhiteSpace()
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
@@ -91,23 +126,33 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.MINUS, l.ch)
 		}
 	case '*':
-		if l.peekChar() == '=' {
+		switch l.peekChar() {
+		case '=':
 			tok = l.newTokenWithTwoChar(token.ASTERISKASSIGN)
-		} else {
+		case '*':
+			tok = l.newTokenWithTwoChar(token.POWER)
+		default:
 			tok = newToken(token.ASTERISK, l.ch)
 		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
 	case '/':
 		switch l.peekChar() {
 		case '/':
+			start := l.position
 			l.readChar()
 			for { // single line anntation
 				l.readChar()
 				ch := l.ch
-				if ch == 10 {
+				if ch == 10 || ch == 0 {
+					l.Comments = append(l.Comments, Comment{Pos: pos, Text: l.input[start:l.position]})
 					return l.NextToken()
 				}
 			}
 		case '*':
+			start := l.position
 			l.readChar()
 			for {
 				l.readChar()
@@ -115,9 +160,11 @@ func (l *Lexer) NextToken() token.Token {
 				if ch == '*' && l.peekChar() == '/' {
 					l.readChar() // use readChar twice lose */ char
 					l.readChar()
+					l.Comments = append(l.Comments, Comment{Pos: pos, Text: l.input[start:l.position]})
 					return l.NextToken()
 				}
 				if ch == 0 { // find */ until the last of file
+					l.Comments = append(l.Comments, Comment{Pos: pos, Text: l.input[start:l.position]})
 					l.readChar()
 					return l.NextToken()
 				}
@@ -128,15 +175,21 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.SLASH, l.ch)
 		}
 	case '<':
-		if l.peekChar() == '=' {
+		switch l.peekChar() {
+		case '=':
 			tok = l.newTokenWithTwoChar(token.LE)
-		} else {
+		case '<':
+			tok = l.newTokenWithTwoChar(token.SHIFT_LEFT)
+		default:
 			tok = newToken(token.LT, l.ch)
 		}
 	case '>':
-		if l.peekChar() == '=' {
+		switch l.peekChar() {
+		case '=':
 			tok = l.newTokenWithTwoChar(token.GE)
-		} else {
+		case '>':
+			tok = l.newTokenWithTwoChar(token.SHIFT_RIGHT)
+		default:
 			tok = newToken(token.GT, l.ch)
 		}
 	case '[':
@@ -153,12 +206,12 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Literal = ""
 		tok.Type = token.EOF
 	case '"':
-		fallthrough
+		tok.Type, tok.Literal = l.readString(pos)
 	case '`':
 		tok.Type = token.STRING
-		tok.Literal = l.readString(l.ch)
+		tok.Literal = l.readRawString()
 	case '\n': // replace \n with ;
-		if preToken.Literal != ";" && preToken.Literal != "{" && preToken.Literal != "," && preToken.Literal != "" {
+		if l.preToken.Literal != ";" && l.preToken.Literal != "{" && l.preToken.Literal != "," && l.preToken.Literal != "" {
 			tok.Type = token.SEMICOLON
 			tok.Literal = ";"
 		} else {
@@ -168,18 +221,32 @@ func (l *Lexer) NextToken() token.Token {
 	case '|':
 		if l.peekChar() == '|' {
 			tok = l.newTokenWithTwoChar(token.OR)
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
 		}
 	case '&':
 		if l.peekChar() == '&' {
 			tok = l.newTokenWithTwoChar(token.AND)
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
 		}
 	case '?':
-		tok = newToken(token.QUESTION, l.ch)
+		switch {
+		case l.peekChar() == '?':
+			tok = l.newTokenWithTwoChar(token.NULLISH)
+		case strings.HasPrefix(l.input[l.position:], token.OPTIONAL_GET):
+			tok = l.newTokenWithThreeChar(token.OPTIONAL_GET)
+		case strings.HasPrefix(l.input[l.position:], token.OPTIONAL_INDEX):
+			tok = l.newTokenWithThreeChar(token.OPTIONAL_INDEX)
+		default:
+			tok = newToken(token.QUESTION, l.ch)
+		}
 	default:
 		if isLetter(l.ch) {
 			tok.Literal = l.readIndentifier()
 			tok.Type = token.LookIndent(tok.Literal)
-			preToken = tok
+			tok.Pos = pos
+			l.preToken = tok
 			return tok
 		} else if isDigit(l.ch) {
 			readNumber, isFloat := l.readNumber()
@@ -189,6 +256,7 @@ func (l *Lexer) NextToken() token.Token {
 			} else {
 				tok.Type = token.INT
 			}
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILIEGAL, l.ch)
@@ -196,12 +264,18 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
-	preToken = tok
+	tok.Pos = pos
+	l.preToken = tok
 	return tok
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '.'
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{FileName: l.FileName, Line: l.line, Column: l.column}
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '.' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
 func (l *Lexer) readIndentifier() string {
@@ -214,7 +288,7 @@ func (l *Lexer) readIndentifier() string {
 	return l.input[position:l.position]
 }
 
-func newToken(TokenType token.TokenType, ch byte) token.Token {
+func newToken(TokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: TokenType, Literal: string(ch)}
 }
 
@@ -224,14 +298,24 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
-func (l *Lexer) isWhiteSpace(ch byte) bool {
+func (l *Lexer) isWhiteSpace(ch rune) bool {
 	return ch == ' ' || ch == '\t' || ch == '\r'
 }
 
+// readNumber reads a decimal number, with a fraction for a float, or a 0x, 0o or 0b integer,
+// _ may separate the digits of any of them
 func (l *Lexer) readNumber() (string, bool) {
 	position := l.position
 	isFloat := false
-	for isDigit(l.ch) {
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		l.readChar()
+		l.readChar()
+		for isHexDigit(l.ch) || l.ch == '_' {
+			l.readChar()
+		}
+		return l.input[position:l.position], false
+	}
+	for isDigit(l.ch) || l.ch == '_' {
 		if l.ch == '.' {
 			isFloat = true
 		}
@@ -240,27 +324,27 @@ func (l *Lexer) readNumber() (string, bool) {
 	return l.input[position:l.position], isFloat
 }
 
-func (l *Lexer) readString(stringStart byte) string {
-	position := l.position + 1
-	for {
-		l.readChar()
-		if l.ch == stringStart || l.ch == 0 {
-			break
-		}
-	}
-	return l.input[position:l.position]
+func isHexDigit(ch rune) bool {
+	return '0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return ('0' <= ch && ch <= '9') || ch == '.'
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPostion > len(l.input) {
+func (l *Lexer) peekChar() rune {
+	if l.readPostion >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPostion]
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPostion:])
+	return ch
+}
+
+func (l *Lexer) newTokenWithThreeChar(tokenType token.TokenType) token.Token {
+	start := l.position
+	l.readChar()
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: l.input[start : l.position+1]}
 }
 
 func (l *Lexer) newTokenWithTwoChar(tokenType token.TokenType) token.Token {
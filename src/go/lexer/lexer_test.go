@@ -3,6 +3,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"z/token"
@@ -273,3 +274,245 @@ defer {}
 		}
 	}
 }
+
+func TestTokenPosition(t *testing.T) {
+	input := `let five = 5
+  five +
+	"ten"`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"five", 1, 5},
+		{"=", 1, 10},
+		{"5", 1, 12},
+		{";", 1, 13},
+		{"five", 2, 3},
+		{"+", 2, 8},
+		{";", 2, 9},
+		{"ten", 3, 2},
+	}
+	l := New(input)
+	l.SetFileName("main.z")
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+		if tok.Pos.FileName != "main.z" {
+			t.Fatalf("tests[%d] - file name wrong. got=%q", i, tok.Pos.FileName)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// add two numbers
+let a = 1 // one
+/* two
+lines */ let b = 2`
+
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.SLASH || tok.Type == token.ASTERISK {
+			t.Fatalf("comment lexed as a token at %s", tok.Pos)
+		}
+	}
+
+	tests := []struct {
+		expectedText   string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"// add two numbers", 1, 1},
+		{"// one", 2, 11},
+		{"/* two\nlines */", 3, 1},
+	}
+	if len(l.Comments) != len(tests) {
+		t.Fatalf("wrong number of comments. got=%+v", l.Comments)
+	}
+	for i, tt := range tests {
+		comment := l.Comments[i]
+		if comment.Text != tt.expectedText {
+			t.Errorf("tests[%d] - text wrong. expected=%q, got=%q", i, tt.expectedText, comment.Text)
+		}
+		if comment.Pos.Line != tt.expectedLine || comment.Pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, comment.Pos.Line, comment.Pos.Column)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let 名字 = \"中文 text\" + 名字\n`\\u{4e2d}` \"\\u{4e2d}\\u{1F600}!\" \"\\u{zz}\\u4e2d\""
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENT, "名字", 5},
+		{token.ASSIGN, "=", 8},
+		{token.STRING, "中文 text", 10},
+		{token.PLUS, "+", 20},
+		{token.IDENT, "名字", 22},
+		{token.SEMICOLON, ";", 24},
+		{token.STRING, "\\u{4e2d}", 1},
+		{token.STRING, "中😀!", 12},
+		{token.STRING, "\\u{zz}\\u4e2d", 33},
+		{token.SEMICOLON, ";", 47},
+		{token.EOF, "", 1},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+
+	expected := []string{"2:34: bad unicode escape \\u{zz}, want \\u{hex code point}", "2:40: bad unicode escape \\u, want \\u{hex code point}"}
+	if len(l.Errors) != len(expected) {
+		t.Fatalf("wrong number of errors. got=%+v", l.Errors)
+	}
+	for i, err := range l.Errors {
+		if got := err.Pos.String() + ": " + err.Msg; got != expected[i] {
+			t.Errorf("errors[%d] wrong. expected=%q, got=%q", i, expected[i], got)
+		}
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	input := "\"a\\tb\\n\\\"c\\\" \\\\ \\$\" \"two\nlines\" \"${name} is ${ {\"k\": \"}\"}[\"k\"] }\\n\" \"\\q\""
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\tb\n\"c\" \\ $"},
+		{token.STRING, "two\nlines"},
+		{token.TEMPLATE, "${name} is ${ {\"k\": \"}\"}[\"k\"] }\\n"},
+		{token.STRING, "\\q"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+	if len(l.Errors) != 1 || l.Errors[0].Pos.String() != "2:45" || !strings.HasPrefix(l.Errors[0].Msg, "unknown escape \\q") {
+		t.Errorf("wrong errors. got=%+v", l.Errors)
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	l := New("puts(\"a\\t${x + 1}${ {\"k\": \"}\"}[\"k\"] }\\n\")")
+	l.NextToken()
+	l.NextToken()
+	tok := l.NextToken()
+	parts, errs := SplitTemplate(tok)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %+v", errs)
+	}
+	expected := []TemplatePart{
+		{Text: "a\t", Pos: token.Position{Line: 1, Column: 7}},
+		{Text: "x + 1", IsExpression: true, Pos: token.Position{Line: 1, Column: 12}},
+		{Text: " {\"k\": \"}\"}[\"k\"] ", IsExpression: true, Pos: token.Position{Line: 1, Column: 20}},
+		{Text: "\n", Pos: token.Position{Line: 1, Column: 38}},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("wrong number of parts. got=%+v", parts)
+	}
+	for i, part := range parts {
+		if part != expected[i] {
+			t.Errorf("parts[%d] wrong. expected=%+v, got=%+v", i, expected[i], part)
+		}
+	}
+}
+
+func TestOptionalOperators(t *testing.T) {
+	input := `null ?? a?->b?.[0] ? 1 : 2`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.NULL, "null"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "a"},
+		{token.OPTIONAL_GET, "?->"},
+		{token.IDENT, "b"},
+		{token.OPTIONAL_INDEX, "?.["},
+		{token.INT, "0"},
+		{token.RBRACKET, "]"},
+		{token.QUESTION, "?"},
+		{token.INT, "1"},
+		{token.COLON, ":"},
+		{token.INT, "2"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `0x1F 0o17 0b101 1_000_000 2.5 7 % 2 2 ** 3 a & b | c ^ d << 1 >> 2`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0x1F"},
+		{token.INT, "0o17"},
+		{token.INT, "0b101"},
+		{token.INT, "1_000_000"},
+		{token.FLOAT, "2.5"},
+		{token.INT, "7"},
+		{token.PERCENT, "%"},
+		{token.INT, "2"},
+		{token.INT, "2"},
+		{token.POWER, "**"},
+		{token.INT, "3"},
+		{token.IDENT, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENT, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENT, "c"},
+		{token.BIT_XOR, "^"},
+		{token.IDENT, "d"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INT, "1"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INT, "2"},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
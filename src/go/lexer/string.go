@@ -0,0 +1,230 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"z/token"
+)
+
+// TemplatePart is a piece of a TEMPLATE token, either text with its escapes decoded
+// or the source of the expression between ${ and }
+type TemplatePart struct {
+	Text         string
+	IsExpression bool
+	Pos          token.Position // where the text or the expression source starts
+}
+
+// readString reads a string between double quotes with its escapes decoded,
+// a string holding ${...} is a TEMPLATE of its source, the parser splits it with SplitTemplate
+func (l *Lexer) readString(pos token.Position) (token.TokenType, string) {
+	start := l.readPostion
+	length, template := stringEnd(l.input[start:])
+	for l.position < start+length && l.ch != 0 {
+		l.readChar()
+	}
+	source := l.input[start:l.position]
+	if l.ch != '"' {
+		l.Errors = append(l.Errors, Error{Pos: pos, Msg: "string literal not terminated"})
+		template = false
+	}
+	if template {
+		return token.TEMPLATE, source
+	}
+	value, errs := unescape(source, advance(pos, `"`))
+	l.Errors = append(l.Errors, errs...)
+	return token.STRING, value
+}
+
+// readRawString reads a string between backquotes, as it is written
+func (l *Lexer) readRawString() string {
+	position := l.position + 1
+	for {
+		l.readChar()
+		if l.ch == '`' || l.ch == 0 {
+			break
+		}
+	}
+	return l.input[position:l.position]
+}
+
+// Sub is a lexer of a piece of the source of l that starts at pos, like the expression of a ${...}
+func (l *Lexer) Sub(input string, pos token.Position) *Lexer {
+	sub := &Lexer{input: input + "\n", line: pos.Line, column: pos.Column - 1, FileName: l.FileName, PackageName: l.PackageName}
+	sub.readChar()
+	return sub
+}
+
+// SplitTemplate splits a TEMPLATE token into its text and its expressions, in the order they are written
+func SplitTemplate(tok token.Token) ([]TemplatePart, []Error) {
+	source := tok.Literal
+	start := advance(tok.Pos, `"`)
+	parts := []TemplatePart{}
+	errs := []Error{}
+	text := 0
+	for i := 0; i < len(source); i++ {
+		switch {
+		case source[i] == '\\':
+			i++
+		case strings.HasPrefix(source[i:], "${"):
+			if text < i {
+				value, textErrs := unescape(source[text:i], advance(start, source[:text]))
+				parts = append(parts, TemplatePart{Text: value, Pos: advance(start, source[:text])})
+				errs = append(errs, textErrs...)
+			}
+			expression := i + 2
+			end := expression + interpolationEnd(source[expression:])
+			parts = append(parts, TemplatePart{Text: source[expression:end], IsExpression: true, Pos: advance(start, source[:expression])})
+			if end == len(source) {
+				errs = append(errs, Error{Pos: advance(start, source[:i]), Msg: "${ is not closed by }"})
+			}
+			i = end
+			text = end + 1
+		}
+	}
+	if text < len(source) {
+		value, textErrs := unescape(source[text:], advance(start, source[:text]))
+		parts = append(parts, TemplatePart{Text: value, Pos: advance(start, source[:text])})
+		errs = append(errs, textErrs...)
+	}
+	return parts, errs
+}
+
+// Quoted is the string literal s starts with, with its quotes, as it is written
+func Quoted(s string) string {
+	if strings.HasPrefix(s, "`") {
+		if end := strings.IndexByte(s[1:], '`'); end >= 0 {
+			return s[:end+2]
+		}
+		return s
+	}
+	if !strings.HasPrefix(s, `"`) {
+		return ""
+	}
+	end, _ := stringEnd(s[1:])
+	if end+1 < len(s) {
+		return s[:end+2]
+	}
+	return s
+}
+
+// stringEnd is the length of the double quoted string s starts with, up to its closing quote,
+// and whether it holds a ${...}
+func stringEnd(s string) (int, bool) {
+	template := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			return i, template
+		case strings.HasPrefix(s[i:], "${"):
+			template = true
+			i += 2 + interpolationEnd(s[i+2:])
+		}
+	}
+	return len(s), template
+}
+
+// interpolationEnd is the length of the expression s starts with, up to the } closing its ${,
+// the braces and the strings of the expression are skipped
+func interpolationEnd(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '"':
+			end, _ := stringEnd(s[i+1:])
+			i += end + 1
+		case '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return len(s)
+			}
+			i += end + 1
+		}
+	}
+	return len(s)
+}
+
+// unescape decodes the escapes of the text of a double quoted string, the text starts at pos
+func unescape(s string, pos token.Position) (string, []Error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var out strings.Builder
+	errs := []Error{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out.WriteByte(s[i])
+			continue
+		}
+		value, length, ok := escape(s[i+1:])
+		if !ok {
+			errs = append(errs, Error{Pos: advance(pos, s[:i]), Msg: escapeError(s[i : i+1+length])})
+		}
+		out.WriteString(value)
+		i += length
+	}
+	return out.String(), errs
+}
+
+var escapes = map[byte]string{'n': "\n", 't': "\t", 'r': "\r", '\\': `\`, '"': `"`, '$': "$", '0': "\x00"}
+
+// escape decodes the escape s starts with, just after its backslash, it returns the bytes of s it takes,
+// a bad escape is kept as it is written
+func escape(s string) (string, int, bool) {
+	if s == "" {
+		return `\`, 0, false
+	}
+	if value, ok := escapes[s[0]]; ok {
+		return value, 1, true
+	}
+	if s[0] != 'u' {
+		_, width := utf8.DecodeRuneInString(s)
+		return `\` + s[:width], width, false
+	}
+	if !strings.HasPrefix(s, "u{") {
+		return `\u`, 1, false
+	}
+	end := strings.IndexAny(s, "}\"\n")
+	if end < 0 || s[end] != '}' {
+		if end < 0 {
+			end = len(s)
+		}
+		return `\` + s[:end], end, false
+	}
+	code, err := strconv.ParseUint(s[2:end], 16, 32)
+	if err != nil || end > 2+6 || !utf8.ValidRune(rune(code)) {
+		return `\` + s[:end+1], end + 1, false
+	}
+	return string(rune(code)), end + 1, true
+}
+
+// escapeError is the message of a bad escape, text is the escape as it is written
+func escapeError(text string) string {
+	if strings.HasPrefix(text, `\u`) {
+		return fmt.Sprintf("bad unicode escape %s, want \\u{hex code point}", text)
+	}
+	return fmt.Sprintf("unknown escape %s, want one of \\n \\t \\r \\0 \\\\ \\\" \\$ \\u{...}", text)
+}
+
+// advance is the position after s when s starts at pos
+func advance(pos token.Position, s string) token.Position {
+	for _, ch := range s {
+		if ch == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
@@ -0,0 +1,432 @@
+package lsp
+
+import (
+	"fmt"
+	"strings"
+	"z/ast"
+	"z/module"
+	"z/object"
+	"z/symbols"
+	"z/token"
+)
+
+// signature describes the symbol for hovers and completions
+func signature(s *symbols.Symbol) string {
+	switch {
+	case s.Kind == symbols.Builtin:
+		return "builtin " + s.Name
+	case s.Fn != nil:
+		params := []string{}
+		for _, param := range s.Fn.Parameters {
+			if param.Default != nil {
+				params = append(params, param.Value+" = "+param.Default.String())
+			} else {
+				params = append(params, param.Value)
+			}
+		}
+		return fmt.Sprintf("fn %s(%s)", s.Name, strings.Join(params, ", "))
+	case s.Kind == symbols.Class:
+		signature := "class " + s.Name
+		if s.Class != nil && len(s.Class.Parents) > 0 {
+			parents := []string{}
+			for _, parent := range s.Class.Parents {
+				parents = append(parents, parent.Value)
+			}
+			signature += " extends " + strings.Join(parents, ", ")
+		}
+		return signature
+	case s.Kind == symbols.Interface:
+		return "interface " + s.Name
+	case s.NewOf != "":
+		return fmt.Sprintf("let %s = new %s", s.Name, s.NewOf)
+	default:
+		return "let " + s.Name
+	}
+}
+
+// builtinNames are the builtins of both engines
+func builtinNames() []string {
+	names := []string{}
+	for _, builtin := range object.Builtins {
+		names = append(names, builtin.Name)
+	}
+	return names
+}
+
+func member(class *ast.ClassExpress, name string, sc *symbols.Scope) *symbols.Symbol {
+	for _, sym := range symbols.Members(class, sc) {
+		if sym.Name == name {
+			return sym
+		}
+	}
+	return nil
+}
+
+// classOf is the class of the value of an expression when it is known
+func classOf(e ast.Expression, sc *symbols.Scope) *ast.ClassExpress {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if e.Value == "this" {
+			return sc.EnclosingClass()
+		}
+		sym := sc.Lookup(e.Value)
+		if sym == nil {
+			return nil
+		}
+		if sym.Class != nil {
+			return sym.Class
+		}
+		if sym.NewOf != "" {
+			if class := sc.Lookup(sym.NewOf); class != nil {
+				return class.Class
+			}
+		}
+	case *ast.ObjectExpress:
+		if e.Class != nil {
+			if class := sc.Lookup(e.Class.Value); class != nil {
+				return class.Class
+			}
+		}
+	}
+	return nil
+}
+
+// workspace loads the files a document imports, from the open documents or from the disk
+type workspace struct {
+	resolver *module.Resolver
+	open     map[string]string        // the text of the open documents by path
+	files    map[string]*symbols.File // parsed files by path
+}
+
+func newWorkspace(resolver *module.Resolver) *workspace {
+	return &workspace{resolver: resolver, open: map[string]string{}, files: map[string]*symbols.File{}}
+}
+
+func (w *workspace) file(path string) (*symbols.File, error) {
+	if f, ok := w.files[path]; ok {
+		return f, nil
+	}
+	text, ok := w.open[path]
+	if !ok {
+		content, err := w.resolver.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(content)
+	}
+	f := symbols.ParseFile(path, text)
+	w.files[path] = f
+	return f, nil
+}
+
+// forget drops a parsed file after its text changed
+func (w *workspace) forget(path string) {
+	delete(w.files, path)
+}
+
+// diagnostic is a problem found in a document
+type diagnostic struct {
+	pos     token.Position
+	message string
+}
+
+// analysis is a document with the names it can see
+type analysis struct {
+	file        *symbols.File
+	globals     *symbols.Scope // the builtins, the prelude and the imported files
+	diagnostics []diagnostic
+}
+
+func (w *workspace) analyze(path string) (*analysis, error) {
+	f, err := w.file(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &analysis{file: f, globals: symbols.NewScope(nil)}
+	for _, name := range builtinNames() {
+		a.globals.Define(&symbols.Symbol{Name: name, Kind: symbols.Builtin})
+	}
+	for _, parseError := range f.Errors {
+		a.diagnostics = append(a.diagnostics, diagnostic{parseError.Pos, parseError.Msg})
+	}
+
+	// a module sees the exports of the prelude and of the files it imports, not those of the files they import
+	if prelude, err := w.file(w.resolver.Prelude()); err == nil && prelude.Path != path {
+		a.export(prelude)
+	}
+	for _, imp := range f.Imports {
+		importPath := w.resolver.Resolve(path, imp.Path)
+		imported, err := w.file(importPath)
+		if err != nil {
+			a.diagnostics = append(a.diagnostics, diagnostic{imp.PathPos, "import file not exists: " + importPath})
+			continue
+		}
+		a.export(imported)
+	}
+	return a, nil
+}
+
+// export defines the names an imported file exports in the globals, prefixed by its package
+func (a *analysis) export(f *symbols.File) {
+	for _, name := range module.Exports(f.Program) {
+		sym, ok := f.Top[name]
+		if !ok {
+			continue
+		}
+		exported := *sym
+		if f.PackageName != "" {
+			exported.Name = f.PackageName + "." + sym.Name
+		}
+		a.globals.Define(&exported)
+	}
+}
+
+// fileScope holds the top level names of the document itself
+func (a *analysis) fileScope() *symbols.Scope {
+	sc := symbols.NewScope(a.globals)
+	for _, sym := range a.file.Top {
+		sc.Define(sym)
+	}
+	return sc
+}
+
+// resolver walks a document with the scopes of its names, looking for what is at the cursor
+type resolver struct {
+	cursor token.Position
+
+	target       *symbols.Symbol // the declaration of the name at the cursor
+	targetFound  bool
+	cursorScope  *symbols.Scope // the innermost scope of the last node before the cursor
+	cursorMember ast.Expression
+}
+
+func (a *analysis) resolve(cursor token.Position) *resolver {
+	r := &resolver{cursor: cursor}
+	sc := a.fileScope()
+	r.cursorScope = sc
+	r.statements(a.file.Program.Statements, sc)
+	return r
+}
+
+func before(a token.Position, b token.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column <= b.Column)
+}
+
+// covers tells whether the cursor is on a name of length n starting at pos
+func (r *resolver) covers(pos token.Position, n int) bool {
+	return pos.Line == r.cursor.Line && pos.Column <= r.cursor.Column && r.cursor.Column <= pos.Column+n
+}
+
+func (r *resolver) mark(pos token.Position, sc *symbols.Scope) {
+	if pos.IsValid() && before(pos, r.cursor) {
+		r.cursorScope = sc
+	}
+}
+
+func (r *resolver) found(sym *symbols.Symbol) {
+	if !r.targetFound {
+		r.target = sym
+		r.targetFound = true
+	}
+}
+
+func (r *resolver) identifier(ident *ast.Identifier, sc *symbols.Scope) {
+	if ident == nil {
+		return
+	}
+	r.mark(ident.Pos(), sc)
+	if r.covers(ident.Pos(), len(ident.Value)) {
+		r.found(sc.Lookup(ident.Value))
+	}
+}
+
+func (r *resolver) statements(stmts []ast.Statement, sc *symbols.Scope) {
+	for _, stmt := range stmts {
+		r.statement(stmt, sc)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement, sc *symbols.Scope) {
+	if stmt == nil {
+		return
+	}
+	r.mark(stmt.Pos(), sc)
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		r.expression(stmt.Value, sc)
+		if stmt.Name != nil {
+			sym := symbols.LetSymbol(stmt, symbols.Variable)
+			sc.Define(sym)
+			if r.covers(stmt.Name.Pos(), len(stmt.Name.Value)) {
+				r.found(sym)
+			}
+		}
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue, sc)
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression, sc)
+	case *ast.ThrowStatement:
+		r.expression(stmt.Value, sc)
+	}
+}
+
+func (r *resolver) expression(e ast.Expression, sc *symbols.Scope) {
+	if e == nil {
+		return
+	}
+	switch e := e.(type) {
+	case *ast.Identifier:
+		r.identifier(e, sc)
+	case *ast.PrefixExpression:
+		r.expression(e.Right, sc)
+	case *ast.InfixExpression:
+		r.expression(e.Left, sc)
+		if e.Operator != "->" && e.Operator != "::" && e.Operator != "?->" {
+			r.expression(e.Right, sc)
+			break
+		}
+		if name, ok := e.Right.(*ast.Identifier); ok {
+			r.mark(name.Pos(), sc)
+			r.cursorMember = e.Left
+			if r.covers(name.Pos(), len(name.Value)) {
+				r.found(member(classOf(e.Left, sc), name.Value, sc))
+			}
+		}
+	case *ast.IfExpression:
+		r.expression(e.Condition, sc)
+		r.expression(e.Consequence, sc)
+		r.expression(e.Alternative, sc)
+	case *ast.BlockStatement:
+		if e == nil {
+			return
+		}
+		r.statements(e.Statements, sc)
+		r.statements(e.DeferStatements, sc)
+	case *ast.FunctionLiteral:
+		r.function(e, sc)
+	case *ast.CallExpression:
+		r.expression(e.Function, sc)
+		for _, arg := range e.Arguments {
+			r.expression(arg, sc)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			r.expression(element, sc)
+		}
+	case *ast.TemplateLiteral:
+		for _, part := range e.Parts {
+			r.expression(part, sc)
+		}
+	case *ast.IndexExpression:
+		r.expression(e.Left, sc)
+		r.expression(e.Index, sc)
+		r.expression(e.High, sc)
+	case *ast.HashLiteral:
+		for _, key := range e.Keys {
+			r.expression(key, sc)
+			r.expression(e.Pairs[key], sc)
+		}
+	case *ast.WhileExpression:
+		r.expression(e.Condition, sc)
+		r.expression(e.Body, sc)
+	case *ast.ForExpression:
+		r.statement(e.Initor, sc)
+		r.expression(e.Condition, sc)
+		r.expression(e.After, sc)
+		r.expression(e.Body, sc)
+	case *ast.ForInExpression:
+		r.expression(e.Collection, sc)
+		for _, name := range e.Names {
+			sym := &symbols.Symbol{Name: name.Value, Kind: symbols.Variable, Pos: name.Pos()}
+			sc.Define(sym)
+			if r.covers(name.Pos(), len(name.Value)) {
+				r.found(sym)
+			}
+		}
+		r.expression(e.Body, sc)
+	case *ast.ClassExpress:
+		r.class(e, sc)
+	case *ast.InterfaceExpress:
+		if r.covers(e.Name.Pos(), len(e.Name.Value)) {
+			r.found(sc.Lookup(e.Name.Value))
+		}
+	case *ast.ObjectExpress:
+		r.identifier(e.Class, sc)
+		for _, param := range e.Parameters {
+			r.expression(param, sc)
+		}
+	case *ast.TryExpression:
+		r.expression(e.Block, sc)
+		if e.Parameter != nil {
+			sym := &symbols.Symbol{Name: e.Parameter.Value, Kind: symbols.Variable, Pos: e.Parameter.Pos()}
+			sc.Define(sym)
+			if r.covers(e.Parameter.Pos(), len(e.Parameter.Value)) {
+				r.found(sym)
+			}
+		}
+		r.expression(e.Catch, sc)
+		r.expression(e.Finally, sc)
+	}
+}
+
+// function walks a function in a scope of its own, a named function is declared where it is written
+func (r *resolver) function(fn *ast.FunctionLiteral, sc *symbols.Scope) {
+	r.mark(fn.Pos(), sc)
+	if fn.Name != "" && sc.Class == nil && sc.Lookup(fn.Name) == nil {
+		sc.Define(symbols.FunctionSymbol(fn, symbols.Function))
+	}
+	if fn.Name != "" && r.covers(fn.NamePos, len(fn.Name)) {
+		r.found(sc.Lookup(fn.Name))
+	}
+	fnScope := symbols.NewScope(sc)
+	for _, param := range fn.Parameters {
+		if param == nil {
+			continue
+		}
+		r.expression(param.Default, sc)
+		sym := &symbols.Symbol{Name: param.Value, Kind: symbols.Variable, Pos: param.Pos()}
+		fnScope.Define(sym)
+		if r.covers(param.Pos(), len(param.Value)) {
+			r.found(sym)
+		}
+	}
+	if fn.Body != nil {
+		r.mark(fn.Body.Pos(), fnScope)
+		r.expression(fn.Body, fnScope)
+	}
+}
+
+func (r *resolver) class(class *ast.ClassExpress, sc *symbols.Scope) {
+	if class.Name == nil {
+		return
+	}
+	if r.covers(class.Name.Pos(), len(class.Name.Value)) {
+		r.found(sc.Lookup(class.Name.Value))
+	}
+	for _, parent := range class.Parents {
+		r.identifier(parent, sc)
+	}
+	r.identifier(class.Interface, sc)
+	classScope := symbols.NewScope(sc)
+	classScope.Class = class
+	for _, sym := range symbols.Members(class, sc) {
+		if _, ok := classScope.Symbols[sym.Name]; !ok {
+			classScope.Define(sym)
+		}
+	}
+	for _, let := range class.LetStatements {
+		if let == nil {
+			continue
+		}
+		r.mark(let.Pos(), classScope)
+		r.expression(let.Value, classScope)
+		if let.Name != nil && r.covers(let.Name.Pos(), len(let.Name.Value)) {
+			r.found(classScope.Symbols[let.Name.Value])
+		}
+	}
+	for _, fn := range class.Functions {
+		if fn != nil {
+			r.function(fn, classScope)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package lsp serves the Language Server Protocol for z files: diagnostics, go to definition, hover and completion
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"z/ast"
+	"z/module"
+	"z/symbols"
+	"z/token"
+)
+
+// Server answers the requests of one editor, Serve handles them until the editor exits
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	workspace *workspace
+}
+
+// NewServer makes a server that finds the imports and the standard library with resolver
+func NewServer(in io.Reader, out io.Writer, resolver *module.Resolver) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, workspace: newWorkspace(resolver)}
+}
+
+// Serve handles messages until the exit notification or the end of the input
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if msg.ID == nil {
+			s.notification(msg)
+			continue
+		}
+		result, err := s.request(msg)
+		response := &message{ID: msg.ID}
+		if err != nil {
+			code := requestFailed
+			if _, ok := err.(unknownMethodError); ok {
+				code = methodNotFound
+			}
+			response.Error = &responseError{Code: code, Message: err.Error()}
+		} else {
+			response.Result, _ = json.Marshal(result)
+		}
+		writeMessage(s.out, response)
+	}
+}
+
+type unknownMethodError string
+
+func (e unknownMethodError) Error() string {
+	return fmt.Sprintf("method %s is not supported", string(e))
+}
+
+func (s *Server) request(msg *message) (result interface{}, err error) {
+	// a bug in the analysis of a half written file must not end the session
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("%s failed: %v", msg.Method, r)
+		}
+	}()
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // the whole document is sent on every change
+				"definitionProvider": true,
+				"hoverProvider":      true,
+				"completionProvider": map[string]interface{}{"triggerCharacters": []string{">", ":", "."}},
+			},
+			"serverInfo": map[string]string{"name": "z lsp"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params)
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params)
+	default:
+		return nil, unknownMethodError(msg.Method)
+	}
+}
+
+func (s *Server) notification(msg *message) {
+	defer func() { recover() }()
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.update(uriToPath(params.TextDocument.URI), params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			s.update(uriToPath(params.TextDocument.URI), params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didSave":
+		var params didCloseParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			path := uriToPath(params.TextDocument.URI)
+			s.workspace.forget(path)
+			s.publishDiagnostics(path)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			path := uriToPath(params.TextDocument.URI)
+			delete(s.workspace.open, path)
+			s.workspace.forget(path)
+		}
+	}
+}
+
+func (s *Server) update(path string, text string) {
+	s.workspace.open[path] = text
+	s.workspace.forget(path)
+	s.publishDiagnostics(path)
+}
+
+func (s *Server) publishDiagnostics(path string) {
+	a, err := s.workspace.analyze(path)
+	if err != nil {
+		return
+	}
+	diagnostics := []diagnosticMessage{}
+	for _, d := range a.diagnostics {
+		pos := d.pos
+		if !pos.IsValid() {
+			pos = token.Position{Line: 1, Column: 1}
+		}
+		diagnostics = append(diagnostics, diagnosticMessage{
+			Range:    nameRange(pos, 1),
+			Severity: errorSeverity,
+			Source:   "z",
+			Message:  d.message,
+		})
+	}
+	params, _ := json.Marshal(publishDiagnosticsParams{URI: pathToURI(path), Diagnostics: diagnostics})
+	writeMessage(s.out, &message{Method: "textDocument/publishDiagnostics", Params: params})
+}
+
+// target finds the declaration of the name at a position
+func (s *Server) target(params textDocumentPositionParams) (*symbols.Symbol, error) {
+	path := uriToPath(params.TextDocument.URI)
+	a, err := s.workspace.analyze(path)
+	if err != nil {
+		return nil, err
+	}
+	return a.resolve(params.Position.tokenPosition(path)).target, nil
+}
+
+func (s *Server) definition(params textDocumentPositionParams) (interface{}, error) {
+	sym, err := s.target(params)
+	if err != nil || sym == nil || !sym.Pos.IsValid() {
+		return nil, err
+	}
+	return location{URI: pathToURI(sym.Pos.FileName), Range: nameRange(sym.Pos, len(sym.Name))}, nil
+}
+
+func (s *Server) hover(params textDocumentPositionParams) (interface{}, error) {
+	sym, err := s.target(params)
+	if err != nil || sym == nil {
+		return nil, err
+	}
+	value := "```z\n" + signature(sym) + "\n```"
+	if sym.Pos.IsValid() {
+		value += fmt.Sprintf("\n\n%s:%d", filepath.Base(sym.Pos.FileName), sym.Pos.Line)
+	}
+	return hover{Contents: markupContent{Kind: "markdown", Value: value}}, nil
+}
+
+// memberAccess matches the text before the cursor when it completes a member: this->na, Config::
+var memberAccess = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.]*)\s*(->|::)\s*[A-Za-z0-9_]*$`)
+
+func (s *Server) completion(params textDocumentPositionParams) (interface{}, error) {
+	path := uriToPath(params.TextDocument.URI)
+	a, err := s.workspace.analyze(path)
+	if err != nil {
+		return nil, err
+	}
+	r := a.resolve(params.Position.tokenPosition(path))
+	list := completionList{Items: []completionItem{}}
+
+	if match := memberAccess.FindStringSubmatch(s.linePrefix(path, params.Position)); match != nil {
+		// when the class of the left side is not known the members of every class are offered
+		classes := []*ast.ClassExpress{}
+		if class := classOf(&ast.Identifier{Value: match[1]}, r.cursorScope); class != nil {
+			classes = append(classes, class)
+		} else {
+			for _, sym := range r.cursorScope.Visible() {
+				if sym.Class != nil {
+					classes = append(classes, sym.Class)
+				}
+			}
+		}
+		seen := map[string]bool{}
+		for _, class := range classes {
+			for _, member := range symbols.Members(class, r.cursorScope) {
+				if !seen[member.Name] {
+					seen[member.Name] = true
+					list.Items = append(list.Items, item(member))
+				}
+			}
+		}
+		return list, nil
+	}
+
+	for _, sym := range r.cursorScope.Visible() {
+		list.Items = append(list.Items, item(sym))
+	}
+	for _, sym := range s.standardLibrary() {
+		if r.cursorScope.Lookup(sym.Name) == nil {
+			list.Items = append(list.Items, item(sym))
+		}
+	}
+	return list, nil
+}
+
+func item(sym *symbols.Symbol) completionItem {
+	kinds := map[symbols.Kind]int{
+		symbols.Variable:  variableItem,
+		symbols.Function:  functionItem,
+		symbols.Class:     classItem,
+		symbols.Interface: interfaceItem,
+		symbols.Field:     fieldItem,
+		symbols.Method:    methodItem,
+		symbols.Builtin:   functionItem,
+	}
+	return completionItem{Label: sym.Name, Kind: kinds[sym.Kind], Detail: signature(sym)}
+}
+
+// linePrefix is the text of a line of a document before a position
+func (s *Server) linePrefix(path string, pos position) string {
+	lines := strings.Split(s.workspace.open[path], "\n")
+	if pos.Line >= len(lines) {
+		return ""
+	}
+	// the lexer counts the columns of a line in characters, so does the server
+	line := []rune(lines[pos.Line])
+	if pos.Character < len(line) {
+		line = line[:pos.Character]
+	}
+	return string(line)
+}
+
+// standardLibrary are the functions of the packages in the standard directory, with their package prefix
+func (s *Server) standardLibrary() []*symbols.Symbol {
+	library := []*symbols.Symbol{}
+	for _, path := range s.workspace.resolver.StandardFiles() {
+		f, err := s.workspace.file(path)
+		if err != nil || f.PackageName == "" {
+			continue
+		}
+		names := module.Exports(f.Program)
+		sort.Strings(names)
+		for _, name := range names {
+			if f.Top[name] == nil {
+				continue
+			}
+			sym := *f.Top[name]
+			sym.Name = f.PackageName + "." + name
+			library = append(library, &sym)
+		}
+	}
+	return library
+}
@@ -0,0 +1,224 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"z/module"
+)
+
+const shapesSource = `package shapes
+
+class Point {
+  let x = 0
+  fn move(dx, dy) {
+    x = x + dx
+  }
+}
+fn origin() {
+  return new Point()
+}
+`
+
+const mainSource = `import "shapes"
+
+let area = fn(width, height = 1) {
+  return width * height
+}
+let p = new shapes.Point()
+p->move(1, 2)
+puts(area(2), shapes.origin())
+`
+
+// session sends messages to a server and reads all it answers once the input ends
+type session struct {
+	t     *testing.T
+	input bytes.Buffer
+	id    int
+}
+
+func (s *session) send(method string, params interface{}) {
+	content, _ := json.Marshal(params)
+	writeMessage(&s.input, &message{Method: method, Params: content})
+}
+
+func (s *session) request(method string, params interface{}) int {
+	s.id++
+	content, _ := json.Marshal(params)
+	writeMessage(&s.input, &message{ID: json.RawMessage(strconv.Itoa(s.id)), Method: method, Params: content})
+	return s.id
+}
+
+func (s *session) run(zRoot string) []*message {
+	s.t.Helper()
+	var output bytes.Buffer
+	if err := NewServer(&s.input, &output, module.NewResolver(zRoot, "")).Serve(); err != nil {
+		s.t.Fatalf("serve error: %s", err)
+	}
+	messages := []*message{}
+	reader := bufio.NewReader(&output)
+	for reader.Buffered() > 0 || output.Len() > 0 {
+		msg, err := readMessage(reader)
+		if err != nil {
+			s.t.Fatalf("read error: %s", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// response finds the result of the nth request
+func response(t *testing.T, messages []*message, n int, result interface{}) {
+	t.Helper()
+	id := strconv.Itoa(n)
+	for _, msg := range messages {
+		if string(msg.ID) == id && msg.Method == "" {
+			if msg.Error != nil {
+				t.Fatalf("request %d failed: %s", n, msg.Error.Message)
+			}
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				t.Fatalf("decode error: %s", err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", n)
+}
+
+func diagnostics(messages []*message) [][]diagnosticMessage {
+	published := [][]diagnosticMessage{}
+	for _, msg := range messages {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			json.Unmarshal(msg.Params, &params)
+			published = append(published, params.Diagnostics)
+		}
+	}
+	return published
+}
+
+func writeSources(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	shapes := filepath.Join(dir, "shapes.z")
+	if err := os.WriteFile(shapes, []byte(shapesSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "main.z"), shapes
+}
+
+func at(uri string, line int, character int) textDocumentPositionParams {
+	return textDocumentPositionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: position{Line: line, Character: character}}
+}
+
+func labels(list completionList) map[string]bool {
+	names := map[string]bool{}
+	for _, item := range list.Items {
+		names[item.Label] = true
+	}
+	return names
+}
+
+func TestNavigation(t *testing.T) {
+	main, shapes := writeSources(t)
+	uri := pathToURI(main)
+	s := &session{t: t}
+	s.request("initialize", map[string]interface{}{})
+	s.send("initialized", map[string]interface{}{})
+	s.send("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, Text: mainSource}})
+	area := s.request("textDocument/definition", at(uri, 7, 6))
+	origin := s.request("textDocument/definition", at(uri, 7, 22))
+	move := s.request("textDocument/definition", at(uri, 6, 4))
+	width := s.request("textDocument/definition", at(uri, 3, 10))
+	hoverArea := s.request("textDocument/hover", at(uri, 7, 6))
+	members := s.request("textDocument/completion", at(uri, 6, 3))
+	names := s.request("textDocument/completion", at(uri, 7, 0))
+	s.request("shutdown", nil)
+	s.send("exit", nil)
+	root, _ := filepath.Abs("../../..")
+	messages := s.run(root)
+
+	published := diagnostics(messages)
+	if len(published) != 1 || len(published[0]) != 0 {
+		t.Errorf("wrong diagnostics. got=%+v", published)
+	}
+
+	tests := []struct {
+		request   int
+		path      string
+		line      int
+		character int
+	}{
+		{area, main, 2, 4},
+		{origin, shapes, 8, 3},
+		{move, shapes, 4, 5},
+		{width, main, 2, 14},
+	}
+	for _, tt := range tests {
+		var loc location
+		response(t, messages, tt.request, &loc)
+		if loc.URI != pathToURI(tt.path) || loc.Range.Start.Line != tt.line || loc.Range.Start.Character != tt.character {
+			t.Errorf("request %d: wrong definition. want %s:%d:%d, got=%+v", tt.request, tt.path, tt.line, tt.character, loc)
+		}
+	}
+
+	var h hover
+	response(t, messages, hoverArea, &h)
+	if !strings.Contains(h.Contents.Value, "fn area(width, height = 1)") {
+		t.Errorf("wrong hover. got=%q", h.Contents.Value)
+	}
+
+	var list completionList
+	response(t, messages, members, &list)
+	if got := labels(list); len(got) != 2 || !got["move"] || !got["x"] {
+		t.Errorf("wrong member completion. got=%v", got)
+	}
+	response(t, messages, names, &list)
+	got := labels(list)
+	for _, name := range []string{"area", "p", "shapes.origin", "len", "http_server", "string.prefix"} {
+		if !got[name] {
+			t.Errorf("%s is not completed", name)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	main, _ := writeSources(t)
+	uri := pathToURI(main)
+	s := &session{t: t}
+	s.send("textDocument/didOpen", didOpenParams{TextDocument: textDocumentItem{URI: uri, Text: mainSource}})
+	changed := didChangeParams{TextDocument: textDocumentIdentifier{URI: uri}}
+	changed.ContentChanges = append(changed.ContentChanges, struct {
+		Text string `json:"text"`
+	}{"import \"circles\"\nlet = 5\n"})
+	s.send("textDocument/didChange", changed)
+	unknown := s.request("textDocument/rename", at(uri, 0, 0))
+	messages := s.run("")
+
+	published := diagnostics(messages)
+	if len(published) != 2 || len(published[0]) != 0 {
+		t.Fatalf("wrong diagnostics. got=%+v", published)
+	}
+	var missing, syntax bool
+	for _, d := range published[1] {
+		if strings.Contains(d.Message, "circles.z") && d.Range.Start.Line == 0 {
+			missing = true
+		} else if d.Range.Start.Line == 1 {
+			syntax = true
+		}
+	}
+	if !missing || !syntax {
+		t.Errorf("wrong diagnostics after the change. got=%+v", published[1])
+	}
+
+	for _, msg := range messages {
+		if string(msg.ID) == "1" && (msg.Error == nil || msg.Error.Code != methodNotFound) {
+			t.Errorf("request %d: want method not found, got=%+v", unknown, msg)
+		}
+	}
+}
@@ -3,27 +3,72 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"os/user"
 	"strings"
 	"z/cli"
 	"z/config"
+	"z/dap"
+	"z/lsp"
 	"z/repl"
 )
 
 func main() {
 	var operation string
 	var fileName string
-	mode := "vm"
+	mode := "eval"
+	outFile := ""
 	if len(os.Args) > 1 {
 		operation = os.Args[1]
-		if operation == "run" || operation == "build" || operation == "rundev" {
+		if operation == "dap" { // the editor talks to the debug adapter over stdin and stdout
+			err := dap.NewServer(os.Stdin, os.Stdout).Serve()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+		if operation == "lsp" { // so is the language server
+			err := lsp.NewServer(os.Stdin, os.Stdout, cli.Resolver()).Serve()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+		if operation == "fmt" {
+			if !cli.FormatCommand(os.Args[2:], os.Stdout, os.Stderr) {
+				os.Exit(1)
+			}
+			return
+		}
+		if operation == "vet" {
+			if !cli.VetCommand(os.Args[2:], cli.Resolver(), os.Stdout, os.Stderr) {
+				os.Exit(1)
+			}
+			return
+		}
+		if operation == "mod" {
+			if !cli.ModCommand(os.Args[2:], os.Stdout, os.Stderr) {
+				os.Exit(1)
+			}
+			return
+		}
+		if operation == "env" {
+			if !cli.EnvCommand(os.Args[2:], os.Stdout, os.Stderr) {
+				os.Exit(1)
+			}
+			return
+		}
+		if operation == "run" || operation == "build" || operation == "rundev" || operation == "compile" ||
+			operation == "disasm" || operation == "debug" {
 			if len(os.Args) == 2 {
 				fmt.Println("please input source file")
 				return
 			}
 			fileName = os.Args[2]
-			if len(os.Args) == 4 {
+			if operation == "compile" && len(os.Args) == 5 && os.Args[3] == "-o" {
+				outFile = os.Args[4]
+			} else if len(os.Args) == 4 {
 				mode = os.Args[3]
 			}
 		} else {
@@ -33,31 +78,22 @@ func main() {
 				mode = os.Args[2]
 			}
 		}
+		if strings.HasSuffix(fileName, ".zc") { // compiled by z compile, the prelude is in it
+			switch operation {
+			case "run":
+				cli.RunBytecodeFile(fileName)
+				return
+			case "disasm":
+				cli.DisasmBytecodeFile(fileName)
+				return
+			}
+		}
 		fileContent, err := os.ReadFile(fileName)
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(-1)
 		}
 		sourceCode := string(fileContent)
-		sourceCodeLines := strings.Split(sourceCode, "\n")
-		if len(sourceCodeLines) > 0 {
-			dir, _ := exec.LookPath(os.Args[0])
-			buildSourceDir := dir
-			envZRoot, ok := os.LookupEnv("Z_ROOT")
-			if ok {
-				buildSourceDir = envZRoot
-			}
-			builtinLine := `import "` + buildSourceDir + `/standard/builtin.z";`
-			if strings.Contains(sourceCodeLines[0], "package") {
-				runSourceCodeLines := []string{}
-				runSourceCodeLines = append(runSourceCodeLines, sourceCodeLines[0])
-				runSourceCodeLines = append(runSourceCodeLines, builtinLine)
-				runSourceCodeLines = append(runSourceCodeLines, sourceCodeLines[1:]...)
-				sourceCode = strings.Join(runSourceCodeLines, "\n")
-			} else {
-				sourceCode = builtinLine + sourceCode
-			}
-		}
 		switch operation {
 		case "run":
 			cli.RunSourceCode(sourceCode, mode, fileName)
@@ -65,6 +101,15 @@ func main() {
 		case "build":
 			cli.BuildSourceCode(sourceCode, fileName)
 			return
+		case "compile":
+			cli.CompileSourceCode(sourceCode, fileName, outFile)
+			return
+		case "disasm":
+			cli.DisasmSourceCode(sourceCode, fileName)
+			return
+		case "debug":
+			cli.DebugSourceCode(sourceCode, fileName, os.Stdin, os.Stdout)
+			return
 		case "rundev":
 			cli.RunDev()
 			return
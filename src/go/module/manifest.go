@@ -0,0 +1,184 @@
+package module
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ManifestFile = "z.mod"  // marks the root directory of a project, with its name and its dependencies
+	LockFile     = "z.lock" // the commit and the hash of each dependency, written by z mod tidy
+	VendorDir    = "vendor" // the copies of the dependencies, written by z mod vendor
+)
+
+// Manifest is a z.mod file:
+//
+//	module shop
+//	require geometry ../geometry
+//	require strings https://example.com/strings.git 4f3c2a1
+//
+// A dependency is a directory, relative to the manifest, or a git repository pinned at a commit.
+// Its files are imported as "name/file"
+type Manifest struct {
+	Module   string
+	Requires []*Require
+}
+
+// Require is a dependency of a project
+type Require struct {
+	Name    string
+	Source  string // a directory or the url of a git repository
+	Version string // the commit of a git repository, empty for a directory
+	Line    int
+}
+
+// IsGit tells whether the dependency is a git repository
+func (r *Require) IsGit() bool {
+	return r.Version != ""
+}
+
+// ParseManifest parses the z.mod file at path
+func ParseManifest(path string, src string) (*Manifest, error) {
+	m := &Manifest{}
+	names := map[string]bool{}
+	for i, line := range strings.Split(src, "\n") {
+		fields := strings.Fields(line)
+		// a comment starts with a field starting with //, urls have // in them too
+		for j, field := range fields {
+			if strings.HasPrefix(field, "//") {
+				fields = fields[:j]
+				break
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		errorf := func(format string, a ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, i+1, fmt.Sprintf(format, a...))
+		}
+		switch fields[0] {
+		case "module":
+			if len(fields) != 2 {
+				return nil, errorf("want module name")
+			}
+			m.Module = fields[1]
+		case "require":
+			if len(fields) != 3 && len(fields) != 4 {
+				return nil, errorf("want require name directory, or require name url commit")
+			}
+			r := &Require{Name: fields[1], Source: fields[2], Line: i + 1}
+			if len(fields) == 4 {
+				r.Version = fields[3]
+			} else if strings.Contains(r.Source, "://") || strings.HasPrefix(r.Source, "git@") {
+				return nil, errorf("pin %s at a commit", r.Source)
+			}
+			if strings.ContainsAny(r.Name, `/\`) || strings.HasPrefix(r.Name, ".") {
+				return nil, errorf("bad dependency name %s", r.Name)
+			}
+			if names[r.Name] {
+				return nil, errorf("%s is required twice", r.Name)
+			}
+			names[r.Name] = true
+			m.Requires = append(m.Requires, r)
+		default:
+			return nil, errorf("unknown directive %s", fields[0])
+		}
+	}
+	if m.Module == "" {
+		return nil, fmt.Errorf("%s: no module line", path)
+	}
+	return m, nil
+}
+
+// ReadManifest reads the z.mod file of the project in root
+func ReadManifest(root string) (*Manifest, error) {
+	path := filepath.Join(root, ManifestFile)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(path, string(src))
+}
+
+// Require is the dependency named name, nil when there is none
+func (m *Manifest) Require(name string) *Require {
+	for _, r := range m.Requires {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) String() string {
+	var out strings.Builder
+	out.WriteString("module " + m.Module + "\n")
+	if len(m.Requires) > 0 {
+		out.WriteString("\n")
+	}
+	for _, r := range m.Requires {
+		out.WriteString("require " + r.Name + " " + r.Source)
+		if r.Version != "" {
+			out.WriteString(" " + r.Version)
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// Locked is a dependency as z mod tidy found it
+type Locked struct {
+	Name   string
+	Source string
+	Commit string // the full commit of a git repository, - for a directory
+	Hash   string // of the .z files of the dependency
+}
+
+// Lock is a z.lock file, one dependency per line: name source commit hash
+type Lock []*Locked
+
+// ParseLock parses the z.lock file at path
+func ParseLock(path string, src string) (Lock, error) {
+	lock := Lock{}
+	for i, line := range strings.Split(src, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("%s:%d: want name source commit hash", path, i+1)
+		}
+		lock = append(lock, &Locked{Name: fields[0], Source: fields[1], Commit: fields[2], Hash: fields[3]})
+	}
+	return lock, nil
+}
+
+// ReadLock reads the z.lock file of the project in root
+func ReadLock(root string) (Lock, error) {
+	path := filepath.Join(root, LockFile)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLock(path, string(src))
+}
+
+// Find is the locked dependency named name, nil when there is none
+func (l Lock) Find(name string) *Locked {
+	for _, locked := range l {
+		if locked.Name == name {
+			return locked
+		}
+	}
+	return nil
+}
+
+func (l Lock) String() string {
+	var out strings.Builder
+	for _, locked := range l {
+		fmt.Fprintf(&out, "%s %s %s %s\n", locked.Name, locked.Source, locked.Commit, locked.Hash)
+	}
+	return out.String()
+}
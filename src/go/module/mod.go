@@ -0,0 +1,251 @@
+package module
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"z/ast"
+	"z/lexer"
+	"z/parser"
+)
+
+// InitProject writes the z.mod of a new project named name in root
+func InitProject(root string, name string) error {
+	path := filepath.Join(root, ManifestFile)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	return os.WriteFile(path, []byte((&Manifest{Module: name}).String()), 0644)
+}
+
+// Tidy drops the dependencies no file of the project in root imports from its z.mod,
+// then writes its z.lock with the commit and the hash of the others. It returns the names of the dropped ones
+func Tidy(root string) ([]string, error) {
+	manifest, err := ReadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+	used, err := importedDependencies(root)
+	if err != nil {
+		return nil, err
+	}
+	removed := []string{}
+	requires := []*Require{}
+	for _, r := range manifest.Requires {
+		if used[r.Name] {
+			requires = append(requires, r)
+		} else {
+			removed = append(removed, r.Name)
+		}
+	}
+	if len(removed) > 0 {
+		manifest.Requires = requires
+		if err := os.WriteFile(filepath.Join(root, ManifestFile), []byte(manifest.String()), 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	lock := Lock{}
+	for _, r := range manifest.Requires {
+		locked, err := lockDependency(root, r, r.Version)
+		if err != nil {
+			return nil, err
+		}
+		lock = append(lock, locked)
+	}
+	return removed, os.WriteFile(filepath.Join(root, LockFile), []byte(lock.String()), 0644)
+}
+
+// Vendor copies the .z files of each dependency of the project in root to vendor/name,
+// at the commit z.lock has for it, and checks them against the hash z.lock has
+func Vendor(root string) error {
+	manifest, err := ReadManifest(root)
+	if err != nil {
+		return err
+	}
+	lock, err := ReadLock(root)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is missing, run z mod tidy", LockFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	vendor := filepath.Join(root, VendorDir)
+	if err := os.RemoveAll(vendor); err != nil {
+		return err
+	}
+	for _, r := range manifest.Requires {
+		locked := lock.Find(r.Name)
+		if locked == nil || locked.Source != r.Source {
+			return fmt.Errorf("%s has no entry for %s, run z mod tidy", LockFile, r.Name)
+		}
+		err := withDependency(root, r, locked.Commit, func(dir string, commit string) error {
+			hash, err := hashFiles(dir)
+			if err != nil {
+				return err
+			}
+			if hash != locked.Hash {
+				return fmt.Errorf("%s has changed since z mod tidy: its hash is %s, %s has %s", r.Name, hash, LockFile, locked.Hash)
+			}
+			return copyFiles(dir, filepath.Join(vendor, r.Name))
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockDependency fetches a dependency at version to find its commit and its hash
+func lockDependency(root string, r *Require, version string) (*Locked, error) {
+	locked := &Locked{Name: r.Name, Source: r.Source}
+	err := withDependency(root, r, version, func(dir string, commit string) error {
+		hash, err := hashFiles(dir)
+		locked.Commit, locked.Hash = commit, hash
+		return err
+	})
+	return locked, err
+}
+
+// withDependency calls f with a directory holding the files of a dependency, a git repository is cloned
+// at version into a temporary directory. The commit of a directory is -
+func withDependency(root string, r *Require, version string, f func(dir string, commit string) error) error {
+	source := r.Source
+	if !strings.Contains(source, "://") && !strings.HasPrefix(source, "git@") && !filepath.IsAbs(source) {
+		source = filepath.Join(root, source)
+	}
+	if !r.IsGit() {
+		if info, err := os.Stat(source); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s: %s is not a directory", r.Name, source)
+		}
+		return f(source, "-")
+	}
+
+	dir, err := os.MkdirTemp("", "z-mod-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := git("", "clone", "--quiet", "--", source, dir); err != nil {
+		return fmt.Errorf("%s: %s", r.Name, err)
+	}
+	if err := git(dir, "checkout", "--quiet", "--detach", version); err != nil {
+		return fmt.Errorf("%s: %s", r.Name, err)
+	}
+	commit, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("%s: git rev-parse: %s", r.Name, err)
+	}
+	return f(dir, strings.TrimSpace(string(commit)))
+}
+
+func git(dir string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %s", args[len(args)-1], strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// sourceFiles are the .z files under dir relative to it, sorted. The directories of git, vendored
+// dependencies and other projects are left out
+func sourceFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir {
+			if d.Name() == ".git" || d.Name() == VendorDir {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, ManifestFile)); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".z") {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// hashFiles hashes the names and the contents of the .z files under dir
+func hashFiles(dir string) (string, error) {
+	files, err := sourceFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", file, len(content))
+		h.Write(content)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFiles copies the .z files under src to dst
+func copyFiles(src string, dst string) error {
+	files, err := sourceFiles(src)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(src, file))
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dst, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importedDependencies are the first elements of the imports written in the files of the project in root,
+// the dependencies among them are used
+func importedDependencies(root string) (map[string]bool, error) {
+	files, err := sourceFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, file := range files {
+		src, err := os.ReadFile(filepath.Join(root, file))
+		if err != nil {
+			return nil, err
+		}
+		// a file with parse errors still has its imports
+		program := parser.New(lexer.New(string(src))).ParseProgram()
+		for _, stmt := range program.Statements {
+			if imp, ok := stmt.(*ast.ImportStatement); ok {
+				used[strings.SplitN(imp.Path, "/", 2)[0]] = true
+			}
+		}
+	}
+	return used, nil
+}
@@ -0,0 +1,170 @@
+package module
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	m, err := ParseManifest("z.mod", "module shop // the shop\n\nrequire geo ../geo\nrequire strs https://example.com/strs.git 3ab41b3\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Module != "shop" || len(m.Requires) != 2 || m.Require("geo").IsGit() || m.Require("strs").Version != "3ab41b3" {
+		t.Errorf("wrong manifest. got=%q", m)
+	}
+	if expected := "module shop\n\nrequire geo ../geo\nrequire strs https://example.com/strs.git 3ab41b3\n"; m.String() != expected {
+		t.Errorf("wrong output.\nexpected=%q\ngot=     %q", expected, m.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"require geo ../geo", "z.mod: no module line"},
+		{"module shop\nreplace geo ../geo", "z.mod:2: unknown directive replace"},
+		{"module shop\nrequire geo", "z.mod:2: want require name directory, or require name url commit"},
+		{"module shop\nrequire strs https://example.com/strs.git", "z.mod:2: pin https://example.com/strs.git at a commit"},
+		{"module shop\nrequire geo ../geo\nrequire geo ../other", "z.mod:3: geo is required twice"},
+		{"module shop\nrequire a/b ../geo", "z.mod:2: bad dependency name a/b"},
+	}
+	for _, tt := range tests {
+		_, err := ParseManifest("z.mod", tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+// gitRepository commits each version of the files in turn to a new repository, it returns the commits
+func gitRepository(t *testing.T, dir string, versions ...map[string]string) []string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	run := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=z", "-c", "user.email=z@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s", args[0], out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "--quiet")
+	commits := []string{}
+	for _, files := range versions {
+		writeFilesIn(t, dir, files)
+		run("add", ".")
+		run("commit", "--quiet", "-m", "version", "--allow-empty")
+		commits = append(commits, run("rev-parse", "HEAD"))
+	}
+	return commits
+}
+
+func writeFilesIn(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTidyAndVendor(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"geo/geometry.z":      "package geo\nfn area(w, h) { w * h }",
+		"shop/main.z":         "import \"geo/geometry\"\nimport \"strs/strs\"\nimport \"string\"",
+		"shop/vendor/old/a.z": "",
+	})
+	strs := filepath.Join(dir, "strs")
+	if err := os.Mkdir(strs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	commits := gitRepository(t, strs,
+		map[string]string{"strs.z": "fn shout(s) { s + \"!\" }"},
+		map[string]string{"strs.z": "fn shout(s) { s + \"!!\" }"})
+
+	shop := filepath.Join(dir, "shop")
+	if err := InitProject(shop, "shop"); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitProject(shop, "shop"); err == nil {
+		t.Errorf("z.mod is written twice")
+	}
+	manifest := "module shop\nrequire geo ../geo\nrequire strs " + strs + " " + commits[0][:7] + "\nrequire unused ../geo\n"
+	writeFilesIn(t, shop, map[string]string{ManifestFile: manifest})
+
+	if err := Vendor(shop); err == nil || !strings.Contains(err.Error(), "z.lock is missing") {
+		t.Errorf("vendoring without z.lock. got=%v", err)
+	}
+	removed, err := Tidy(shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(removed, " ") != "unused" {
+		t.Errorf("wrong removed dependencies. got=%v", removed)
+	}
+	m, err := ReadManifest(shop)
+	if err != nil || len(m.Requires) != 2 {
+		t.Fatalf("unused is still required. got=%v, %v", m, err)
+	}
+	lock, err := ReadLock(shop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock) != 2 || lock.Find("geo").Commit != "-" || lock.Find("strs").Commit != commits[0] {
+		t.Errorf("wrong lock. got=%q", lock)
+	}
+
+	if err := Vendor(shop); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(shop, VendorDir, "strs", "strs.z"))
+	if err != nil || string(content) != "fn shout(s) { s + \"!\" }" {
+		t.Errorf("strs is not vendored at its pinned commit. got=%q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(shop, VendorDir, "old")); !os.IsNotExist(err) {
+		t.Errorf("an old vendored dependency is kept")
+	}
+
+	r := NewResolver("", "")
+	from := filepath.Join(shop, "main.z")
+	if got := r.Resolve(from, "strs/strs"); got != filepath.Join(shop, VendorDir, "strs", "strs.z") {
+		t.Errorf("the vendored dependency is not imported. got=%s", got)
+	}
+
+	writeFilesIn(t, dir, map[string]string{"geo/geometry.z": "package geo"})
+	if err := Vendor(shop); err == nil || !strings.Contains(err.Error(), "geo has changed since z mod tidy") {
+		t.Errorf("a changed dependency is vendored. got=%v", err)
+	}
+}
+
+func TestResolveDependency(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"geo/geometry.z":  "",
+		"shop/z.mod":      "module shop\nrequire geo ../geo\nrequire strs https://example.com/strs.git 3ab41b3",
+		"shop/app/main.z": "",
+	})
+	r := NewResolver("", "")
+	from := filepath.Join(dir, "shop", "app", "main.z")
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"geo/geometry", "geo/geometry.z"},
+		{"strs/strs", "shop/app/strs/strs.z"},
+		{"other/geometry", "shop/app/other/geometry.z"},
+	}
+	for _, tt := range tests {
+		if got := r.Resolve(from, tt.name); got != filepath.Join(dir, tt.expected) {
+			t.Errorf("%s: wrong path. expected=%s, got=%s", tt.name, filepath.Join(dir, tt.expected), got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package module loads the files of a program as modules: each file is parsed once, however many
+// files import it, and a module only sees the names exported by the modules it imports
+package module
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"z/ast"
+	"z/lexer"
+	"z/parser"
+	"z/token"
+)
+
+// Module is a source file of a program with the modules it imports
+type Module struct {
+	Path        string // absolute, the modules are cached by it
+	PackageName string // the namespace its exports are reached with, empty for a file without a package line
+	Program     *ast.Program
+	Imports     []*Module // in the order of the import statements, the prelude first
+}
+
+// Exports are the names a module gives the modules importing it
+func (m *Module) Exports() []string {
+	return Exports(m.Program)
+}
+
+// Exports are the names the file of program exports: its top level declarations written after export,
+// or all of those that do not start with _ when none is
+func Exports(program *ast.Program) []string {
+	all, marked := []string{}, []string{}
+	for _, stmt := range program.Statements {
+		name, exported := declaration(stmt)
+		if name == "" {
+			continue
+		}
+		if exported {
+			marked = append(marked, name)
+		}
+		if !strings.HasPrefix(name, "_") {
+			all = append(all, name)
+		}
+	}
+	if len(marked) > 0 {
+		return marked
+	}
+	return all
+}
+
+// Qualified is the name an export of the module has in the modules importing it
+func (m *Module) Qualified(name string) string {
+	if m.PackageName == "" {
+		return name
+	}
+	return m.PackageName + "." + name
+}
+
+// declaration is the name a top level statement declares and whether it is written after export
+func declaration(stmt ast.Statement) (string, bool) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Name != nil {
+			return stmt.Name.Value, stmt.Exported
+		}
+	case *ast.ExpressionStatement:
+		switch e := stmt.Expression.(type) {
+		case *ast.FunctionLiteral:
+			return e.Name, stmt.Exported
+		case *ast.ClassExpress:
+			if e.Name != nil {
+				return e.Name.Value, stmt.Exported
+			}
+		case *ast.InterfaceExpress:
+			return e.Name.Value, stmt.Exported
+		}
+	}
+	return "", false
+}
+
+// Order is the modules of the program m is the main module of, each one after the modules it imports
+func (m *Module) Order() []*Module {
+	order := []*Module{}
+	seen := map[*Module]bool{}
+	var visit func(m *Module)
+	visit = func(m *Module) {
+		if seen[m] {
+			return
+		}
+		seen[m] = true
+		for _, imported := range m.Imports {
+			visit(imported)
+		}
+		order = append(order, m)
+	}
+	visit(m)
+	return order
+}
+
+// Loader loads the modules of a program
+type Loader struct {
+	resolver *Resolver
+	prelude  string // the module every other one imports first, empty for none
+	modules  map[string]*Module
+	sources  map[string]string // the source of each module, for the snippets of the errors
+	loading  []string          // the modules being loaded, an import of one of them is a cycle
+	errors   []*parser.Error
+}
+
+// NewLoader creates a loader finding imports with resolver, every module imports the prelude of its standard library
+func NewLoader(resolver *Resolver) *Loader {
+	return &Loader{resolver: resolver, prelude: resolver.Prelude(), modules: map[string]*Module{}, sources: map[string]string{}}
+}
+
+// Load loads the module of the file at path and the modules it imports,
+// the error is a parser.ErrorList of the parse and import errors of all of them
+func (l *Loader) Load(path string) (*Module, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return l.LoadSource(path, string(src))
+}
+
+// LoadSource loads src as the module of the file at path, and the modules it imports
+func (l *Loader) LoadSource(path string, src string) (*Module, error) {
+	path = absolute(path)
+	m := l.parse(path, src)
+	if len(l.errors) > 0 {
+		return nil, parser.ErrorList(l.errors)
+	}
+	return m, nil
+}
+
+func (l *Loader) parse(path string, src string) *Module {
+	lex := lexer.New(src)
+	lex.SetFileName(path)
+	p := parser.New(lex)
+	m := &Module{Path: path, Program: p.ParseProgram()}
+	m.PackageName = lex.PackageName
+	l.errors = append(l.errors, p.ParseErrors()...)
+	l.modules[path] = m
+	l.sources[path] = src
+
+	// the prelude and the modules it imports do not import it
+	preluded := l.prelude != "" && path != l.prelude && !l.isLoading(l.prelude)
+	l.loading = append(l.loading, path)
+	defer func() { l.loading = l.loading[:len(l.loading)-1] }()
+	if preluded {
+		if prelude := l.load(l.prelude, token.Position{FileName: path}); prelude != nil {
+			m.Imports = append(m.Imports, prelude)
+		}
+	}
+	for _, stmt := range m.Program.Statements {
+		if imp, ok := stmt.(*ast.ImportStatement); ok {
+			if imported := l.load(l.resolver.Resolve(path, imp.Path), imp.PathPos); imported != nil {
+				m.Imports = append(m.Imports, imported)
+			}
+		}
+	}
+	return m
+}
+
+func (l *Loader) isLoading(path string) bool {
+	for _, loading := range l.loading {
+		if loading == path {
+			return true
+		}
+	}
+	return false
+}
+
+// load is the module of an import, nil when it can not be loaded
+func (l *Loader) load(path string, pos token.Position) *Module {
+	for i, loading := range l.loading {
+		if loading == path {
+			cycle := append(append([]string{}, l.loading[i:]...), path)
+			for j := range cycle {
+				cycle[j] = filepath.Base(cycle[j])
+			}
+			l.addError(pos, "import cycle: "+strings.Join(cycle, " -> "))
+			return nil
+		}
+	}
+	if m, ok := l.modules[path]; ok {
+		return m
+	}
+	src, err := l.resolver.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		l.addError(pos, "import file not exists: "+path)
+		return nil
+	}
+	if err != nil {
+		l.addError(pos, "import file can not be read: "+err.Error())
+		return nil
+	}
+	return l.parse(path, string(src))
+}
+
+func (l *Loader) addError(pos token.Position, msg string) {
+	err := &parser.Error{Pos: pos, Msg: msg}
+	if src, ok := l.sources[pos.FileName]; ok && pos.IsValid() {
+		err.Line = lexer.New(src).Line(pos.Line)
+	}
+	l.errors = append(l.errors, err)
+}
+
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,182 @@
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"standard/builtin.z": "fn helper() { 1 }",
+		"geo.z":              "package geo\nimport \"util\"\nfn area(w, h) { w * h }",
+		"util.z":             "fn twice(x) { x * 2 }",
+		"main.z":             "import \"geo\"\nimport \"./util.z\"\nputs(geo.area(1, 2), twice(3))",
+	})
+	main, err := NewLoader(NewResolver(dir, "")).Load(filepath.Join(dir, "main.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(main.Imports) != 3 {
+		t.Fatalf("wrong number of imports. got=%d", len(main.Imports))
+	}
+	prelude, geo, util := main.Imports[0], main.Imports[1], main.Imports[2]
+	if filepath.Base(prelude.Path) != "builtin.z" || len(prelude.Imports) != 0 {
+		t.Errorf("the prelude is not imported first. got=%s", prelude.Path)
+	}
+	if geo.PackageName != "geo" || geo.Qualified("area") != "geo.area" {
+		t.Errorf("wrong package. got=%q", geo.PackageName)
+	}
+	if geo.Imports[1] != util {
+		t.Errorf("util.z is loaded twice")
+	}
+
+	names := []string{}
+	for _, m := range main.Order() {
+		names = append(names, filepath.Base(m.Path))
+	}
+	if strings.Join(names, " ") != "builtin.z util.z geo.z main.z" {
+		t.Errorf("wrong order. got=%v", names)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"project/z.mod":          "",
+		"project/lib.z":          "",
+		"project/app/main.z":     "",
+		"project/app/string.z":   "",
+		"path/extra.z":           "",
+		"root/standard/string.z": "",
+		"root/standard/array.z":  "",
+	})
+	r := NewResolver(filepath.Join(dir, "root"), filepath.Join(dir, "path")+string(filepath.ListSeparator)+filepath.Join(dir, "none"))
+	app := filepath.Join(dir, "project", "app")
+	expected := []string{app, filepath.Join(dir, "project"), filepath.Join(dir, "path"), filepath.Join(dir, "none"), filepath.Join(dir, "root", "standard")}
+	if got := r.SearchPath(app); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong search path.\nexpected=%v\ngot=     %v", expected, got)
+	}
+
+	from := filepath.Join(app, "main.z")
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"string", "project/app/string.z"},
+		{"lib", "project/lib.z"},
+		{"extra.z", "path/extra.z"},
+		{"array", "root/standard/array.z"},
+		{"./lib", "project/app/lib.z"},
+		{"../lib", "project/lib.z"},
+		{"missing", "project/app/missing.z"},
+	}
+	for _, tt := range tests {
+		if got := r.Resolve(from, tt.name); got != filepath.Join(dir, tt.expected) {
+			t.Errorf("%s: wrong path. expected=%s, got=%s", tt.name, filepath.Join(dir, tt.expected), got)
+		}
+	}
+	if root := ProjectRoot(dir); root != "" {
+		t.Errorf("a project root outside of a project. got=%s", root)
+	}
+}
+
+func TestExports(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1\nlet _b = 2\nfn f() { 1 }\nclass A {}\ninterface I { fn f() {} }\nputs(1)", "a f A I"},
+		{"export let a = 1\nlet b = 2\nexport fn f() { 1 }\nfn g() { 1 }", "a f"},
+	}
+
+	for _, tt := range tests {
+		m, err := NewLoader(NewResolver("", "")).LoadSource("test.z", tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(m.Exports(), " "); got != tt.expected {
+			t.Errorf("wrong exports. expected=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.z":      "import \"b\"",
+		"b.z":      "import \"a\"",
+		"broken.z": "import \"missing\"\nlet = 1",
+	})
+	tests := []struct {
+		file     string
+		expected []string
+	}{
+		{"a.z", []string{"b.z:1:8: import cycle: a.z -> b.z -> a.z"}},
+		{"broken.z", []string{"broken.z:2:5: expected next token to be IDENT", "broken.z:1:8: import file not exists: " + filepath.Join(dir, "missing.z")}},
+	}
+
+	for _, tt := range tests {
+		_, err := NewLoader(NewResolver("", "")).Load(filepath.Join(dir, tt.file))
+		if err == nil {
+			t.Fatalf("%s: no error", tt.file)
+		}
+		for _, expected := range tt.expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%s: the errors miss %q. got=%s", tt.file, expected, err)
+			}
+		}
+	}
+}
+
+func TestEmbeddedStandard(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"root/standard/string.z": "package string\nfn upper(s) { \"disk\" }",
+		"main.z":                 "import \"string\"\nimport \"array\"\nputs(string.upper(\"a\"), array.first([1]), helper())",
+	})
+	r := NewResolver(filepath.Join(dir, "root"), "")
+	r.Embedded = fstest.MapFS{
+		"builtin.z": {Data: []byte("fn helper() { 1 }")},
+		"string.z":  {Data: []byte("package string\nfn upper(s) { \"embedded\" }")},
+		"array.z":   {Data: []byte("package array\nfn first(a) { a[0] }")},
+	}
+
+	if prelude := r.Prelude(); prelude != filepath.Join(EmbeddedStandard, "builtin.z") {
+		t.Errorf("wrong prelude. got=%s", prelude)
+	}
+	expected := []string{filepath.Join(EmbeddedStandard, "array.z"), filepath.Join(EmbeddedStandard, "builtin.z"), filepath.Join(dir, "root", "standard", "string.z")}
+	if got := r.StandardFiles(); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong standard files.\nexpected=%v\ngot=     %v", expected, got)
+	}
+
+	main, err := NewLoader(r).Load(filepath.Join(dir, "main.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := []string{}
+	for _, m := range main.Imports {
+		paths = append(paths, m.Path)
+	}
+	expected = []string{expected[1], expected[2], expected[0]}
+	if strings.Join(paths, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong imports.\nexpected=%v\ngot=     %v", expected, paths)
+	}
+	if name, _ := declaration(main.Imports[2].Program.Statements[0]); name != "first" {
+		t.Errorf("the embedded file is not parsed. got=%q", name)
+	}
+}
@@ -0,0 +1,216 @@
+package module
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EmbeddedStandard is the directory the files of the standard library built into z have their paths in
+const EmbeddedStandard = "embedded:/standard"
+
+// Resolver finds the files imports name, in the directories of its search path
+type Resolver struct {
+	Path      []string             // the directories of Z_PATH
+	Standard  string               // the directory of the standard library, empty for none
+	Embedded  fs.FS                // the standard library built into z, for the files Standard does not have, nil for none
+	manifests map[string]*Manifest // by project root, nil for a z.mod that does not parse
+}
+
+// NewResolver creates a resolver with the standard library of zRoot and the directories of zPath,
+// separated like those of PATH
+func NewResolver(zRoot string, zPath string) *Resolver {
+	r := &Resolver{manifests: map[string]*Manifest{}}
+	if zRoot != "" {
+		r.Standard = absolute(filepath.Join(zRoot, "standard"))
+	}
+	for _, dir := range filepath.SplitList(zPath) {
+		if dir != "" {
+			r.Path = append(r.Path, absolute(dir))
+		}
+	}
+	return r
+}
+
+// Prelude is the path of the module every other one imports first, empty for none
+func (r *Resolver) Prelude() string {
+	if r.Standard != "" {
+		path := filepath.Join(r.Standard, "builtin.z")
+		if r.Embedded == nil || r.isFile(path) {
+			return path
+		}
+	}
+	if r.Embedded != nil {
+		return filepath.Join(EmbeddedStandard, "builtin.z")
+	}
+	return ""
+}
+
+// ReadFile reads the file at a path Resolve returned, on the disk or in the embedded standard library
+func (r *Resolver) ReadFile(path string) ([]byte, error) {
+	if name, ok := embeddedName(path); ok && r.Embedded != nil {
+		return fs.ReadFile(r.Embedded, name)
+	}
+	return os.ReadFile(path)
+}
+
+// StandardFiles are the paths of the files of the standard library, sorted by name.
+// A file of the standard directory overrides the embedded one with its name
+func (r *Resolver) StandardFiles() []string {
+	paths := map[string]string{}
+	if r.Embedded != nil {
+		names, _ := fs.Glob(r.Embedded, "*.z")
+		for _, name := range names {
+			paths[name] = filepath.Join(EmbeddedStandard, name)
+		}
+	}
+	if r.Standard != "" {
+		onDisk, _ := filepath.Glob(filepath.Join(r.Standard, "*.z"))
+		for _, path := range onDisk {
+			paths[filepath.Base(path)] = path
+		}
+	}
+	names := []string{}
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := []string{}
+	for _, name := range names {
+		files = append(files, paths[name])
+	}
+	return files
+}
+
+func (r *Resolver) isFile(path string) bool {
+	if name, ok := embeddedName(path); ok {
+		if r.Embedded == nil {
+			return false
+		}
+		info, err := fs.Stat(r.Embedded, name)
+		return err == nil && !info.IsDir()
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// embeddedName is the name of a file of the embedded standard library in it
+func embeddedName(path string) (string, bool) {
+	if !strings.HasPrefix(path, EmbeddedStandard+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(strings.TrimPrefix(path, EmbeddedStandard+string(filepath.Separator))), true
+}
+
+// SearchPath is the directories the imports of a file in dir are looked for in, in order:
+// dir, the root of its project, the directories of Z_PATH and the standard library, on the disk then embedded
+func (r *Resolver) SearchPath(dir string) []string {
+	dirs := []string{dir}
+	if root := r.projectRoot(dir); root != "" {
+		dirs = append(dirs, root)
+	}
+	dirs = append(dirs, r.Path...)
+	if r.Standard != "" {
+		dirs = append(dirs, r.Standard)
+	}
+	if r.Embedded != nil {
+		dirs = append(dirs, EmbeddedStandard)
+	}
+
+	unique := []string{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
+
+// Resolve is the path of the file an import written in the file from names, .z may be left out.
+// A name starting with ./ or ../ is relative to the directory of from only. The others are looked for in the directory
+// of from, then in the dependency of its project their first element names, then in the rest of the search path.
+// When no file is found it is the path relative to from
+func (r *Resolver) Resolve(from string, name string) string {
+	if !strings.HasSuffix(name, ".z") {
+		name += ".z"
+	}
+	if filepath.IsAbs(name) {
+		return filepath.Clean(name)
+	}
+	dir := filepath.Dir(from)
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		return filepath.Join(dir, name)
+	}
+	candidates := []string{filepath.Join(dir, name)}
+	candidates = append(candidates, r.dependency(dir, name)...)
+	for _, searched := range r.SearchPath(dir) {
+		candidates = append(candidates, filepath.Join(searched, name))
+	}
+	for _, path := range candidates {
+		if r.isFile(path) {
+			return path
+		}
+	}
+	return filepath.Join(dir, name)
+}
+
+// dependency is where the import name of a file in dir is when its first element is a dependency of the project:
+// in the vendor directory, else in the directory the dependency is when it is not a git repository
+func (r *Resolver) dependency(dir string, name string) []string {
+	parts := strings.SplitN(name, "/", 2)
+	root := r.projectRoot(dir)
+	if len(parts) != 2 || root == "" {
+		return nil
+	}
+	manifest, ok := r.manifests[root]
+	if !ok {
+		manifest, _ = ReadManifest(root)
+		if r.manifests == nil {
+			r.manifests = map[string]*Manifest{}
+		}
+		r.manifests[root] = manifest
+	}
+	if manifest == nil {
+		return nil
+	}
+	require := manifest.Require(parts[0])
+	if require == nil {
+		return nil
+	}
+	paths := []string{filepath.Join(root, VendorDir, parts[0], parts[1])}
+	if !require.IsGit() {
+		source := require.Source
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(root, source)
+		}
+		paths = append(paths, filepath.Join(source, parts[1]))
+	}
+	return paths
+}
+
+// projectRoot is the root of the project of the files in dir, the embedded standard library is in none
+func (r *Resolver) projectRoot(dir string) string {
+	if dir == EmbeddedStandard {
+		return ""
+	}
+	return ProjectRoot(dir)
+}
+
+// ProjectRoot is the closest directory from dir up holding a ManifestFile, empty when there is none
+func ProjectRoot(dir string) string {
+	dir = absolute(dir)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ManifestFile)); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
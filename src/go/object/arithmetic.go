@@ -0,0 +1,139 @@
+package object
+
+import "math"
+
+// IsNumber tells whether obj is an integer or a float
+func IsNumber(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *Float:
+		return true
+	}
+	return false
+}
+
+// Arithmetic applies a binary operator to two numbers, the evaluator and the vm share it so that they agree.
+// Two integers give an integer, an integer with a float is promoted to a float. Division by zero,
+// a negative shift and a negative integer exponent are errors, integers wrap around when they overflow
+func Arithmetic(operator string, left, right Object) Object {
+	var result Object
+	leftInteger, leftOk := left.(*Integer)
+	rightInteger, rightOk := right.(*Integer)
+	if leftOk && rightOk {
+		result = integerArithmetic(operator, leftInteger.Value, rightInteger.Value)
+	} else {
+		result = floatArithmetic(operator, toFloat(left), toFloat(right))
+	}
+	if result == nil {
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+	return result
+}
+
+// Compare compares two numbers with a comparison operator, an integer with a float is compared as a float.
+// It is false when operator does not compare
+func Compare(operator string, left, right Object) (result bool, ok bool) {
+	leftInteger, leftOk := left.(*Integer)
+	rightInteger, rightOk := right.(*Integer)
+	if leftOk && rightOk {
+		l, r := leftInteger.Value, rightInteger.Value
+		return compare(operator, l < r, l == r, l > r)
+	}
+	l, r := toFloat(left), toFloat(right)
+	return compare(operator, l < r, l == r, l > r)
+}
+
+// compare is the result of a comparison from the order of its operands, which is none of them for NaN
+func compare(operator string, less, equal, greater bool) (bool, bool) {
+	switch operator {
+	case "<":
+		return less, true
+	case "<=":
+		return less || equal, true
+	case ">":
+		return greater, true
+	case ">=":
+		return greater || equal, true
+	case "==":
+		return equal, true
+	case "!=":
+		return !equal, true
+	}
+	return false, false
+}
+
+func toFloat(obj Object) float64 {
+	if integer, ok := obj.(*Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*Float).Value
+}
+
+// integerArithmetic is nil for the operators integers do not have
+func integerArithmetic(operator string, left, right int64) Object {
+	switch operator {
+	case "+":
+		return &Integer{Value: left + right}
+	case "-":
+		return &Integer{Value: left - right}
+	case "*":
+		return &Integer{Value: left * right}
+	case "/", "%":
+		if right == 0 {
+			return newError("division by zero")
+		}
+		if operator == "/" {
+			return &Integer{Value: left / right}
+		}
+		return &Integer{Value: left % right}
+	case "**":
+		if right < 0 {
+			return newError("negative exponent %d of an integer, use a float", right)
+		}
+		result := int64(1)
+		for ; right > 0; right >>= 1 {
+			if right&1 == 1 {
+				result *= left
+			}
+			left *= left
+		}
+		return &Integer{Value: result}
+	case "&":
+		return &Integer{Value: left & right}
+	case "|":
+		return &Integer{Value: left | right}
+	case "^":
+		return &Integer{Value: left ^ right}
+	case "<<", ">>":
+		if right < 0 {
+			return newError("negative shift count %d", right)
+		}
+		if operator == "<<" {
+			return &Integer{Value: left << uint64(right)}
+		}
+		return &Integer{Value: left >> uint64(right)}
+	}
+	return nil
+}
+
+// floatArithmetic is nil for the operators floats do not have
+func floatArithmetic(operator string, left, right float64) Object {
+	switch operator {
+	case "+":
+		return &Float{Value: left + right}
+	case "-":
+		return &Float{Value: left - right}
+	case "*":
+		return &Float{Value: left * right}
+	case "/", "%":
+		if right == 0 {
+			return newError("division by zero")
+		}
+		if operator == "/" {
+			return &Float{Value: left / right}
+		}
+		return &Float{Value: math.Mod(left, right)}
+	case "**":
+		return &Float{Value: math.Pow(left, right)}
+	}
+	return nil
+}
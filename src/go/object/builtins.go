@@ -7,6 +7,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -20,11 +21,25 @@ import (
 
 var db *sql.DB
 
+// Stdout is where puts writes, tests swap it to capture the output of a program
+var Stdout io.Writer = os.Stdout
+
 type BuiltinFn struct {
 	Name    string
 	Builtin *Builtin
 }
 
+// init adds the builtins of the other files after the list, in the order they came to the language. The vm
+// calls a builtin by its index, so new ones go at the end where they do not move the ones before them
+func init() {
+	Builtins = append(Builtins, fileBuiltins()...)
+	Builtins = append(Builtins, jsonBuiltins()...)
+	Builtins = append(Builtins, stringBuiltins()...)
+	Builtins = append(Builtins, hashBuiltins()...)
+	Builtins = append(Builtins, arrayBuiltins()...)
+	Builtins = append(Builtins, httpBuiltins()...)
+}
+
 var Builtins = []BuiltinFn{
 	{
 		"len",
@@ -36,7 +51,7 @@ var Builtins = []BuiltinFn{
 			case *Array:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				return &Integer{Value: int64(arg.Length())}
 			default:
 				return newError("argument to `len` not supported, got=%s", args[0].Type())
 			}
@@ -46,11 +61,7 @@ var Builtins = []BuiltinFn{
 		"puts",
 		&Builtin{Fn: func(args ...Object) Object {
 			for _, arg := range args {
-				if arg.Inspect() == "\\n" {
-					fmt.Println()
-				} else {
-					fmt.Print(arg.Inspect())
-				}
+				fmt.Fprint(Stdout, arg.Inspect())
 			}
 			return nil
 		}},
@@ -203,37 +214,33 @@ var Builtins = []BuiltinFn{
 			url, _ := urlObject.(*String)
 
 			option := &Hash{}
-			option.Pairs = make(map[HashKey]HashPair)
 			if len(args) == 2 {
 				option, _ = args[1].(*Hash)
 			}
 			client := &http.Client{
 				Timeout: time.Second * 10, // 设置超时时间
 			}
-			methodObject := String{Value: "method"}
-			methodHashPair, ok := option.Pairs[methodObject.HashKey()]
+			methodValue, ok := option.Get(&String{Value: "method"})
 			method := "GET"
 			if ok {
-				method = methodHashPair.Value.Inspect()
+				method = methodValue.Inspect()
 			}
-			bodyObject := String{Value: "body"}
-			bodyHashParir, ok := option.Pairs[bodyObject.HashKey()]
+			bodyValue, ok := option.Get(&String{Value: "body"})
 			body := ""
 			if ok {
-				body = bodyHashParir.Value.Json()
+				body = bodyValue.Json()
 			}
 			method = strings.ToUpper(method)
 			req, err := http.NewRequest(method, url.Value, bytes.NewReader([]byte(body)))
 			if err != nil {
 				return &Error{Message: err.Error()}
 			}
-			headersObject := String{Value: "headers"}
-			headersPair, ok := option.Pairs[headersObject.HashKey()]
+			headersValue, ok := option.Get(&String{Value: "headers"})
 			headers := make(map[string]string)
 			if ok {
-				headersMap, ok := headersPair.Value.(*Hash)
+				headersMap, ok := headersValue.(*Hash)
 				if ok {
-					for _, value := range headersMap.Pairs {
+					for _, value := range headersMap.Pairs() {
 						headers[value.Key.Inspect()] = value.Value.Inspect()
 					}
 				}
@@ -257,12 +264,7 @@ var Builtins = []BuiltinFn{
 	},
 	{
 		"json_encode",
-		&Builtin{Fn: func(args ...Object) Object {
-			if len(args) < 1 {
-				return newError("wrong number of arguments. need more than one, got=%d", len(args))
-			}
-			return &String{Value: args[0].Json()}
-		}},
+		&Builtin{Fn: jsonEncode},
 	},
 	{
 		"with_error",
@@ -353,6 +355,8 @@ var Builtins = []BuiltinFn{
 			objectType := args[0].Type()
 			errorMessage := ""
 			switch objectType { // float, integer, string, bool, hash, array
+			case ERROR_OBJ:
+				errorMessage = args[0].(*Error).Message
 			case STRING_OBJ:
 				returnObj, _ := args[0].(*String)
 				errorMessage = returnObj.Error.Message
@@ -421,16 +425,25 @@ var Builtins = []BuiltinFn{
 			}
 			pid, r2, err := doSyscall(trap, a1, a2, a3)
 			ret := &Hash{}
-			ret.Pairs = make(map[HashKey]HashPair)
-			result1 := String{Value: "result1"}
-			result2 := String{Value: "result2"}
-			error_msg := String{Value: "error_msg"}
-			ret.Pairs[result1.HashKey()] = HashPair{Key: &String{Value: "result1"}, Value: &Integer{Value: int64(pid)}}
-			ret.Pairs[result2.HashKey()] = HashPair{Key: &String{Value: "result2"}, Value: &Integer{Value: int64(r2)}}
-			ret.Pairs[error_msg.HashKey()] = HashPair{Key: &String{Value: "error_msg"}, Value: &String{Value: err.Error()}}
+			ret.Set(&String{Value: "result1"}, &Integer{Value: int64(pid)})
+			ret.Set(&String{Value: "result2"}, &Integer{Value: int64(r2)})
+			ret.Set(&String{Value: "error_msg"}, &String{Value: err.Error()})
 			return ret
 		}},
 	},
+	{
+		"stack_trace",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			err, ok := args[0].(*Error)
+			if !ok {
+				return newError("argument to `stack_trace` must be ERROR, got=%s", args[0].Type())
+			}
+			return &String{Value: err.Stack.String()}
+		}},
+	},
 	{
 		"version",
 		&Builtin{Fn: func(args ...Object) Object {
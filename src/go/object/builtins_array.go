@@ -0,0 +1,247 @@
+package object
+
+import "sort"
+
+func arrayBuiltins() []BuiltinFn {
+	return []BuiltinFn{arrayAppend(), arrayPop(), arrayShift(), arrayInsert(), arrayRemove(), arraySort(), arrayReverse()}
+}
+
+// arrayArgument is argument i of the builtin name when it is an array
+func arrayArgument(name string, args []Object, i int) (*Array, *Error) {
+	array, ok := args[i].(*Array)
+	if !ok {
+		return nil, newError("argument %d to `%s` must be Array, got=%s", i+1, name, args[i].Type())
+	}
+	return array, nil
+}
+
+// integerArgument is argument i of the builtin name when it is an integer
+func integerArgument(name string, args []Object, i int) (int64, *Error) {
+	integer, ok := args[i].(*Integer)
+	if !ok {
+		return 0, newError("argument %d to `%s` must be Integer, got=%s", i+1, name, args[i].Type())
+	}
+	return integer.Value, nil
+}
+
+// arrayAppend adds values to the end of an array in place and is the array, push makes a new one instead
+func arrayAppend() BuiltinFn {
+	return BuiltinFn{
+		"append",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+			}
+			array, err := arrayArgument("append", args, 0)
+			if err != nil {
+				return err
+			}
+			array.Elements = append(array.Elements, args[1:]...)
+			return array
+		}},
+	}
+}
+
+// arrayPop removes the last element of an array and is that element
+func arrayPop() BuiltinFn {
+	return BuiltinFn{
+		"pop",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			array, err := arrayArgument("pop", args, 0)
+			if err != nil {
+				return err
+			}
+			if len(array.Elements) == 0 {
+				return newError("pop from an empty array")
+			}
+			return removeAt(array, len(array.Elements)-1)
+		}},
+	}
+}
+
+// arrayShift removes the first element of an array and is that element
+func arrayShift() BuiltinFn {
+	return BuiltinFn{
+		"shift",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			array, err := arrayArgument("shift", args, 0)
+			if err != nil {
+				return err
+			}
+			if len(array.Elements) == 0 {
+				return newError("shift from an empty array")
+			}
+			return removeAt(array, 0)
+		}},
+	}
+}
+
+// arrayInsert puts a value into an array in place so that it is at the index given afterwards, a negative index
+// counts from the end of the array it makes, -1 appends. It is the array
+func arrayInsert() BuiltinFn {
+	return BuiltinFn{
+		"insert",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			array, err := arrayArgument("insert", args, 0)
+			if err != nil {
+				return err
+			}
+			i, err := integerArgument("insert", args, 1)
+			if err != nil {
+				return err
+			}
+			p, ok := position(i, len(array.Elements)+1)
+			if !ok {
+				return outOfRange(i, len(array.Elements))
+			}
+			array.Elements = append(array.Elements, nil)
+			copy(array.Elements[p+1:], array.Elements[p:])
+			array.Elements[p] = args[2]
+			return array
+		}},
+	}
+}
+
+// arrayRemove removes the element at an index from an array in place and is that element
+func arrayRemove() BuiltinFn {
+	return BuiltinFn{
+		"remove",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			array, err := arrayArgument("remove", args, 0)
+			if err != nil {
+				return err
+			}
+			i, err := integerArgument("remove", args, 1)
+			if err != nil {
+				return err
+			}
+			p, ok := position(i, len(array.Elements))
+			if !ok {
+				return outOfRange(i, len(array.Elements))
+			}
+			return removeAt(array, p)
+		}},
+	}
+}
+
+// removeAt takes the element at p out of array and is that element
+func removeAt(array *Array, p int) Object {
+	element := array.Elements[p]
+	array.Elements = append(array.Elements[:p], array.Elements[p+1:]...)
+	return element
+}
+
+// arraySort sorts an array in place and is the array, a sort keeps equal elements in their order. Without
+// a comparator the elements must all be numbers or all be strings. A comparator is called with two elements
+// and returns a negative number when the first goes before the second, a positive one when it goes after
+func arraySort() BuiltinFn {
+	return BuiltinFn{
+		"sort",
+		&Builtin{CallFn: func(call Caller, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			array, err := arrayArgument("sort", args, 0)
+			if err != nil {
+				return err
+			}
+			compare := compareElements
+			if len(args) == 2 {
+				compare = func(a, b Object) (int, *Error) {
+					return callComparator(call, args[1], a, b)
+				}
+			}
+			// the first error stops the comparisons, the order of the array is left to the sort then
+			var sortErr *Error
+			sort.SliceStable(array.Elements, func(i, j int) bool {
+				if sortErr != nil {
+					return false
+				}
+				order, err := compare(array.Elements[i], array.Elements[j])
+				if err != nil {
+					sortErr = err
+				}
+				return order < 0
+			})
+			if sortErr != nil {
+				return sortErr
+			}
+			return array
+		}},
+	}
+}
+
+// compareElements orders two numbers or two strings
+func compareElements(a, b Object) (int, *Error) {
+	if IsNumber(a) && IsNumber(b) {
+		if less, _ := Compare("<", a, b); less {
+			return -1, nil
+		}
+		if greater, _ := Compare(">", a, b); greater {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	left, leftOk := a.(*String)
+	right, rightOk := b.(*String)
+	if !leftOk || !rightOk {
+		return 0, newError("sort: cannot compare %s with %s, pass a comparator", a.Type(), b.Type())
+	}
+	switch {
+	case left.Value < right.Value:
+		return -1, nil
+	case left.Value > right.Value:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// callComparator is the order the comparator of sort gives two elements
+func callComparator(call Caller, comparator, a, b Object) (int, *Error) {
+	result := call(comparator, a, b)
+	if err, ok := result.(*Error); ok {
+		return 0, err
+	}
+	if !IsNumber(result) {
+		return 0, newError("sort: the comparator must return a number, got=%s", result.Type())
+	}
+	if less, _ := Compare("<", result, &Integer{Value: 0}); less {
+		return -1, nil
+	}
+	if greater, _ := Compare(">", result, &Integer{Value: 0}); greater {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// arrayReverse reverses an array in place and is the array
+func arrayReverse() BuiltinFn {
+	return BuiltinFn{
+		"reverse",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			array, err := arrayArgument("reverse", args, 0)
+			if err != nil {
+				return err
+			}
+			for i, j := 0, len(array.Elements)-1; i < j; i, j = i+1, j-1 {
+				array.Elements[i], array.Elements[j] = array.Elements[j], array.Elements[i]
+			}
+			return array
+		}},
+	}
+}
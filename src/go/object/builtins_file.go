@@ -4,9 +4,8 @@ import (
 	"os"
 )
 
-func init() {
-	Builtins = append(Builtins, filePutContent())
-	Builtins = append(Builtins, fileGetContent())
+func fileBuiltins() []BuiltinFn {
+	return []BuiltinFn{filePutContent(), fileGetContent()}
 }
 
 func filePutContent() BuiltinFn {
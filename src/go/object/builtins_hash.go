@@ -0,0 +1,132 @@
+package object
+
+func hashBuiltins() []BuiltinFn {
+	return []BuiltinFn{hashKeys(), hashValues(), hashDelete(), hashHasKey(), hashMerge()}
+}
+
+// hashArgument is argument i of the builtin name when it is a hash
+func hashArgument(name string, args []Object, i int) (*Hash, *Error) {
+	hash, ok := args[i].(*Hash)
+	if !ok {
+		return nil, newError("argument %d to `%s` must be Hash, got=%s", i+1, name, args[i].Type())
+	}
+	return hash, nil
+}
+
+// keyArgument is argument i of a builtin when it can be a key of a hash
+func keyArgument(args []Object, i int) (Hashable, *Error) {
+	key, ok := args[i].(Hashable)
+	if !ok {
+		return nil, newError("unusable as hash key: %s", args[i].Type())
+	}
+	return key, nil
+}
+
+// hashKeys is the keys of a hash as an array, in the order they were added
+func hashKeys() BuiltinFn {
+	return BuiltinFn{
+		"keys",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, err := hashArgument("keys", args, 0)
+			if err != nil {
+				return err
+			}
+			keys := []Object{}
+			for _, pair := range hash.Pairs() {
+				keys = append(keys, pair.Key)
+			}
+			return &Array{Elements: keys}
+		}},
+	}
+}
+
+// hashValues is the values of a hash as an array, in the order of their keys
+func hashValues() BuiltinFn {
+	return BuiltinFn{
+		"values",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			hash, err := hashArgument("values", args, 0)
+			if err != nil {
+				return err
+			}
+			values := []Object{}
+			for _, pair := range hash.Pairs() {
+				values = append(values, pair.Value)
+			}
+			return &Array{Elements: values}
+		}},
+	}
+}
+
+// hashDelete removes a key from a hash in place, it is true when the hash had the key
+func hashDelete() BuiltinFn {
+	return BuiltinFn{
+		"delete",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			hash, err := hashArgument("delete", args, 0)
+			if err != nil {
+				return err
+			}
+			key, err := keyArgument(args, 1)
+			if err != nil {
+				return err
+			}
+			return nativeBool(hash.Delete(key))
+		}},
+	}
+}
+
+// hashHasKey tells whether a hash has a key, a key with a null value included
+func hashHasKey() BuiltinFn {
+	return BuiltinFn{
+		"has_key",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			hash, err := hashArgument("has_key", args, 0)
+			if err != nil {
+				return err
+			}
+			key, err := keyArgument(args, 1)
+			if err != nil {
+				return err
+			}
+			_, ok := hash.Get(key)
+			return nativeBool(ok)
+		}},
+	}
+}
+
+// hashMerge is a new hash with the pairs of all its arguments, the value of a later hash wins
+// and the keys keep the order they first appear in
+func hashMerge() BuiltinFn {
+	return BuiltinFn{
+		"merge",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+			}
+			merged := &Hash{}
+			for i := range args {
+				hash, err := hashArgument("merge", args, i)
+				if err != nil {
+					return err
+				}
+				for _, pair := range hash.Pairs() {
+					merged.Set(pair.Key.(Hashable), pair.Value)
+				}
+			}
+			return merged
+		}},
+	}
+}
@@ -0,0 +1,167 @@
+package object
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+func httpBuiltins() []BuiltinFn {
+	return []BuiltinFn{httpServer()}
+}
+
+// httpServer serves the routes of a hash until the program ends, a route is a function called with the request,
+// or a hash with the function under "fn" and the headers of the response under "cfg"
+func httpServer() BuiltinFn {
+	return BuiltinFn{
+		"http_server",
+		&Builtin{CallFn: func(call Caller, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument 1 to `http_server` must be String, got=%s", args[0].Type())
+			}
+			server := args[0].(*String).Value
+			if args[1].Type() != HASH_OBJ {
+				return newError("argument 2 to `http_server` must be Hash, got=%s", args[1].Type())
+			}
+			routes := map[string]Object{}
+			configs := map[string]map[string]string{}
+			for _, route := range args[1].(*Hash).Pairs() {
+				path, ok := route.Key.(*String)
+				if !ok {
+					continue
+				}
+				if route.Value.Type() == FUNCTION_OBJ {
+					routes[path.Value] = route.Value
+					continue
+				}
+				config, ok := route.Value.(*Hash)
+				if !ok {
+					continue
+				}
+				if fn, _ := config.Get(&String{Value: "fn"}); fn != nil && fn.Type() == FUNCTION_OBJ {
+					routes[path.Value] = fn
+				}
+				cfg, _ := config.Get(&String{Value: "cfg"})
+				if hashConfig, ok := cfg.(*Hash); ok {
+					headers := make(map[string]string, hashConfig.Len())
+					for _, pair := range hashConfig.Pairs() {
+						headers[pair.Key.Inspect()] = pair.Value.Inspect()
+					}
+					configs[path.Value] = headers
+				}
+			}
+
+			fmt.Println("begin start serve, server address is:", server)
+			fmt.Println("url list as follow:")
+			for route := range routes {
+				fmt.Println(route)
+			}
+			// the engine runs one function of the program at a time, requests wait for the one before them
+			var mu sync.Mutex
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				serveRoute(w, r, call, routes, configs)
+			})
+			fmt.Println("control + c to end the server")
+			err := http.ListenAndServe(server, mux)
+			if errors.Is(err, http.ErrServerClosed) {
+				fmt.Printf("server closed\n")
+			} else if err != nil {
+				fmt.Printf("error starting server: %s\n", err)
+				os.Exit(1)
+			}
+			return nil
+		}},
+	}
+}
+
+func serveRoute(w http.ResponseWriter, r *http.Request, call Caller, routes map[string]Object, configs map[string]map[string]string) {
+	t := time.Now()
+	formatedTime := t.Format("2006-01-02 15:04:05")
+	fmt.Println(formatedTime + " request url is: " + r.URL.Path)
+	path := r.URL.Path
+	fmt.Println(r.URL.Query())
+	body, _ := io.ReadAll(r.Body)
+	fmt.Println(string(body))
+
+	postJson := make(map[string]interface{})
+	err := json.Unmarshal(body, &postJson)
+	request := &Hash{}
+	if err == nil {
+		handlePostData(postJson, request)
+	}
+	handleGetData(r, request)
+
+	function, ok := routes[path]
+	if !ok {
+		io.WriteString(w, "path not found")
+		return
+	}
+	result := call(function, request)
+	if contentType, ok := configs[path]["Content-Type"]; ok {
+		w.Header().Add("Content-Type", contentType)
+	}
+	io.WriteString(w, result.Json())
+}
+func handleGetData(r *http.Request, request *Hash) {
+	getHash := &Hash{}
+	for query, value := range r.URL.Query() {
+		getItemValue := String{Value: ""}
+		if len(value) > 0 {
+			getItemValue.Value = value[0]
+		}
+		getHash.Set(&String{Value: query}, &getItemValue)
+	}
+	request.Set(&String{Value: "get"}, getHash)
+}
+
+func handlePostData(postJson map[string]interface{}, request *Hash) {
+	postHash := &Hash{}
+	for post, value := range postJson {
+		postItemName := String{Value: post}
+		valueStr, ok := value.(string)
+		if ok {
+			postHash.Set(&postItemName, &String{Value: valueStr})
+		}
+
+		valueInt, ok := value.(int)
+		if ok {
+			postHash.Set(&postItemName, &Integer{Value: int64(valueInt)})
+		}
+
+		valueFloat, ok := value.(float64)
+		if ok {
+			postHash.Set(&postItemName, &Float{Value: valueFloat})
+		}
+		array, ok := value.([]interface{})
+		if ok {
+			arrayObj := Array{}
+			for _, item := range array {
+				itemStr, ok := item.(string)
+				if ok {
+					arrayObj.Elements = append(arrayObj.Elements, &String{Value: itemStr})
+				}
+				itemInt, ok := item.(int64)
+				if ok {
+					arrayObj.Elements = append(arrayObj.Elements, &Integer{Value: itemInt})
+				}
+				itemFloat, ok := item.(float64)
+				if ok {
+					arrayObj.Elements = append(arrayObj.Elements, &Float{Value: itemFloat})
+				}
+			}
+			postHash.Set(&postItemName, &arrayObj)
+		}
+	}
+	request.Set(&String{Value: "post"}, postHash)
+}
@@ -0,0 +1,78 @@
+package object
+
+import (
+	"os"
+	"strings"
+)
+
+func jsonBuiltins() []BuiltinFn {
+	return []BuiltinFn{jsonDecode(), jsonStreamFile()}
+}
+
+// jsonEncode is the JSON text of a value, indented when a second argument gives the number of spaces
+// or the string to indent by
+func jsonEncode(args ...Object) Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+	}
+	indent := ""
+	if len(args) == 2 {
+		switch arg := args[1].(type) {
+		case *Integer:
+			if arg.Value < 0 {
+				return newError("argument 2 to `json_encode` must not be negative, got=%d", arg.Value)
+			}
+			indent = strings.Repeat(" ", int(arg.Value))
+		case *String:
+			indent = arg.Value
+		default:
+			return newError("argument 2 to `json_encode` must be Integer or String, got=%s", args[1].Type())
+		}
+	}
+	text, err := EncodeJson(args[0], indent)
+	if err != nil {
+		return newError("json_encode: %s", err)
+	}
+	return &String{Value: text}
+}
+
+// jsonDecode is the value of a JSON text
+func jsonDecode() BuiltinFn {
+	return BuiltinFn{
+		"json_decode",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument 1 to `json_decode` must be String, got=%s", args[0].Type())
+			}
+			value, err := DecodeJson(args[0].(*String).Value)
+			if err != nil {
+				return newError("json_decode: %s", err)
+			}
+			return value
+		}},
+	}
+}
+
+// jsonStreamFile iterates over the values of a JSON file without reading all of it first,
+// for a file holding an array a for in loop gets its elements one at a time
+func jsonStreamFile() BuiltinFn {
+	return BuiltinFn{
+		"json_stream",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument 1 to `json_stream` must be String, got=%s", args[0].Type())
+			}
+			file, err := os.Open(args[0].(*String).Value)
+			if err != nil {
+				return newError("json_stream: %s", err)
+			}
+			return NewJsonStream(file)
+		}},
+	}
+}
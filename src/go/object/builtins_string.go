@@ -0,0 +1,72 @@
+package object
+
+import "unicode/utf8"
+
+func stringBuiltins() []BuiltinFn {
+	return []BuiltinFn{byteLen(), stringBytes(), fromBytes()}
+}
+
+// byteLen is the number of bytes of the UTF-8 of a string, len counts its characters
+func byteLen() BuiltinFn {
+	return BuiltinFn{
+		"byte_len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument 1 to `byte_len` must be String, got=%s", args[0].Type())
+			}
+			return &Integer{Value: int64(len(args[0].(*String).Value))}
+		}},
+	}
+}
+
+// stringBytes is the bytes of a string as an array of integers from 0 to 255
+func stringBytes() BuiltinFn {
+	return BuiltinFn{
+		"bytes",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument 1 to `bytes` must be String, got=%s", args[0].Type())
+			}
+			value := args[0].(*String).Value
+			elements := make([]Object, len(value))
+			for i := 0; i < len(value); i++ {
+				elements[i] = &Integer{Value: int64(value[i])}
+			}
+			return &Array{Elements: elements}
+		}},
+	}
+}
+
+// fromBytes makes a string of an array of bytes, the string may not be valid UTF-8
+func fromBytes() BuiltinFn {
+	return BuiltinFn{
+		"from_bytes",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			array, ok := args[0].(*Array)
+			if !ok {
+				return newError("argument 1 to `from_bytes` must be Array, got=%s", args[0].Type())
+			}
+			value := make([]byte, len(array.Elements))
+			for i, element := range array.Elements {
+				b, ok := element.(*Integer)
+				if !ok || b.Value < 0 || b.Value > 255 {
+					return newError("element %d to `from_bytes` must be an integer from 0 to 255, got=%s", i, element.Inspect())
+				}
+				value[i] = byte(b.Value)
+			}
+			if !utf8.Valid(value) {
+				return newError("argument 1 to `from_bytes` is not UTF-8")
+			}
+			return &String{Value: string(value)}
+		}},
+	}
+}
@@ -1,33 +1,109 @@
 package object
 
+import "z/token"
+
 func NewEnclosedEnviroment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	if outer != nil {
+		env.calls = outer.calls
+	}
 	return env
 }
 
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
 	Context := make(map[string]string)
-	return &Environment{store: s, outer: nil, Context: Context}
+	return &Environment{store: s, outer: nil, Context: Context, calls: &CallStack{}}
 }
 
 type Environment struct {
 	store   map[string]Object
 	Context map[string]string
 	outer   *Environment
+	imports map[string]binding // names of other modules, their values are read where they are declared
+	calls   *CallStack
+	Members bool // holds the fields and methods of a class or an object, they do not hide the builtins
+}
+
+// CallStack is the function calls in progress in one evaluation, innermost last, for the stack traces of errors.
+// The environments of an evaluation share it, evaluations running at the same time have one each
+type CallStack struct {
+	Frames []CallFrame
+	// Debug is called before each statement and after each call returns when it is set,
+	// the evaluation is stopped with the error it returns
+	Debug func(pos token.Position, env *Environment) *Error
+}
+
+// CallFrame is a function call in progress
+type CallFrame struct {
+	Function string
+	CallSite token.Position
+	Caller   *Environment // where the call is made
+	Closure  *Environment // where the called function was defined
+}
+
+// Calls is the call stack of the evaluation e is part of
+func (e *Environment) Calls() *CallStack {
+	return e.calls
+}
+
+// WithCalls makes calls the call stack of e, a function runs in the evaluation that calls it,
+// not in the one that defined it
+func (e *Environment) WithCalls(calls *CallStack) *Environment {
+	e.calls = calls
+	return e
+}
+
+// binding is a name declared in the environment of another module
+type binding struct {
+	env         *Environment
+	name        string
+	packageName string
 }
 
 func (e *Environment) Get(name string, packageName string) (Object, bool) {
+	obj, _, ok := e.Lookup(name, packageName)
+	return obj, ok
+}
+
+// Lookup is Get that also returns the environment the name is found in
+func (e *Environment) Lookup(name string, packageName string) (Object, *Environment, bool) {
 	obj, ok := e.store[name]
 	if !ok && packageName != "" {
 		varName := packageName + "." + name
 		obj, ok = e.store[varName]
 	}
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name, packageName)
+	if !ok {
+		obj, ok = e.getImport(name, packageName)
 	}
-	return obj, ok
+	if ok {
+		return obj, e, true
+	}
+	if e.outer != nil {
+		return e.outer.Lookup(name, packageName)
+	}
+	return nil, nil, false
+}
+
+// Import gives the name declared in the environment of another module a name in this one,
+// it has the value the other module last set
+func (e *Environment) Import(name string, from *Environment, fromName string, fromPackage string) {
+	if e.imports == nil {
+		e.imports = map[string]binding{}
+	}
+	e.imports[name] = binding{env: from, name: fromName, packageName: fromPackage}
+}
+
+func (e *Environment) getImport(name string, packageName string) (Object, bool) {
+	b, ok := e.imports[name]
+	if !ok && packageName != "" {
+		b, ok = e.imports[packageName+"."+name]
+	}
+	if !ok {
+		return nil, false
+	}
+	return b.env.Get(b.name, b.packageName)
 }
 
 func (e *Environment) IsFormOuter(name string, packageName string) bool {
@@ -0,0 +1,121 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash is an ordered map, its pairs keep the order their keys were first added in. The zero value is an empty hash.
+// A deleted pair leaves a hole in pairs, the holes are dropped once they are half of it
+type Hash struct {
+	Error   *Error
+	indexes map[HashKey]int // where the pair of each key is in pairs
+	pairs   []HashPair      // a hole has a nil Key
+	holes   int
+}
+
+// NewHash is a hash of the pairs in their order, a key given twice keeps its first place and its last value
+func NewHash(pairs ...HashPair) *Hash {
+	h := &Hash{}
+	for _, pair := range pairs {
+		h.Set(pair.Key.(Hashable), pair.Value)
+	}
+	return h
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range h.Pairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (h *Hash) Json() string { return lenientJson(h) }
+
+// Get is the value of key, false when the hash does not have key
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	i, ok := h.indexes[key.HashKey()]
+	if !ok {
+		return nil, false
+	}
+	return h.pairs[i].Value, true
+}
+
+// Set gives key a value, a key the hash does not have yet goes after the others
+func (h *Hash) Set(key Hashable, value Object) {
+	hashed := key.HashKey()
+	if i, ok := h.indexes[hashed]; ok {
+		h.pairs[i] = HashPair{Key: key, Value: value}
+		return
+	}
+	if h.indexes == nil {
+		h.indexes = map[HashKey]int{}
+	}
+	h.indexes[hashed] = len(h.pairs)
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+}
+
+// Delete removes key from the hash, it is false when the hash did not have key
+func (h *Hash) Delete(key Hashable) bool {
+	hashed := key.HashKey()
+	i, ok := h.indexes[hashed]
+	if !ok {
+		return false
+	}
+	delete(h.indexes, hashed)
+	h.pairs[i] = HashPair{}
+	h.holes++
+	if h.holes > len(h.pairs)/2 {
+		h.compact()
+	}
+	return true
+}
+
+// Len is the number of pairs of the hash
+func (h *Hash) Len() int {
+	return len(h.indexes)
+}
+
+// Pairs are the pairs of the hash in their order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, h.Len())
+	for _, pair := range h.pairs {
+		if pair.Key != nil {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// compact drops the holes deleted pairs left
+func (h *Hash) compact() {
+	h.pairs = h.Pairs()
+	h.holes = 0
+	for i, pair := range h.pairs {
+		h.indexes[pair.Key.(Hashable).HashKey()] = i
+	}
+}
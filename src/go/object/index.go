@@ -0,0 +1,145 @@
+package object
+
+// position is where index i is in a sequence of length n, a negative index counts from the end,
+// false when it is out of range
+func position(i int64, n int) (int, bool) {
+	if i < 0 {
+		i += int64(n)
+	}
+	if i < 0 || i >= int64(n) {
+		return 0, false
+	}
+	return int(i), true
+}
+
+// Index is left[index], the evaluator and the vm share it so that they agree. Arrays and strings take
+// negative indexes counted from the end, strings count characters, not bytes. An index out of range
+// and a key a hash does not have give null
+func Index(left, index Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			break
+		}
+		p, ok := position(i.Value, len(left.Elements))
+		if !ok {
+			return NULL
+		}
+		return left.Elements[p]
+	case *String:
+		i, ok := index.(*Integer)
+		if !ok {
+			break
+		}
+		p, ok := position(i.Value, left.Length())
+		if !ok {
+			return NULL
+		}
+		ch, _ := left.At(int64(p))
+		return &String{Value: ch}
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		value, ok := left.Get(key)
+		if !ok {
+			return NULL
+		}
+		return value
+	}
+	return newError("index operator not supported: %s", left.Type())
+}
+
+// SetIndex sets left[index] to value in place and is value. The index of an array must be in range,
+// negative ones count from the end, a hash gets a new key when it does not have it
+func SetIndex(left, index, value Object) Object {
+	switch left := left.(type) {
+	case *Array:
+		i, ok := index.(*Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got=%s", index.Type())
+		}
+		p, ok := position(i.Value, len(left.Elements))
+		if !ok {
+			return outOfRange(i.Value, len(left.Elements))
+		}
+		left.Elements[p] = value
+		return value
+	case *Hash:
+		key, ok := index.(Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, value)
+		return value
+	}
+	return newError("index assignment not supported: %s", left.Type())
+}
+
+// Slice is left[low:high], a new array or string of the elements or characters from low up to, not including, high.
+// A nil or null bound is the start or the end, negative bounds count from the end and bounds past either end
+// are moved to it, so a slice out of range is empty rather than an error
+func Slice(left, low, high Object) Object {
+	var n int
+	switch left := left.(type) {
+	case *Array:
+		n = len(left.Elements)
+	case *String:
+		n = left.Length()
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+	from, err := sliceBound(low, 0, n)
+	if err != nil {
+		return err
+	}
+	to, err := sliceBound(high, n, n)
+	if err != nil {
+		return err
+	}
+	if to < from {
+		to = from
+	}
+	if array, ok := left.(*Array); ok {
+		elements := make([]Object, to-from)
+		copy(elements, array.Elements[from:to])
+		return &Array{Elements: elements}
+	}
+	// the byte offsets of the characters, and of the end of the string
+	str := left.(*String).Value
+	offsets := make([]int, 0, n+1)
+	for offset := range str {
+		offsets = append(offsets, offset)
+	}
+	offsets = append(offsets, len(str))
+	return &String{Value: str[offsets[from]:offsets[to]]}
+}
+
+// sliceBound is a bound of a slice of a sequence of length n, missing is the bound a nil or null one stands for
+func sliceBound(bound Object, missing, n int) (int, *Error) {
+	if bound == nil || bound == NULL {
+		return missing, nil
+	}
+	i, ok := bound.(*Integer)
+	if !ok {
+		return 0, newError("slice bounds must be INTEGER, got=%s", bound.Type())
+	}
+	b := i.Value
+	if b < 0 {
+		b += int64(n)
+	}
+	if b < 0 {
+		return 0, nil
+	}
+	if b > int64(n) {
+		return n, nil
+	}
+	return int(b), nil
+}
+
+// outOfRange is the error of an index that is not in an array of length n
+func outOfRange(i int64, n int) *Error {
+	return newError("index %d out of range for array of length %d", i, n)
+}
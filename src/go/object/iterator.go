@@ -0,0 +1,119 @@
+package object
+
+import (
+	"sort"
+	"strings"
+)
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// Iterator walks the elements a for in loop runs over: the elements of an array, the pairs of a hash in the order
+// their keys were added, the characters of a string or the properties of an object by name. It walks the elements
+// the collection had when the loop started. An iterator that streams its values, like json_stream, reads them as the loop goes
+type Iterator struct {
+	keys   []Object // nil for arrays and strings, their keys are the indexes
+	values []Object
+	keyed  bool // a loop with one name gets the keys, not the values
+	next   int
+	stream func() (Object, bool, error) // the next value, false at the end, instead of values
+	close  func()                       // releases what the stream holds
+	err    error
+}
+
+// NewIterator is an iterator over collection, false when collection can not be iterated over
+func NewIterator(collection Object) (*Iterator, bool) {
+	switch collection := collection.(type) {
+	case *Array:
+		values := make([]Object, len(collection.Elements))
+		copy(values, collection.Elements) // the loop may change the array in place
+		return &Iterator{values: values}, true
+	case *String:
+		values := []Object{}
+		for _, ch := range collection.Value {
+			values = append(values, &String{Value: string(ch)})
+		}
+		return &Iterator{values: values}, true
+	case *Hash:
+		it := &Iterator{keyed: true}
+		for _, pair := range collection.Pairs() {
+			it.keys = append(it.keys, pair.Key)
+			it.values = append(it.values, pair.Value)
+		}
+		return it, true
+	case *ObjectInstance:
+		it := &Iterator{keyed: true}
+		properties := collection.Environment.GetAll()
+		for _, name := range collection.Properties() {
+			it.keys = append(it.keys, &String{Value: name})
+			it.values = append(it.values, properties[name])
+		}
+		return it, true
+	case *Iterator:
+		return collection, true
+	}
+	return nil, false
+}
+
+// Next gives the names of a loop the next element: the key and the value for two names, for one name
+// the key of a hash or an object and the value of an array or a string. It is false when there are no more elements
+func (it *Iterator) Next(names int) ([]Object, bool) {
+	var value Object
+	if it.stream != nil {
+		var ok bool
+		value, ok, it.err = it.stream()
+		if !ok {
+			return nil, false
+		}
+	} else if it.next < len(it.values) {
+		value = it.values[it.next]
+	} else {
+		return nil, false
+	}
+	var key Object
+	if it.keys != nil {
+		key = it.keys[it.next]
+	} else {
+		key = &Integer{Value: int64(it.next)}
+	}
+	it.next++
+	if names == 2 {
+		return []Object{key, value}, true
+	}
+	if it.keyed {
+		return []Object{key}, true
+	}
+	return []Object{value}, true
+}
+
+// Close releases what a streaming iterator holds, like the file of json_stream. A for in loop closes its iterator
+// when it is left, at the end or early with break or return, a closed stream has no more elements
+func (it *Iterator) Close() {
+	if it.close != nil {
+		it.close()
+	}
+}
+
+// Err is why a streaming iterator stopped before its end, nil when it did not
+func (it *Iterator) Err() error { return it.err }
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "iterator" }
+func (it *Iterator) Json() string     { return "\"iterator\"" }
+
+// Properties are the names of the fields of the object that are not methods, sorted,
+// the private ones starting with _ are left out
+func (oi *ObjectInstance) Properties() []string {
+	names := []string{}
+	for name, value := range oi.Environment.GetAll() {
+		switch value.(type) {
+		case *Function, *Closure, *Builtin:
+			continue
+		}
+		if name == "this" || strings.HasPrefix(name, "_") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
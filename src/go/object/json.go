@@ -0,0 +1,372 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxJsonDepth is how deep arrays and objects may nest in decoded JSON
+const maxJsonDepth = 10000
+
+// jsonEncoder writes values as RFC 8259 JSON. A strict encoder fails on the values JSON has no form for,
+// functions, classes and the like, and on a value that contains itself. The Json methods use a lenient one
+// that writes them as strings and a value inside itself as null
+type jsonEncoder struct {
+	out    bytes.Buffer
+	indent string // each level of nesting is indented by it, on a line of its own, compact when empty
+	strict bool
+	seen   map[Object]bool // the arrays, hashes and objects being written
+}
+
+// EncodeJson is the JSON text of obj, indented by indent when it is not empty
+func EncodeJson(obj Object, indent string) (string, error) {
+	e := &jsonEncoder{indent: indent, strict: true, seen: map[Object]bool{}}
+	if err := e.encode(obj, 0); err != nil {
+		return "", err
+	}
+	return e.out.String(), nil
+}
+
+// lenientJson is the compact JSON text of obj for its Json method
+func lenientJson(obj Object) string {
+	e := &jsonEncoder{seen: map[Object]bool{}}
+	e.encode(obj, 0)
+	return e.out.String()
+}
+
+func (e *jsonEncoder) encode(obj Object, depth int) error {
+	switch obj := obj.(type) {
+	case *Null:
+		e.out.WriteString("null")
+	case *Boolean, *Integer:
+		e.out.WriteString(obj.Inspect())
+	case *Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			if e.strict {
+				return fmt.Errorf("cannot encode %v", obj.Value)
+			}
+			e.out.WriteString("null")
+			return nil
+		}
+		e.out.WriteString(jsonFloat(obj.Value))
+	case *String:
+		e.out.WriteString(quoteJson(obj.Value))
+	case *Array:
+		return e.container(obj, depth, "[", "]", len(obj.Elements), func(i int) error {
+			return e.encode(obj.Elements[i], depth+1)
+		})
+	case *Hash:
+		pairs := obj.Pairs()
+		return e.container(obj, depth, "{", "}", len(pairs), func(i int) error {
+			e.out.WriteString(quoteJson(jsonKey(pairs[i].Key)))
+			e.out.WriteString(": ")
+			return e.encode(pairs[i].Value, depth+1)
+		})
+	case *ObjectInstance:
+		names := obj.Properties()
+		properties := obj.Environment.GetAll()
+		return e.container(obj, depth, "{", "}", len(names), func(i int) error {
+			e.out.WriteString(quoteJson(names[i]))
+			e.out.WriteString(": ")
+			return e.encode(properties[names[i]], depth+1)
+		})
+	default:
+		if e.strict {
+			return fmt.Errorf("cannot encode %s", obj.Type())
+		}
+		e.out.WriteString(obj.Json())
+	}
+	return nil
+}
+
+// container writes the n elements of an array or an object between open and close, one per line when indenting
+func (e *jsonEncoder) container(obj Object, depth int, open, close string, n int, element func(i int) error) error {
+	if e.seen[obj] {
+		if e.strict {
+			return fmt.Errorf("cannot encode %s that contains itself", obj.Type())
+		}
+		e.out.WriteString("null")
+		return nil
+	}
+	e.seen[obj] = true
+	defer delete(e.seen, obj)
+
+	e.out.WriteString(open)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			e.out.WriteString(",")
+			if e.indent == "" {
+				e.out.WriteString(" ")
+			}
+		}
+		e.newline(depth + 1)
+		if err := element(i); err != nil {
+			return err
+		}
+	}
+	if n > 0 {
+		e.newline(depth)
+	}
+	e.out.WriteString(close)
+	return nil
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.indent == "" {
+		return
+	}
+	e.out.WriteString("\n")
+	e.out.WriteString(strings.Repeat(e.indent, depth))
+}
+
+// jsonKey is the name a key of a hash has in JSON, where names are strings
+func jsonKey(key Object) string {
+	if s, ok := key.(*String); ok {
+		return s.Value
+	}
+	return key.Inspect()
+}
+
+// jsonFloat writes a float so that it is decoded as a float again, 1.0 is not 1
+func jsonFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// quoteJson is s as a JSON string, quotes, backslashes and control characters escaped,
+// invalid UTF-8 is decoded, and written, as U+FFFD
+func quoteJson(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); {
+		ch, width := utf8.DecodeRuneInString(s[i:])
+		i += width
+		switch {
+		case ch == '"':
+			out.WriteString(`\"`)
+		case ch == '\\':
+			out.WriteString(`\\`)
+		case ch == '\n':
+			out.WriteString(`\n`)
+		case ch == '\r':
+			out.WriteString(`\r`)
+		case ch == '\t':
+			out.WriteString(`\t`)
+		case ch < 0x20:
+			fmt.Fprintf(&out, `\u%04x`, ch)
+		default:
+			out.WriteRune(ch)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// DecodeJson is the value of the JSON text, objects become hashes keeping the order of their keys,
+// numbers become integers when they have no fraction or exponent and fit in 64 bits, else floats
+func DecodeJson(text string) (Object, error) {
+	// the scanner of Unmarshal checks the whole text first, its errors tell the character that is wrong
+	var raw json.RawMessage
+	if err := json.Unmarshal([]byte(text), &raw); err != nil {
+		var syntaxError *json.SyntaxError
+		if !errors.As(err, &syntaxError) {
+			return nil, err
+		}
+		// the offset is just after the character that is wrong, or the end of the text
+		offset := int(syntaxError.Offset) - 1
+		if offset == len(text)-1 && strings.HasPrefix(err.Error(), "unexpected end") {
+			offset = len(text)
+		}
+		return nil, fmt.Errorf("%s at %s", err, jsonPosition(text, offset))
+	}
+	return decodeJsonValue(newJsonDecoder(strings.NewReader(text)), nil, 0)
+}
+
+func newJsonDecoder(r io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	return decoder
+}
+
+// decodeJsonValue reads the next value from decoder, starting with token when it is already read
+func decodeJsonValue(decoder *json.Decoder, token json.Token, depth int) (Object, error) {
+	if token == nil {
+		var err error
+		token, err = decoder.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if depth > maxJsonDepth {
+		return nil, fmt.Errorf("nested deeper than %d", maxJsonDepth)
+	}
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			array := &Array{Elements: []Object{}}
+			for decoder.More() {
+				element, err := decodeJsonValue(decoder, nil, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				array.Elements = append(array.Elements, element)
+			}
+			return array, closeJson(decoder)
+		}
+		hash := &Hash{}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJsonValue(decoder, nil, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(&String{Value: keyToken.(string)}, value)
+		}
+		return hash, closeJson(decoder)
+	case json.Number:
+		if integer, err := token.Int64(); err == nil {
+			return &Integer{Value: integer}, nil
+		}
+		float, err := token.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return &Float{Value: float}, nil
+	case string:
+		return &String{Value: token}, nil
+	case bool:
+		return nativeBool(token), nil
+	default:
+		return NULL, nil
+	}
+}
+
+// closeJson reads the ] or } that ends an array or an object
+func closeJson(decoder *json.Decoder) error {
+	_, err := decoder.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// jsonErrorMessage is the message of an error decoding JSON
+func jsonErrorMessage(err error) string {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return "unexpected end of JSON input"
+	}
+	return err.Error()
+}
+
+// jsonPosition is the line:column of the character at offset in text, counted from 1
+func jsonPosition(text string, offset int) string {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := 1 + strings.Count(text[:offset], "\n")
+	column := 1 + utf8.RuneCountInString(text[strings.LastIndex(text[:offset], "\n")+1:offset])
+	return fmt.Sprintf("%d:%d", line, column)
+}
+
+// jsonStream decodes the values of a JSON file one at a time: the elements of the array when the file is an array,
+// else each of the values the file holds one after the other, like a file of JSON lines
+type jsonStream struct {
+	decoder *json.Decoder
+	closer  io.Closer
+	started bool
+	inArray bool
+	done    bool
+}
+
+// NewJsonStream is an iterator over the values of the JSON read from r, it closes r when it is done or closed
+func NewJsonStream(r io.ReadCloser) *Iterator {
+	stream := &jsonStream{decoder: newJsonDecoder(r), closer: r}
+	return &Iterator{stream: stream.next, close: stream.close}
+}
+
+// close ends the stream before its end, when the loop over it is left early
+func (s *jsonStream) close() {
+	if !s.done {
+		s.done = true
+		s.closer.Close()
+	}
+}
+
+func (s *jsonStream) next() (Object, bool, error) {
+	if s.done {
+		return nil, false, nil
+	}
+	value, ok, err := s.read()
+	if !ok || err != nil {
+		s.done = true
+		s.closer.Close()
+	}
+	if err != nil {
+		offset := s.decoder.InputOffset()
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			offset = syntaxError.Offset - 1
+		}
+		return nil, false, fmt.Errorf("json_stream: %s at byte %d", jsonErrorMessage(err), offset)
+	}
+	return value, ok, nil
+}
+
+func (s *jsonStream) read() (Object, bool, error) {
+	if !s.started {
+		s.started = true
+		token, err := s.decoder.Token()
+		if err == io.EOF {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if token != json.Delim('[') {
+			value, err := decodeJsonValue(s.decoder, token, 0)
+			return value, err == nil, err
+		}
+		s.inArray = true
+	}
+	if s.inArray {
+		if s.decoder.More() {
+			value, err := decodeJsonValue(s.decoder, nil, 1)
+			return value, err == nil, err
+		}
+		if err := closeJson(s.decoder); err != nil {
+			return nil, false, err
+		}
+		if _, err := s.decoder.Token(); err != io.EOF {
+			return nil, false, errors.New("unexpected data after the JSON array")
+		}
+		return nil, false, nil
+	}
+	token, err := s.decoder.Token()
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	value, err := decodeJsonValue(s.decoder, token, 0)
+	return value, err == nil, err
+}
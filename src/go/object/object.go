@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
 	"strings"
+	"unicode/utf8"
 	"z/ast"
 	"z/code"
+	"z/token"
 )
 
 type ObjectType string
@@ -69,17 +72,93 @@ func (b *Boolean) HashKey() HashKey {
 type Null struct {
 }
 
+// TRUE, FALSE and NULL are shared by the evaluator, the vm and the builtins, == compares them by identity
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+func nativeBool(value bool) *Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
 func (n *Null) Inspect() string  { return "null" }
-func (n *Null) Json() string     { return "\"null\"" }
+func (n *Null) Json() string     { return "null" }
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 
+const (
+	RUNTIME_ERROR = "RuntimeError" // raised by the interpreter itself
+	THROWN_ERROR  = "Error"        // raised by a throw statement
+)
+
 type Error struct {
-	Message string
+	Message   string
+	Position  token.Position // where the error was raised, zero when unknown
+	Stack     Stack          // calls active when the error was raised, innermost first
+	ErrorType string         // RUNTIME_ERROR when empty
+	Value     Object         // the thrown value for THROWN_ERROR
+	Caught    bool           // a caught error is an ordinary value and no longer unwinds evaluation
+}
+
+func (e *Error) Kind() string {
+	if e.ErrorType == "" {
+		return RUNTIME_ERROR
+	}
+	return e.ErrorType
+}
+
+// Field returns what err->name evaluates to, nil when the error has no such field
+func (e *Error) Field(name string) Object {
+	switch name {
+	case "message":
+		return &String{Value: e.Message}
+	case "type":
+		return &String{Value: e.Kind()}
+	case "stack":
+		return &String{Value: e.Stack.String()}
+	case "value":
+		return e.Value
+	}
+	return nil
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
-func (e *Error) Json() string     { return "\"error:" + e.Message + "\"" }
+func (e *Error) Inspect() string {
+	if e.Position.IsValid() {
+		return "ERROR: " + e.Position.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+func (e *Error) Json() string { return quoteJson("error:" + e.Message) }
+
+// StackFrame is one active call in a stack trace, Position is where execution was inside Function
+type StackFrame struct {
+	Function string
+	Position token.Position
+}
+
+func (sf StackFrame) String() string {
+	if !sf.Position.IsValid() {
+		return sf.Function
+	}
+	return fmt.Sprintf("%s (%s)", sf.Function, sf.Position)
+}
+
+type Stack []StackFrame
+
+func (s Stack) String() string {
+	var out bytes.Buffer
+	for _, frame := range s {
+		out.WriteString("\tat ")
+		out.WriteString(frame.String())
+		out.WriteString("\n")
+	}
+	return out.String()
+}
 
 type ReturnValue struct {
 	Value Object
@@ -98,30 +177,52 @@ type Function struct {
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
 func (f *Function) Inspect() string {
+	return FunctionSource(f.Parameters, f.Body)
+}
+func (rv *Function) Json() string { return "\"function\"" }
+
+// FunctionSource is how a function shows when it is inspected, in both engines
+func FunctionSource(parameters []*ast.Identifier, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range f.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 	out.WriteString("fn")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(("} {\n"))
-	out.WriteString(f.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n")
 
 	return out.String()
 }
-func (rv *Function) Json() string { return "\"function\"" }
 
 type String struct {
 	Value string
 	Error *Error
 }
 
+// Length is the number of characters of the string, its unicode code points, not its bytes
+func (s *String) Length() int { return utf8.RuneCountInString(s.Value) }
+
+// At is the character at index i of the string, counted in code points, false when there is none
+func (s *String) At(i int64) (string, bool) {
+	if i < 0 {
+		return "", false
+	}
+	for offset, ch := range s.Value {
+		if i == 0 {
+			return s.Value[offset : offset+utf8.RuneLen(ch)], true
+		}
+		i--
+	}
+	return "", false
+}
+
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
-func (s *String) Json() string     { return "\"" + s.Value + "\"" }
+func (s *String) Json() string     { return quoteJson(s.Value) }
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -129,14 +230,20 @@ func (s *String) HashKey() HashKey {
 }
 
 type BuiltinFunction = func(args ...Object) Object
+
+// Caller calls a function of the program from a builtin, the engine running the program provides it.
+// An error the function raises is returned as an *Error
+type Caller func(fn Object, args ...Object) Object
+
 type Builtin struct {
 	Fn       BuiltinFunction
+	CallFn   func(call Caller, args ...Object) Object // instead of Fn for builtins that call functions of the program
 	FilePath string
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
-func (b *Builtin) Json() string     { return "builtin function" }
+func (b *Builtin) Json() string     { return "\"builtin function\"" }
 
 type Array struct {
 	Elements []Object
@@ -157,98 +264,47 @@ func (ao *Array) Inspect() string {
 	out.WriteString("]")
 	return out.String()
 }
-func (ao *Array) Json() string {
-	var out bytes.Buffer
-	elements := []string{}
-
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Json())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-	return out.String()
-}
-
-type HashKey struct {
-	Type  ObjectType
-	Value uint64
-}
-
-type HashPair struct {
-	Key   Object
-	Value Object
-	Index int8
-}
-
-type Hash struct {
-	Pairs    map[HashKey]HashPair
-	Error    *Error
-	MaxIndex int8
-}
-
-func (h *Hash) Type() ObjectType {
-	return HASH_OBJ
-}
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
-	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-	return out.String()
-}
-
-func (h *Hash) Json() string {
-	var out bytes.Buffer
-	pairs := []string{}
-	maxIndex := h.MaxIndex
-	for i := 1; i <= int(maxIndex); i++ {
-		for _, pair := range h.Pairs {
-			if pair.Index == int8(i) {
-				pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Json(), pair.Value.Json()))
-			}
-		}
-	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-	return out.String()
-}
-
-type Hashable interface {
-	HashKey() HashKey
-}
+func (ao *Array) Json() string { return lenientJson(ao) }
 
 type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	NumDefaults   int // trailing parameters that may be left out, they get their default value
+	SourceMap     code.SourceMap
+	Name          string
+	LocalNames    []string // names of the locals by index, the parameters come first
+	FreeNames     []string // names of the free variables by index
+	Source        string   // the function as FunctionSource shows it
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJECT }
 func (cf *CompiledFunction) Inspect() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	return cf.Source
 }
 func (cf *CompiledFunction) Json() string {
-	return fmt.Sprintf("CompiledFunction[%p]", cf)
+	return quoteJson(cf.Inspect())
 }
 
 type Closure struct {
-	Fn   *CompiledFunction
-	Free []Object
+	Fn     *CompiledFunction
+	Free   []Object
+	This   Object       // object or class a method is bound to, nil for plain functions
+	Fields *Environment // where a bound method finds the members of its class
+}
+
+// Bind returns a copy of the closure running as a method of this
+func (c *Closure) Bind(this Object, fields *Environment) *Closure {
+	return &Closure{Fn: c.Fn, Free: c.Free, This: this, Fields: fields}
 }
 
-func (c *Closure) Type() ObjectType { return CLOSURE_OBJ }
+// Type is FUNCTION_OBJ so that closures look the same as evaluator functions to scripts
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
 func (c *Closure) Inspect() string {
-	return fmt.Sprintf("Closure[%p]", c)
+	return c.Fn.Inspect()
 }
 func (c *Closure) Json() string {
-	return fmt.Sprintf("Closure[%p]", c)
+	return "\"function\""
 }
 
 type Float struct {
@@ -257,10 +313,10 @@ type Float struct {
 }
 
 func (f *Float) Inspect() string  { return fmt.Sprintf("%v", f.Value) }
-func (f *Float) Json() string     { return fmt.Sprintf("%v", f.Value) }
+func (f *Float) Json() string     { return lenientJson(f) }
 func (f *Float) Type() ObjectType { return FLOAT_OBJ }
 func (f *Float) HashKey() HashKey {
-	return HashKey{Type: f.Type(), Value: uint64(f.Value)}
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
 }
 
 type Interface struct {
@@ -269,7 +325,7 @@ type Interface struct {
 }
 
 func (i *Interface) Inspect() string  { return fmt.Sprintf("interface %s", i.Name) }
-func (i *Interface) Json() string     { return fmt.Sprintf("interface %s", i.Name) }
+func (i *Interface) Json() string     { return quoteJson(i.Inspect()) }
 func (i *Interface) Type() ObjectType { return CLASS_OBJ }
 
 type Class struct {
@@ -280,7 +336,7 @@ type Class struct {
 }
 
 func (c *Class) Inspect() string  { return fmt.Sprintf("interface %s", c.Name) }
-func (c *Class) Json() string     { return fmt.Sprintf("interface %s", c.Name) }
+func (c *Class) Json() string     { return quoteJson(c.Inspect()) }
 func (c *Class) Type() ObjectType { return CLASS_OBJ }
 
 type ObjectInstance struct {
@@ -291,5 +347,5 @@ type ObjectInstance struct {
 func (oi *ObjectInstance) Inspect() string {
 	return fmt.Sprintf("object %s", oi.InstanceClass.Name)
 }
-func (oi *ObjectInstance) Json() string     { return fmt.Sprintf("object %s", oi.InstanceClass.Name) }
+func (oi *ObjectInstance) Json() string     { return lenientJson(oi) }
 func (oi *ObjectInstance) Type() ObjectType { return OBJECT_INSTANCE }
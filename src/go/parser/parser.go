@@ -4,17 +4,14 @@ package parser
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"unicode"
 	"z/ast"
 	"z/lexer"
 	"z/token"
 )
 
-var runSourceDir = ""
-
 type (
 	prefixParseFn func() ast.Expression
 	infixPasrseFn func(ast.Expression) ast.Expression
@@ -25,12 +22,14 @@ const (
 	LOWEST
 	ASSIGN
 	QUESTION
+	NULLISH
 	LOGIC
 	EQUALS
 	LESSGRATER
 	SUM
 	PRODUCT
 	PREFIX
+	POWER // above PREFIX, -2 ** 2 is -(2 ** 2)
 	CALL
 	INDEX
 )
@@ -56,16 +55,87 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:          SUM,
 	token.SLASH:          PRODUCT,
 	token.ASTERISK:       PRODUCT,
+	token.PERCENT:        PRODUCT,
+	token.BIT_AND:        PRODUCT,
+	token.SHIFT_LEFT:     PRODUCT,
+	token.SHIFT_RIGHT:    PRODUCT,
+	token.BIT_OR:         SUM,
+	token.BIT_XOR:        SUM,
+	token.POWER:          POWER,
 	token.LPAREN:         CALL,
 	token.LBRACKET:       INDEX,
 	token.OBJET_GET:      INDEX,
 	token.CLASS_GET:      INDEX,
+	token.OPTIONAL_GET:   INDEX,
+	token.OPTIONAL_INDEX: INDEX,
 	token.QUESTION:       QUESTION,
+	token.NULLISH:        NULLISH,
+}
+
+// Error is a parse error and the source position it was found at
+type Error struct {
+	Pos  token.Position
+	Msg  string
+	Line string // the source line the error is on
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+// Snippet is the source line of the error with a caret under its column, empty when the line is not known
+func (e *Error) Snippet() string {
+	if e.Line == "" || !e.Pos.IsValid() {
+		return ""
+	}
+	caret := []rune{}
+	for i, ch := range []rune(e.Line) {
+		if i >= e.Pos.Column-1 {
+			break
+		}
+		switch {
+		case ch == '\t':
+			caret = append(caret, '\t')
+		case wide(ch):
+			caret = append(caret, ' ', ' ')
+		default:
+			caret = append(caret, ' ')
+		}
+	}
+	return e.Line + "\n" + string(caret) + "^"
+}
+
+// wide tells whether a terminal shows ch in two columns, like the CJK characters
+func wide(ch rune) bool {
+	return unicode.In(ch, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana) ||
+		0xff01 <= ch && ch <= 0xff60 || 0x3000 <= ch && ch <= 0x303f
+}
+
+// ErrorList is the errors of a program that does not parse, printed with their snippets
+type ErrorList []*Error
+
+func (errs ErrorList) Error() string {
+	messages := []string{}
+	for _, err := range errs {
+		message := err.Error()
+		if snippet := err.Snippet(); snippet != "" {
+			message += "\n\t" + strings.ReplaceAll(snippet, "\n", "\n\t")
+		}
+		messages = append(messages, message)
+	}
+	return strings.Join(messages, "\n")
 }
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l           *lexer.Lexer
+	errors      []string
+	parseErrors []*Error
+
+	panicking bool // the statement being parsed has an error, the errors following from it are not reported
+	lexErrors int  // the errors of the lexer reported so far
 
 	curToken  token.Token
 	peekToken token.Token
@@ -74,6 +144,8 @@ type Parser struct {
 	infixPasrseFns map[token.TokenType]infixPasrseFn
 
 	tokenCount int
+
+	labels []string // labels of the loops around the code being parsed, in the current function
 }
 
 var initReadCount int = 2
@@ -99,6 +171,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.ASTERISK, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.BIT_AND, p.parseInfixExpression)
+	p.registerInfix(token.BIT_OR, p.parseInfixExpression)
+	p.registerInfix(token.BIT_XOR, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
@@ -109,11 +188,13 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.OR, p.parseInfixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
@@ -127,14 +208,19 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.MINUSMINUS, p.parseInfixExpression)
 	p.registerInfix(token.ASSIGN, p.parseInfixExpression)
 	p.registerPrefix(token.BREAK, p.parseBreakExpression)
+	p.registerPrefix(token.CONTINUE, p.parseContinueExpression)
 	p.registerPrefix(token.FOR, p.parseForExpression)
 	p.registerPrefix(token.CLASS, p.parseClassExpression)
 	p.registerPrefix(token.INTERFACE, p.parseInterfaceExpress)
 	p.registerPrefix(token.NEW, p.parseNewExpression)
 	p.registerInfix(token.OBJET_GET, p.parseInfixExpression)
 	p.registerInfix(token.CLASS_GET, p.parseInfixExpression)
+	p.registerInfix(token.OPTIONAL_GET, p.parseInfixExpression)
+	p.registerInfix(token.OPTIONAL_INDEX, p.parseIndexExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
 	p.registerPrefix(token.DEFER, p.parseDeferExpression)
 	p.registerInfix(token.QUESTION, p.parseQuestionExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
 	return p
 }
 
@@ -142,6 +228,16 @@ func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
 	p.tokenCount = p.tokenCount + 1
+	// the lexer still made a token of what it could not read, so the parse goes on without panic mode
+	for ; p.lexErrors < len(p.l.Errors); p.lexErrors++ {
+		p.addLexError(p.l.Errors[p.lexErrors])
+	}
+}
+
+func (p *Parser) addLexError(lexError lexer.Error) {
+	err := &Error{Pos: lexError.Pos, Msg: lexError.Msg, Line: p.l.Line(lexError.Pos.Line)}
+	p.parseErrors = append(p.parseErrors, err)
+	p.errors = append(p.errors, err.Error())
 }
 
 func (p *Parser) nextNextToken() {
@@ -153,6 +249,11 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// ParseErrors are the errors of Errors with their positions
+func (p *Parser) ParseErrors() []*Error {
+	return p.parseErrors
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 
@@ -160,50 +261,49 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 	for p.curToken.Type != token.EOF {
 		if p.curToken.Type == token.IMPORT {
-			p.parseImportFile(program, p.peekToken.Literal)
+			stmt := p.parseImportStatement()
+			if !p.panicking {
+				program.Statements = append(program.Statements, stmt)
+			}
 		} else {
 			stmt := p.parseStatement()
+			if p.panicking { // a statement with an error is left out
+				stmt = nil
+			}
 			if stmt != nil {
 				program.Statements = append(program.Statements, stmt)
 			}
 		}
+		if p.panicking {
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 
 	return program
 }
 
-func (p *Parser) parseImportFile(program *ast.Program, fileName string) {
-	if runSourceDir != "" {
-		if !strings.HasSuffix(fileName, ".z") {
-			fileName = fileName + ".z"
-		}
-		if !strings.Contains(fileName, "builtin.z") {
-			fileDir := filepath.Dir(p.l.FileName)
-			fileDirArr := strings.Split(fileDir, runSourceDir)
-			if len(fileDirArr) > 1 {
-				fileName = runSourceDir + fileDirArr[1] + "/" + fileName
-			} else {
-				fileName = runSourceDir + "/" + fileName
-			}
-		}
+// synchronize skips the rest of a statement with an error, up to the ; ending it or the } closing its block,
+// so that the parsing goes on with the next statement
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) &&
+		!p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken()
 	}
-	if _, err := os.Stat(fileName); err != nil {
-		if os.IsNotExist(err) {
-			fmt.Println("import file not exists: " + fileName)
-			os.Exit(1)
-		}
+	p.panicking = false
+}
+
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{Token: p.curToken}
+	if !p.expectPeek(token.STRING) {
+		return stmt
 	}
-	importCode, err := os.ReadFile(fileName)
-	if err != nil {
-		panic(err)
+	stmt.Path = p.curToken.Literal
+	stmt.PathPos = p.curToken.Pos
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
 	}
-	importLexer := lexer.New(string(importCode))
-	importParser := New(importLexer)
-	importLexer.SetFileName(fileName)
-	importProgram := importParser.ParseProgram()
-	program.Statements = append(program.Statements, importProgram.Statements...)
-	p.nextToken() // remove file path string
+	return stmt
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -214,14 +314,76 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseReturnStatement()
 	case token.PACKAGE:
 		return p.parsePackageStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.IDENT:
+		if p.peekTokenIs(token.COLON) {
+			return p.parseLabeledStatement()
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+// parseLabeledStatement parses a loop with a label in front, break and continue in the loop may name it
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal, FileName: p.l.FileName, PackageName: p.l.PackageName}
+	p.nextToken()
+	if !p.peekTokenIs(token.FOR) && !p.peekTokenIs(token.WHILE) {
+		p.addError(label.Pos(), fmt.Sprintf("label %s must be followed by for or while", label.Value))
+		return nil
+	}
+	for _, outer := range p.labels {
+		if outer == label.Value {
+			p.addError(label.Pos(), fmt.Sprintf("label %s already defined", label.Value))
+		}
+	}
+	p.nextToken()
+	p.labels = append(p.labels, label.Value)
+	stmt := p.parseExpressionStatement()
+	p.labels = p.labels[:len(p.labels)-1]
+	switch loop := stmt.(*ast.ExpressionStatement).Expression.(type) {
+	case *ast.WhileExpression:
+		loop.Label = label
+	case *ast.ForExpression:
+		loop.Label = label
+	case *ast.ForInExpression:
+		loop.Label = label
+	}
+	return stmt
+}
+
+// parseExportStatement marks the declaration after export as seen by the modules importing this one
+func (p *Parser) parseExportStatement() ast.Statement {
+	exportToken := p.curToken
+	p.nextToken()
+	stmt := p.parseStatement()
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Exported = true
+		return stmt
+	case *ast.ExpressionStatement:
+		switch e := stmt.Expression.(type) {
+		case *ast.FunctionLiteral:
+			if e.Name != "" {
+				stmt.Exported = true
+				return stmt
+			}
+		case *ast.ClassExpress, *ast.InterfaceExpress:
+			stmt.Exported = true
+			return stmt
+		}
+	}
+	p.addError(exportToken.Pos, "export needs a let, a named fn, a class or an interface")
+	return nil
+}
+
 func (p *Parser) parsePackageStatement() ast.Statement {
 	if p.tokenCount != initReadCount {
-		p.errors = append(p.errors, "package need be the first token")
+		p.addError(p.curToken.Pos, "package need be the first token")
 		return nil
 	}
 	p.nextToken()
@@ -265,7 +427,8 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
-	for !p.curTokenIs(token.SEMICOLON) {
+	// the statement goes on to the ; ending it, without taking the } of a block written on the same line
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) && !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 	}
 	return stmt
@@ -305,35 +468,15 @@ func (p *Parser) parseInditifier() ast.Expression {
 	identifier := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifier.FileName = p.l.FileName
 	identifier.PackageName = p.l.PackageName
-	if p.peekTokenIs(token.LBRACKET) {
-		return p.parseAssignHashExpress(identifier)
-	}
 	return identifier
 }
 
-func (p *Parser) parseAssignHashExpress(identifier *ast.Identifier) ast.Expression {
-	p.nextToken()
-	p.nextToken()
-	index := p.parseExpression(LOWEST)
-	p.nextToken()
-	if !p.peekTokenIs(token.ASSIGN) {
-		exp := &ast.IndexExpression{Token: identifier.Token, Left: identifier}
-		exp.Index = index
-		return exp
-	}
-	p.nextToken()
-	p.nextToken()
-	value := p.parseExpression(LOWEST)
-	stmt := &ast.HashAssignExpress{Token: p.curToken, Hash: *identifier, Index: index, Value: value}
-	return stmt
-}
-
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos, msg)
 	}
 	lit.Value = value
 	return lit
@@ -353,8 +496,11 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 	precedence := p.curPrecedence()
+	if expression.Operator == token.POWER { // right associative, 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RPAREN) {
-		oneToken := token.Token{Literal: "1", Type: token.INT}
+		oneToken := token.Token{Literal: "1", Type: token.INT, Pos: p.curToken.Pos}
 		expression.Right = ast.Expression(&ast.IntegerLiteral{Value: 1, Token: oneToken})
 	} else {
 		p.nextToken()
@@ -367,6 +513,10 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -406,7 +556,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 }
 
 func (p *Parser) parseWhileExpression() ast.Expression {
-	expression := &ast.WhileExpression{}
+	expression := &ast.WhileExpression{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
@@ -429,6 +579,10 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
 		stmt := p.parseStatement()
+		if p.panicking {
+			stmt = nil
+			p.synchronize()
+		}
 		expression, ok := stmt.(*ast.ExpressionStatement)
 		isDeferBlock := false
 		if ok {
@@ -437,6 +591,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 				if deferBlock.IsDeferBlock {
 					isDeferBlock = true
 					block.DeferStatements = deferBlock.Statements
+					block.Defers = append(block.Defers, deferBlock)
 				}
 			}
 		}
@@ -445,6 +600,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken.Pos
 	return block
 
 }
@@ -455,6 +611,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if p.peekTokenIs(token.IDENT) {
 		p.nextToken()
 		lit.Name = p.curToken.Literal
+		lit.NamePos = p.curToken.Pos
 	}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -467,7 +624,11 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	// break and continue can not leave the function for a loop around it
+	labels := p.labels
+	p.labels = nil
 	lit.Body = p.parseBlockStatement()
+	p.labels = labels
 	return lit
 }
 
@@ -481,6 +642,44 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseTemplateLiteral parses a string holding ${...}, each expression is parsed on its own from its source
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	lit := &ast.TemplateLiteral{Token: p.curToken}
+	parts, errs := lexer.SplitTemplate(p.curToken)
+	for _, err := range errs {
+		p.addLexError(err)
+	}
+	for _, part := range parts {
+		if !part.IsExpression {
+			tok := token.Token{Type: token.STRING, Literal: part.Text, Pos: part.Pos}
+			lit.Parts = append(lit.Parts, &ast.StringLiteral{Token: tok, Value: part.Text})
+			continue
+		}
+		lit.Parts = append(lit.Parts, p.parseInterpolation(part))
+	}
+	return lit
+}
+
+// parseInterpolation parses the expression of a ${...}, its errors are errors of the statement holding the string
+func (p *Parser) parseInterpolation(part lexer.TemplatePart) ast.Expression {
+	if strings.TrimSpace(part.Text) == "" {
+		p.addError(part.Pos, "no expression in ${}")
+		return nil
+	}
+	sub := New(p.l.Sub(part.Text, part.Pos))
+	exp := sub.parseExpression(LOWEST)
+	if sub.peekTokenIs(token.SEMICOLON) {
+		sub.nextToken()
+	}
+	if !sub.peekTokenIs(token.EOF) {
+		sub.addError(sub.peekToken.Pos, fmt.Sprintf("unexpected %s in ${}", sub.peekToken.Literal))
+	}
+	for _, err := range sub.parseErrors {
+		p.addError(err.Pos, err.Msg)
+	}
+	return exp
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -542,11 +741,21 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
-
-	p.nextToken()
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left, Optional: p.curTokenIs(token.OPTIONAL_INDEX)}
 
-	exp.Index = p.parseExpression(LOWEST)
+	// left[index], or the slice left[low:high] where either bound may be left out
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Index = p.parseExpression(LOWEST)
+	}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp.Slice = true
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.High = p.parseExpression(LOWEST)
+		}
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -568,7 +777,9 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
 		hash.Keys = append(hash.Keys, key)
-		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) && !p.expectPeek(token.SEMICOLON) {
+		if p.peekTokenIs(token.SEMICOLON) { // the line of a pair ended without a comma
+			p.nextToken()
+		} else if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
 	}
@@ -576,6 +787,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.curToken.Pos
 	return hash
 }
 
@@ -598,7 +810,19 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken.Pos, msg)
+}
+
+// addError records a parse error prefixed with the source position it was found at,
+// only the first error of a statement is recorded, those after it usually follow from it
+func (p *Parser) addError(pos token.Position, msg string) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	err := &Error{Pos: pos, Msg: msg, Line: p.l.Line(pos.Line)}
+	p.parseErrors = append(p.parseErrors, err)
+	p.errors = append(p.errors, err.Error())
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -611,7 +835,15 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixPasrseFn) {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken.Pos, msg)
+}
+
+// Precedence is how tightly an infix operator binds, LOWEST for the other tokens
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -628,30 +860,55 @@ func (p *Parser) curPrecedence() int {
 	return LOWEST
 }
 
-func (p *Parser) SetRunSourceDir(sourceDir string) {
-	runSourceDir = sourceDir
-}
-
 func (p *Parser) parseFloatLiteral() ast.Expression {
 	lit := &ast.FloatLiteral{Token: p.curToken}
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken.Pos, msg)
 	}
 	lit.Value = value
 	return lit
 }
 
 func (p *Parser) parseBreakExpression() ast.Expression {
-	return &ast.BreakExpression{Token: p.curToken}
+	return &ast.BreakExpression{Token: p.curToken, Label: p.parseLoopLabel()}
+}
+
+func (p *Parser) parseContinueExpression() ast.Expression {
+	return &ast.ContinueExpression{Token: p.curToken, Label: p.parseLoopLabel()}
+}
+
+// parseLoopLabel parses the label after break or continue, it is nil when there is none
+func (p *Parser) parseLoopLabel() *ast.Identifier {
+	if !p.peekTokenIs(token.IDENT) {
+		return nil
+	}
+	p.nextToken()
+	label := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal, FileName: p.l.FileName, PackageName: p.l.PackageName}
+	for _, outer := range p.labels {
+		if outer == label.Value {
+			return label
+		}
+	}
+	p.addError(label.Pos(), fmt.Sprintf("undefined label %s", label.Value))
+	return label
 }
 
+// parseForExpression parses both for (let i = 0; i < n; i++) and for (key, value in collection),
+// the parentheses of the second may be left out
 func (p *Parser) parseForExpression() ast.Expression {
-	forExpression := &ast.ForExpression{Token: p.curToken}
+	forToken := p.curToken
+	if p.peekTokenIs(token.IDENT) {
+		return p.parseForInExpression(forToken, false)
+	}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
+	if p.peekTokenIs(token.IDENT) {
+		return p.parseForInExpression(forToken, true)
+	}
+	forExpression := &ast.ForExpression{Token: forToken}
 	p.nextToken()
 	forExpression.Initor = p.parseLetStatement()
 	p.nextToken()
@@ -669,6 +926,34 @@ func (p *Parser) parseForExpression() ast.Expression {
 	return forExpression
 }
 
+func (p *Parser) parseForInExpression(forToken token.Token, parenthesized bool) ast.Expression {
+	expression := &ast.ForInExpression{Token: forToken}
+	for len(expression.Names) < 2 {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal, FileName: p.l.FileName, PackageName: p.l.PackageName}
+		expression.Names = append(expression.Names, name)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	expression.Collection = p.parseExpression(LOWEST)
+	if parenthesized && !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Body = p.parseBlockStatement()
+	return expression
+}
+
 func (p *Parser) parseClassExpression() ast.Expression {
 	classExpression := &ast.ClassExpress{
 		Token: p.curToken,
@@ -705,7 +990,11 @@ func (p *Parser) parseClassExpression() ast.Expression {
 		letStatements := []*ast.LetStatement{}
 		for p.peekTokenIs(token.LET) {
 			p.nextToken()
-			letStatement := p.parseLetStatement().(*ast.LetStatement)
+			letStatement, ok := p.parseLetStatement().(*ast.LetStatement)
+			if !ok || p.panicking { // a member with an error is left out, the parse goes on with the next one
+				p.synchronize()
+				continue
+			}
 			letStatements = append(letStatements, letStatement)
 		}
 		classExpression.LetStatements = letStatements
@@ -713,7 +1002,11 @@ func (p *Parser) parseClassExpression() ast.Expression {
 		functionStatemens := []*ast.FunctionLiteral{}
 		for p.peekTokenIs(token.FUNCTION) {
 			p.nextToken()
-			functionStatement := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+			functionStatement, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+			if !ok || p.panicking {
+				p.synchronize()
+				continue
+			}
 			functionStatemens = append(functionStatemens, functionStatement)
 			if p.peekTokenIs(token.SEMICOLON) {
 				p.nextToken()
@@ -722,6 +1015,7 @@ func (p *Parser) parseClassExpression() ast.Expression {
 		classExpression.Functions = functionStatemens
 	}
 	p.expectPeek(token.RBRACE)
+	classExpression.Rbrace = p.curToken.Pos
 	return classExpression
 }
 
@@ -754,12 +1048,20 @@ func (p *Parser) parseInterfaceExpress() ast.Expression {
 		functionStatemens := []*ast.FunctionLiteral{}
 		for p.peekTokenIs(token.FUNCTION) {
 			p.nextToken()
-			functionStatement := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+			functionStatement, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+			if !ok || p.panicking {
+				p.synchronize()
+				continue
+			}
 			functionStatemens = append(functionStatemens, functionStatement)
+			if p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
 		}
 		interfaceExpress.Functions = functionStatemens
 	}
 	p.expectPeek(token.RBRACE)
+	interfaceExpress.Rbrace = p.curToken.Pos
 	return interfaceExpress
 }
 
@@ -790,6 +1092,7 @@ func (p *Parser) parseDeferExpression() ast.Expression { // same as parseBlockSt
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken.Pos
 	return block
 }
 
@@ -799,7 +1102,12 @@ func (p *Parser) parseQuestionExpression(left ast.Expression) ast.Expression {
 		Statements: []ast.Statement{},
 	}
 	p.nextToken()
-	stmt := p.parseStatement()
+	var stmt ast.Statement
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+		stmt = p.parseExpressionStatement() // the b of a ? b : c is not a label
+	} else {
+		stmt = p.parseStatement()
+	}
 	expression.Consequence.Statements = append(expression.Consequence.Statements, stmt)
 	p.nextToken()
 	if p.curTokenIs(token.COLON) {
@@ -812,3 +1120,55 @@ func (p *Parser) parseQuestionExpression(left ast.Expression) ast.Expression {
 	}
 	return expression
 }
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{Token: p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expression.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			expression.Parameter = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.addError(expression.Token.Pos, "try needs a catch or finally block")
+		return nil
+	}
+	return expression
+}
@@ -4,6 +4,7 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"z/ast"
 	"z/lexer"
@@ -284,6 +285,42 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b % c - d",
+			"((a + (b % c)) - d)",
+		},
+		{
+			"a | b & c ^ d << 1",
+			"((a | (b & c)) ^ (d << 1))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2 * a",
+			"((-(2 ** 2)) * a)",
+		},
+		{
+			"a ** b[1] ** -c",
+			"(a ** ((b[1]) ** (-c)))",
+		},
+		{
+			"a ?? b || c ?? null",
+			"((a ?? (b || c)) ?? null)",
+		},
+		{
+			"a?->b?.[1] ?? c + 1",
+			"(((a ?-> b)?.[1]) ?? (c + 1))",
+		},
+		{
+			"a->b[0] = c[1:] + d[:-1]",
+			"(((a -> b)[0]) = ((c[1:]) + (d[:(-1)])))",
+		},
+		{
+			"m[i][j] += s[a:b][0]",
+			"(((m[i])[j]) += ((s[a:b])[0]))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -664,6 +701,32 @@ func TestParsingIndexExpression(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpression(t *testing.T) {
+	tests := []struct {
+		input string
+		low   bool
+		high  bool
+	}{
+		{"a[1:2]", true, true},
+		{"a[1:]", true, false},
+		{"a[:2]", false, true},
+		{"a[:]", false, false},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		slice, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IndexExpression)
+		if !ok || !slice.Slice {
+			t.Fatalf("%s: not a slice. got=%s", tt.input, program.String())
+		}
+		if (slice.Index != nil) != tt.low || (slice.High != nil) != tt.high {
+			t.Errorf("%s: wrong bounds. got low=%v high=%v", tt.input, slice.Index, slice.High)
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	l := lexer.New(input)
@@ -721,6 +784,18 @@ func TestFunctionLiteralWithName(t *testing.T) {
 	}
 }
 
+func TestFunctionNamePosition(t *testing.T) {
+	input := "\nfn  add(x) { x }"
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if function.NamePos.Line != 2 || function.NamePos.Column != 5 {
+		t.Fatalf("function name position wrong, want 2:5, got=%d:%d", function.NamePos.Line, function.NamePos.Column)
+	}
+}
+
 func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
 	opExp, ok := exp.(*ast.InfixExpression)
 	if !ok {
@@ -906,6 +981,65 @@ func TestForStatement(t *testing.T) {
 	}
 }
 
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input      string
+		label      string
+		names      []string
+		collection string
+	}{
+		{"for (k, v in h) { k }", "", []string{"k", "v"}, "h"},
+		{"for x in f(a) { x }", "", []string{"x"}, "f(a)"},
+		{"outer: for (c in \"abc\") { break outer }", "outer", []string{"c"}, "abc"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if len(program.Statements) != 1 {
+			t.Fatalf("%s: expected 1 statement, got=%d", tt.input, len(program.Statements))
+		}
+		loop, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ForInExpression)
+		if !ok {
+			t.Fatalf("%s: not a for in loop. got=%T", tt.input, program.Statements[0].(*ast.ExpressionStatement).Expression)
+		}
+		if (loop.Label == nil && tt.label != "") || (loop.Label != nil && loop.Label.Value != tt.label) {
+			t.Errorf("%s: wrong label. got=%v", tt.input, loop.Label)
+		}
+		names := []string{}
+		for _, name := range loop.Names {
+			names = append(names, name.Value)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("%s: wrong names. got=%v", tt.input, names)
+		}
+		if loop.Collection.String() != tt.collection {
+			t.Errorf("%s: wrong collection. got=%q", tt.input, loop.Collection.String())
+		}
+	}
+}
+
+func TestLabelErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"outer: let a = 1", "1:1: label outer must be followed by for or while"},
+		{"for (x in [1]) { break inner }", "1:24: undefined label inner"},
+		{"a: while (true) { a: for (x in [1]) {} }", "1:19: label a already defined"},
+		{"a: while (true) { fn() { continue a } }", "1:35: undefined label a"},
+		{"let b = c ? d : e", ""},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		got := strings.Join(p.Errors(), "; ")
+		if got != tt.expected {
+			t.Errorf("%s: wrong errors. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestBaseClassStatement(t *testing.T) {
 	input := "class Hello{fn say(){};fn good(){}}"
 	l := lexer.New(input)
@@ -1190,3 +1324,351 @@ func TestDeferExpression(t *testing.T) {
 		t.Fatalf("block statement defer error ,expected 1, got=%d", len(block.DeferStatements))
 	}
 }
+
+func TestParserErrorPosition(t *testing.T) {
+	input := `let a = 1;
+let = 5;`
+	l := lexer.New(input)
+	l.SetFileName("main.z")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+	expected := "main.z:2:5: expected next token to be IDENT, got = instead"
+	if errors[0] != expected {
+		t.Fatalf("wrong error, expected=%q, got=%q", expected, errors[0])
+	}
+
+	parseError := p.ParseErrors()[0]
+	if parseError.Pos.Line != 2 || parseError.Pos.Column != 5 || parseError.Msg != "expected next token to be IDENT, got = instead" {
+		t.Errorf("wrong parse error, got=%+v", parseError)
+	}
+}
+
+func TestImportStatement(t *testing.T) {
+	l := lexer.New(`import "string.z";
+let a = 1;`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.ImportStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Path != "string.z" || stmt.PathPos.Column != 8 {
+		t.Errorf("wrong import, got path=%q at %s", stmt.Path, stmt.PathPos)
+	}
+}
+
+func TestNodePosition(t *testing.T) {
+	input := `let a = 1;
+  a + add(2, 3)`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+	infix, ok := stmt.Expression.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.InfixExpression. got=%T", stmt.Expression)
+	}
+	tests := []struct {
+		node   ast.Node
+		line   int
+		column int
+	}{
+		{program, 1, 1},
+		{stmt, 2, 3},
+		{infix.Left, 2, 3},
+		{infix, 2, 5},
+		{infix.Right, 2, 10},
+	}
+	for i, tt := range tests {
+		pos := tt.node.Pos()
+		if pos.Line != tt.line || pos.Column != tt.column {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d", i, tt.line, tt.column, pos.Line, pos.Column)
+		}
+	}
+}
+
+func TestTryExpression(t *testing.T) {
+	input := `try { x; } catch (e) { throw e; } finally { y; }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statement, got=%d", 1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.TryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TryExpression, got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Parameter, "e") {
+		return
+	}
+	if len(exp.Block.Statements) != 1 || len(exp.Finally.Statements) != 1 {
+		t.Fatalf("wrong try or finally block, got=%s", exp.String())
+	}
+	throw, ok := exp.Catch.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("exp.Catch.Statements[0] is not ast.ThrowStatement, got=%T", exp.Catch.Statements[0])
+	}
+	testIdentifier(t, throw.Value, "e")
+}
+
+func TestTryWithoutHandler(t *testing.T) {
+	l := lexer.New("try { x; }")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected a parser error for try without catch or finally")
+	}
+	if errors[0] != "1:1: try needs a catch or finally block" {
+		t.Errorf("wrong parser error, got=%q", errors[0])
+	}
+}
+
+func TestHashLiteralOnSeveralLines(t *testing.T) {
+	input := `let a = {
+  "one": 1,
+  "two": 2
+}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("value is not *ast.HashLiteral. got=%T", program.Statements[0].(*ast.LetStatement).Value)
+	}
+	if len(hash.Keys) != 2 || hash.Rbrace.Line != 4 {
+		t.Errorf("wrong hash. got %d keys, closed at %s", len(hash.Keys), hash.Rbrace)
+	}
+}
+
+func TestDeferBlocks(t *testing.T) {
+	input := `fn f() {
+  defer { puts(1) }
+  puts(2)
+  defer { puts(3) }
+}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 1 || len(fn.Body.Defers) != 2 || len(fn.Body.DeferStatements) != 1 {
+		t.Fatalf("wrong body. got %d statements, %d defer blocks", len(fn.Body.Statements), len(fn.Body.Defers))
+	}
+	if fn.Body.Defers[0].Pos().Line != 2 || fn.Body.Defers[1].Pos().Line != 4 || fn.Body.Rbrace.Line != 5 {
+		t.Errorf("wrong positions. got defers at %s and %s, closed at %s",
+			fn.Body.Defers[0].Pos(), fn.Body.Defers[1].Pos(), fn.Body.Rbrace)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `let a = 1
+let = 2
+puts(a)
+fn f() {
+  let x = ;
+  puts(x)
+}
+let b = a +* 3
+puts(b)`
+	l := lexer.New(input)
+	l.SetFileName("main.z")
+	p := New(l)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"main.z:2:5: expected next token to be IDENT, got = instead",
+		"main.z:5:11: no prefix parse function for ; found",
+		"main.z:8:12: no prefix parse function for * found",
+	}
+	if fmt.Sprint(p.Errors()) != fmt.Sprint(expected) {
+		t.Fatalf("wrong errors.\nexpected=%q\ngot=     %q", expected, p.Errors())
+	}
+	// the statements with errors are left out, those around them are kept
+	if len(program.Statements) != 4 {
+		t.Fatalf("program has wrong number of statements. got=%d: %s", len(program.Statements), program.String())
+	}
+	fn := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Body.Statements) != 1 || fn.Body.Statements[0].String() != "puts(x)" {
+		t.Errorf("wrong function body. got=%s", fn.Body.String())
+	}
+	if program.Statements[3].String() != "puts(b)" {
+		t.Errorf("wrong last statement. got=%s", program.Statements[3].String())
+	}
+
+	snippet := p.ParseErrors()[1].Snippet()
+	if snippet != "  let x = ;\n          ^" {
+		t.Errorf("wrong snippet. got=%q", snippet)
+	}
+}
+
+// TestClassMemberErrors checks that a member of a class or an interface that does not parse is an error
+// and is left out, the members after it are kept
+func TestClassMemberErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		members  string
+	}{
+		{"interface Shape { fn area() }", "1:29: expected next token to be {, got } instead", ""},
+		{"class A { let = 1 }", "1:15: expected next token to be IDENT, got = instead", ""},
+		{"class A { let = 1; let b = 2 }", "1:15: expected next token to be IDENT, got = instead", "b"},
+		{"interface Shape { fn area(); fn name() {} }", "1:28: expected next token to be {, got ; instead", "name"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		got := strings.Join(p.Errors(), "; ")
+		if got != tt.expected {
+			t.Errorf("%s: wrong errors. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if len(program.Statements) != 1 {
+			t.Fatalf("%s: program has wrong number of statements. got=%d", tt.input, len(program.Statements))
+		}
+		members := []string{}
+		switch node := program.Statements[0].(*ast.ExpressionStatement).Expression.(type) {
+		case *ast.ClassExpress:
+			for _, let := range node.LetStatements {
+				members = append(members, let.Name.Value)
+			}
+		case *ast.InterfaceExpress:
+			for _, fn := range node.Functions {
+				members = append(members, fn.Name)
+			}
+		}
+		if strings.Join(members, " ") != tt.members {
+			t.Errorf("%s: wrong members. expected=%q, got=%q", tt.input, tt.members, members)
+		}
+	}
+}
+
+func TestReturnBeforeBrace(t *testing.T) {
+	l := lexer.New("fn f(x) { return x + 1 }\nputs(f(1))")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program has wrong number of statements. got=%d: %s", len(program.Statements), program.String())
+	}
+}
+
+func TestExportStatement(t *testing.T) {
+	input := `export let a = 1
+export fn f() { a }
+export class C {}
+let b = 2`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 4 {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+	exported := []bool{
+		program.Statements[0].(*ast.LetStatement).Exported,
+		program.Statements[1].(*ast.ExpressionStatement).Exported,
+		program.Statements[2].(*ast.ExpressionStatement).Exported,
+		program.Statements[3].(*ast.LetStatement).Exported,
+	}
+	if fmt.Sprint(exported) != "[true true true false]" {
+		t.Errorf("wrong exports. got=%v", exported)
+	}
+
+	p = New(lexer.New("export puts(1)\nexport fn() {}"))
+	p.ParseProgram()
+	if len(p.Errors()) != 2 || p.ParseErrors()[0].Msg != "export needs a let, a named fn, a class or an interface" {
+		t.Errorf("wrong errors. got=%q", p.Errors())
+	}
+}
+
+func TestUnicodeErrors(t *testing.T) {
+	input := "let 名字 = \"\\u{110000}\"\nlet 价格 = * 2"
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+
+	expected := []string{
+		"1:11: bad unicode escape \\u{110000}, want \\u{hex code point}",
+		"2:10: no prefix parse function for * found",
+	}
+	if fmt.Sprint(p.Errors()) != fmt.Sprint(expected) {
+		t.Fatalf("wrong errors.\nexpected=%q\ngot=     %q", expected, p.Errors())
+	}
+	if len(program.Statements) != 1 {
+		t.Errorf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+	// a CJK character takes two columns in a terminal
+	if snippet := p.ParseErrors()[1].Snippet(); snippet != "let 价格 = * 2\n           ^" {
+		t.Errorf("wrong snippet. got=%q", snippet)
+	}
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	input := `"sum: ${a + b * 2}, ${name}!"`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	template, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+	}
+	expected := []string{"sum: ", "(a + (b * 2))", ", ", "name", "!"}
+	if len(template.Parts) != len(expected) {
+		t.Fatalf("wrong number of parts. got=%d", len(template.Parts))
+	}
+	for i, part := range template.Parts {
+		if part.String() != expected[i] {
+			t.Errorf("parts[%d] wrong. expected=%q, got=%q", i, expected[i], part.String())
+		}
+	}
+	if ident, ok := template.Parts[3].(*ast.Identifier); !ok || ident.Pos().Column != 23 {
+		t.Errorf("wrong identifier position. got=%+v", template.Parts[3].Pos())
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = "x ${)} y"`, "1:14: no prefix parse function for ) found"},
+		{`let a = "x ${b c}"`, "1:16: unexpected c in ${}"},
+		{`let a = "x ${ }"`, "1:14: no expression in ${}"},
+		{`let a = "x ${b"`, "1:9: string literal not terminated"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%s: wrong errors. expected=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
@@ -0,0 +1,24 @@
+// Package stdlib is the standard library built into z: a copy of the .z files of the standard directory
+// of the repository, made by go generate. z finds it there when there is no standard directory on the disk
+package stdlib
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:generate sh -c "rm -f standard/*.z && cp ../../../standard/*.z standard/"
+
+//go:embed standard/*.z
+var files embed.FS
+
+// FS holds the .z files of the standard library at its root
+var FS fs.FS
+
+func init() {
+	var err error
+	FS, err = fs.Sub(files, "standard")
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,33 @@
+package stdlib
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestUpToDate checks that the embedded copy is the standard directory of the repository, go generate makes it again
+func TestUpToDate(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "..", "standard", "*.z"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no standard library. got=%v, %v", paths, err)
+	}
+	embedded, err := fs.Glob(FS, "*.z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embedded) != len(paths) {
+		t.Errorf("wrong number of files, run go generate ./stdlib. expected=%d, got=%d", len(paths), len(embedded))
+	}
+	for _, path := range paths {
+		expected, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fs.ReadFile(FS, filepath.Base(path))
+		if err != nil || string(got) != string(expected) {
+			t.Errorf("%s is out of date, run go generate ./stdlib", filepath.Base(path))
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package symbols finds the names a z program declares and the scopes they are seen in, without running it.
+// z vet and the language server share it, so that they agree on what a name is
+package symbols
+
+import (
+	"fmt"
+	"sort"
+	"z/ast"
+	"z/lexer"
+	"z/parser"
+	"z/token"
+)
+
+type Kind int
+
+const (
+	Variable Kind = iota
+	Function
+	Class
+	Interface
+	Field
+	Method
+	Builtin
+)
+
+// Symbol is a name declared in a program, or a builtin
+type Symbol struct {
+	Name  string
+	Kind  Kind
+	Pos   token.Position
+	Fn    *ast.FunctionLiteral // the function a function, a method or a variable holds, for its parameters
+	Arity *Arity               // the arguments a call takes, when the name holds a known function
+	Class *ast.ClassExpress    // the class a class name declares
+	NewOf string               // the class name of a variable set by new
+	Value string               // what the name holds when it is definitely not an object: "integer", "array"...
+	Used  bool
+}
+
+// Arity is the number of arguments a function takes, Max is -1 when there is no limit
+type Arity struct {
+	Min int
+	Max int
+}
+
+func (a Arity) Accepts(n int) bool {
+	return n >= a.Min && (a.Max < 0 || n <= a.Max)
+}
+
+func (a Arity) String() string {
+	switch {
+	case a.Max < 0:
+		return fmt.Sprintf("at least %d", a.Min)
+	case a.Min == a.Max:
+		return fmt.Sprintf("%d", a.Min)
+	default:
+		return fmt.Sprintf("%d to %d", a.Min, a.Max)
+	}
+}
+
+// FunctionArity is what a function literal takes, the parameters after the last one without a default may be left out
+func FunctionArity(fn *ast.FunctionLiteral) *Arity {
+	a := &Arity{0, len(fn.Parameters)}
+	for i, param := range fn.Parameters {
+		if param != nil && param.Default == nil {
+			a.Min = i + 1
+		}
+	}
+	return a
+}
+
+type Scope struct {
+	Symbols map[string]*Symbol
+	Outer   *Scope
+	Class   *ast.ClassExpress // the class the methods of this scope belong to, what this refers to
+}
+
+func NewScope(outer *Scope) *Scope {
+	return &Scope{Symbols: map[string]*Symbol{}, Outer: outer}
+}
+
+func (s *Scope) Define(sym *Symbol) {
+	s.Symbols[sym.Name] = sym
+}
+
+func (s *Scope) Lookup(name string) *Symbol {
+	for ; s != nil; s = s.Outer {
+		if sym, ok := s.Symbols[name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+func (s *Scope) EnclosingClass() *ast.ClassExpress {
+	for ; s != nil; s = s.Outer {
+		if s.Class != nil {
+			return s.Class
+		}
+	}
+	return nil
+}
+
+// Visible lists the symbols of the scope and of the scopes around it, an inner name hides an outer one
+func (s *Scope) Visible() []*Symbol {
+	seen := map[string]bool{}
+	visible := []*Symbol{}
+	for ; s != nil; s = s.Outer {
+		names := []string{}
+		for name := range s.Symbols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				visible = append(visible, s.Symbols[name])
+			}
+		}
+	}
+	return visible
+}
+
+// Declaration is the symbol a statement declares: a let, a named function, a class or an interface
+func Declaration(stmt ast.Statement) *Symbol {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Name != nil {
+			return LetSymbol(stmt, Variable)
+		}
+	case *ast.ExpressionStatement:
+		switch e := stmt.Expression.(type) {
+		case *ast.FunctionLiteral:
+			if e.Name != "" {
+				return FunctionSymbol(e, Function)
+			}
+		case *ast.ClassExpress:
+			if e.Name != nil {
+				return &Symbol{Name: e.Name.Value, Kind: Class, Pos: e.Name.Pos(), Class: e, Value: "class"}
+			}
+		case *ast.InterfaceExpress:
+			return &Symbol{Name: e.Name.Value, Kind: Interface, Pos: e.Name.Pos(), Value: "interface"}
+		}
+	}
+	return nil
+}
+
+// FunctionSymbol is the symbol of a named function or of a method, it is at the name and not at fn
+func FunctionSymbol(fn *ast.FunctionLiteral, kind Kind) *Symbol {
+	pos := fn.NamePos
+	if !pos.IsValid() {
+		pos = fn.Pos()
+	}
+	sym := &Symbol{Name: fn.Name, Kind: kind, Pos: pos, Fn: fn, Arity: FunctionArity(fn)}
+	if kind == Function {
+		sym.Value = "function"
+	}
+	return sym
+}
+
+// LetSymbol is the symbol of a let, a variable holding a function literal is a function
+func LetSymbol(stmt *ast.LetStatement, kind Kind) *Symbol {
+	sym := &Symbol{Name: stmt.Name.Value, Kind: kind, Pos: stmt.Name.Pos(), Value: ValueKind(stmt.Value)}
+	switch value := stmt.Value.(type) {
+	case *ast.FunctionLiteral:
+		sym.Fn = value
+		sym.Arity = FunctionArity(value)
+		if kind == Variable {
+			sym.Kind = Function
+		}
+	case *ast.ObjectExpress:
+		if value.Class != nil {
+			sym.NewOf = value.Class.Value
+		}
+	}
+	return sym
+}
+
+// ValueKind names the value of a literal, it is empty for the expressions that may give an object
+func ValueKind(e ast.Expression) string {
+	switch e.(type) {
+	case *ast.IntegerLiteral:
+		return "integer"
+	case *ast.FloatLiteral:
+		return "float"
+	case *ast.StringLiteral, *ast.TemplateLiteral:
+		return "string"
+	case *ast.Boolean:
+		return "boolean"
+	case *ast.ArrayLiteral:
+		return "array"
+	case *ast.HashLiteral:
+		return "hash"
+	case *ast.FunctionLiteral:
+		return "function"
+	}
+	return ""
+}
+
+// Members are the fields and methods of a class, the class's own first and then those of its parents
+func Members(class *ast.ClassExpress, sc *Scope) []*Symbol {
+	members := []*Symbol{}
+	seen := map[*ast.ClassExpress]bool{}
+	var collect func(class *ast.ClassExpress)
+	collect = func(class *ast.ClassExpress) {
+		if class == nil || seen[class] {
+			return
+		}
+		seen[class] = true
+		for _, let := range class.LetStatements {
+			if let != nil && let.Name != nil {
+				sym := LetSymbol(let, Field)
+				sym.Value = "" // a field may be given any value
+				members = append(members, sym)
+			}
+		}
+		for _, fn := range class.Functions {
+			if fn != nil && fn.Name != "" {
+				members = append(members, FunctionSymbol(fn, Method))
+			}
+		}
+		for _, parent := range class.Parents {
+			if sym := sc.Lookup(parent.Value); sym != nil {
+				collect(sym.Class)
+			}
+		}
+	}
+	collect(class)
+	return members
+}
+
+// File is a parsed source file, its imports are not followed
+type File struct {
+	Path        string
+	Program     *ast.Program
+	Errors      []*parser.Error
+	Comments    []lexer.Comment
+	PackageName string
+	Imports     []*ast.ImportStatement
+	Top         map[string]*Symbol // the declarations at the top level
+}
+
+func ParseFile(path string, text string) *File {
+	l := lexer.New(text)
+	l.SetFileName(path)
+	p := parser.New(l)
+	f := &File{Path: path, Program: p.ParseProgram(), Errors: p.ParseErrors(), Top: map[string]*Symbol{}}
+	f.Comments = l.Comments
+	f.PackageName = l.PackageName
+	for _, stmt := range f.Program.Statements {
+		if imp, ok := stmt.(*ast.ImportStatement); ok {
+			f.Imports = append(f.Imports, imp)
+		}
+		if sym := Declaration(stmt); sym != nil {
+			f.Top[sym.Name] = sym
+		}
+	}
+	return f
+}
@@ -0,0 +1,57 @@
+package symbols
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseFile(t *testing.T) {
+	f := ParseFile("a.z", "let a = 1\nlet f = fn(x, y = 2) { x }\nfn g() { 1 }\nclass A { let n = 1\n fn get() { n } }\ninterface I { fn get() {} }\nlet o = new A()")
+	if len(f.Errors) != 0 {
+		t.Fatalf("parse errors: %v", f.Errors)
+	}
+	tests := []struct {
+		name  string
+		kind  Kind
+		value string
+		arity string
+		newOf string
+	}{
+		{"a", Variable, "integer", "", ""},
+		{"f", Function, "function", "1 to 2", ""},
+		{"g", Function, "function", "0", ""},
+		{"A", Class, "class", "", ""},
+		{"I", Interface, "interface", "", ""},
+		{"o", Variable, "", "", "A"},
+	}
+	for _, tt := range tests {
+		sym := f.Top[tt.name]
+		if sym == nil {
+			t.Errorf("%s is not declared", tt.name)
+			continue
+		}
+		arity := ""
+		if sym.Arity != nil {
+			arity = sym.Arity.String()
+		}
+		if sym.Kind != tt.kind || sym.Value != tt.value || arity != tt.arity || sym.NewOf != tt.newOf {
+			t.Errorf("%s: got kind %d value %q arity %q new %q", tt.name, sym.Kind, sym.Value, arity, sym.NewOf)
+		}
+	}
+}
+
+func TestMembers(t *testing.T) {
+	f := ParseFile("a.z", "class A { let n = 1\n fn get() { n } }\nclass B extends A { let m = fn() { 2 } }")
+	sc := NewScope(nil)
+	for _, sym := range f.Top {
+		sc.Define(sym)
+	}
+	got := ""
+	for _, sym := range Members(f.Top["B"].Class, sc) {
+		got += fmt.Sprintf("%s:%d:%q ", sym.Name, sym.Kind, sym.Value)
+	}
+	expected := fmt.Sprintf("m:%d:\"\" n:%d:\"\" get:%d:\"\" ", Field, Field, Method)
+	if got != expected {
+		t.Errorf("members wrong, got %s want %s", got, expected)
+	}
+}
@@ -1,5 +1,7 @@
 package token
 
+import "fmt"
+
 const (
 	ILIEGAL   = "ILIEGAL"
 	EOF       = "EOF"
@@ -21,12 +23,21 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	STRING   = "STRING"
+	TEMPLATE = "TEMPLATE" // a string holding ${...}, its literal is the source between the quotes
 	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
 	WHILE    = "WHILE"
 	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 	PACKAGE  = "PACKAGE"
 	FOR      = "FOR"
+	IN       = "IN"
 	DEFER    = "DEFER"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	THROW    = "THROW"
+	NULL     = "NULL"
 
 	// oop keyword
 	CLASS     = "CLASS"
@@ -37,6 +48,9 @@ const (
 	// oop object install value access
 	OBJET_GET = "->"
 	CLASS_GET = "::"
+	// optional chaining, null when the left side is null
+	OPTIONAL_GET   = "?->"
+	OPTIONAL_INDEX = "?.["
 
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -44,6 +58,14 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
+
+	BIT_AND     = "&"
+	BIT_OR      = "|"
+	BIT_XOR     = "^"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
 
 	PLUSASSIGN     = "+="
 	MINUSASSIGN    = "-="
@@ -69,6 +91,7 @@ const (
 	OR  = "||"
 
 	QUESTION = "?"
+	NULLISH  = "??"
 
 	FLOAT = "FLOAT"
 )
@@ -78,6 +101,28 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position
+}
+
+// Position is the location of a token in its source file, line and column start from 1
+type Position struct {
+	FileName string
+	Line     int
+	Column   int
+}
+
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return p.FileName
+	}
+	if p.FileName == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.FileName, p.Line, p.Column)
 }
 
 var keywords = map[string]TokenType{
@@ -89,16 +134,24 @@ var keywords = map[string]TokenType{
 	"else":      ELSE,
 	"return":    RETURN,
 	"import":    IMPORT,
+	"export":    EXPORT,
 	"while":     WHILE,
 	"package":   PACKAGE,
 	"break":     BREAK,
+	"continue":  CONTINUE,
 	"for":       FOR,
+	"in":        IN,
 	"class":     CLASS,
 	"new":       NEW,
 	"extends":   EXTENDS,
 	"implement": IMPLEMENT,
 	"interface": INTERFACE,
 	"defer":     DEFER,
+	"try":       TRY,
+	"catch":     CATCH,
+	"finally":   FINALLY,
+	"throw":     THROW,
+	"null":      NULL,
 }
 
 func LookIndent(indent string) TokenType {
@@ -0,0 +1,128 @@
+package vet
+
+import (
+	"fmt"
+	"strings"
+	"z/ast"
+	"z/module"
+	"z/symbols"
+)
+
+// builtinArities are the arguments the builtins check for, object.Builtins does not record them
+var builtinArities = map[string]symbols.Arity{
+	"len":               {Min: 1, Max: 1},
+	"puts":              {Min: 0, Max: -1},
+	"push":              {Min: 2, Max: 2},
+	"execute":           {Min: 1, Max: 1},
+	"mysql_init":        {Min: 4, Max: 4},
+	"mysql_query":       {Min: 1, Max: 1},
+	"typeof":            {Min: 1, Max: 1},
+	"fetch":             {Min: 1, Max: 2},
+	"json_encode":       {Min: 1, Max: 2},
+	"json_decode":       {Min: 1, Max: 1},
+	"json_stream":       {Min: 1, Max: 1},
+	"with_error":        {Min: 2, Max: 2},
+	"is_with_error":     {Min: 1, Max: 1},
+	"get_error_message": {Min: 1, Max: 1},
+	"syscall":           {Min: 1, Max: 4},
+	"stack_trace":       {Min: 1, Max: 1},
+	"version":           {Min: 0, Max: 0},
+	"file_get_contents": {Min: 1, Max: 1},
+	"file_put_contents": {Min: 2, Max: 2},
+	"http_server":       {Min: 2, Max: 2},
+	"byte_len":          {Min: 1, Max: 1},
+	"bytes":             {Min: 1, Max: 1},
+	"from_bytes":        {Min: 1, Max: 1},
+	"keys":              {Min: 1, Max: 1},
+	"values":            {Min: 1, Max: 1},
+	"delete":            {Min: 2, Max: 2},
+	"has_key":           {Min: 2, Max: 2},
+	"merge":             {Min: 1, Max: -1},
+	"append":            {Min: 1, Max: -1},
+	"pop":               {Min: 1, Max: 1},
+	"shift":             {Min: 1, Max: 1},
+	"insert":            {Min: 3, Max: 3},
+	"remove":            {Min: 2, Max: 2},
+	"sort":              {Min: 1, Max: 2},
+	"reverse":           {Min: 1, Max: 1},
+}
+
+type scope struct {
+	*symbols.Scope
+	watch bool              // whether the lets of the scope are reported when they are not used
+	lets  []*symbols.Symbol // the lets of the scope in the order they are written
+}
+
+func newScope(outer *scope, watch bool) *scope {
+	var outerScope *symbols.Scope
+	if outer != nil {
+		outerScope = outer.Scope
+	}
+	return &scope{Scope: symbols.NewScope(outerScope), watch: watch}
+}
+
+// parseFile parses a file and fails when it has errors, vet does not check programs that do not parse
+func parseFile(path string, src string) (*symbols.File, error) {
+	f := symbols.ParseFile(path, src)
+	if len(f.Errors) > 0 {
+		messages := []string{}
+		for _, err := range f.Errors {
+			messages = append(messages, err.Error())
+		}
+		return nil, fmt.Errorf("%s", strings.Join(messages, "\n"))
+	}
+	return f, nil
+}
+
+// globals are the builtins and the names exported by the prelude and by the files f imports,
+// the files they import in turn are not seen by f
+func globals(f *symbols.File, resolver *module.Resolver) (*scope, error) {
+	sc := newScope(nil, false)
+	for name, a := range builtinArities {
+		a := a
+		sc.Define(&symbols.Symbol{Name: name, Arity: &a})
+	}
+
+	prelude := resolver.Prelude()
+	if src, err := resolver.ReadFile(prelude); err == nil && f.Path != prelude {
+		if f, err := parseFile(prelude, string(src)); err == nil {
+			export(f, sc)
+		}
+	}
+	for _, imp := range f.Imports {
+		path := resolver.Resolve(f.Path, imp.Path)
+		src, err := resolver.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: import file not exists: %s", imp.PathPos, path)
+		}
+		imported, err := parseFile(path, string(src))
+		if err != nil {
+			return nil, err
+		}
+		export(imported, sc)
+	}
+	return sc, nil
+}
+
+// export defines the names an imported file exports, prefixed by its package.
+// Other files may give them new values, so only their functions and classes are kept
+func export(f *symbols.File, sc *scope) {
+	exported := map[string]bool{}
+	for _, name := range module.Exports(f.Program) {
+		exported[name] = true
+	}
+	for _, stmt := range f.Program.Statements {
+		sym := symbols.Declaration(stmt)
+		if sym == nil || !exported[sym.Name] {
+			continue
+		}
+		if _, ok := stmt.(*ast.LetStatement); ok {
+			sym.Arity = nil
+		}
+		sym.Value = ""
+		if f.PackageName != "" {
+			sym.Name = f.PackageName + "." + sym.Name
+		}
+		sc.Define(sym)
+	}
+}
@@ -0,0 +1,487 @@
+// Package vet reports the mistakes a z program makes without running it: names never used or never defined,
+// calls with the wrong number of arguments, code that cannot run and the like.
+// A finding is silenced by a "// vet:ignore rule..." comment on its line or on the line above,
+// the comment silences every rule when it names none
+package vet
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"z/ast"
+	"z/module"
+	"z/symbols"
+	"z/token"
+)
+
+// the rules a finding is reported by
+const (
+	UnusedLet        = "unused-let"
+	Undefined        = "undefined"
+	Arity            = "arity"
+	Unreachable      = "unreachable"
+	BreakOutsideLoop = "break-outside-loop"
+	AssignUndeclared = "assign-undeclared"
+	NotObject        = "not-object"
+)
+
+const ignoreDirective = "vet:ignore"
+
+// Finding is a problem found in a program
+type Finding struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s (%s)", f.Pos, f.Message, f.Rule)
+}
+
+// File vets the source file at path
+func File(path string, resolver *module.Resolver) ([]Finding, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Source(path, string(src), resolver)
+}
+
+// Source vets src as the file at path, the files it imports and the prelude are found by resolver and read from the disk.
+// It fails when the program or one of its imports does not parse
+func Source(path string, src string, resolver *module.Resolver) ([]Finding, error) {
+	f, err := parseFile(path, src)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := globals(f, resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first pass finds the names given new values, a loop may assign one after its use
+	first := &checker{assigned: map[string]bool{}}
+	first.statements(f.Program.Statements, nil, fileScope(f, sc))
+	c := &checker{assigned: first.assigned}
+	c.statements(f.Program.Statements, nil, fileScope(f, sc))
+
+	findings := []Finding{}
+	ignored := ignores(f)
+	for _, finding := range c.findings {
+		if !ignored.covers(finding) {
+			findings = append(findings, finding)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Pos, findings[j].Pos
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return findings, nil
+}
+
+// fileScope holds the names of a package with their prefix too, the names of the file are declared as it is checked
+func fileScope(f *symbols.File, globals *scope) *scope {
+	sc := newScope(globals, false)
+	if f.PackageName == "" {
+		return sc
+	}
+	for _, stmt := range f.Program.Statements {
+		if sym := symbols.Declaration(stmt); sym != nil {
+			sym.Name = f.PackageName + "." + sym.Name
+			sc.Define(sym)
+		}
+	}
+	return sc
+}
+
+// ignored holds the rules silenced on each line, an empty list silences them all
+type ignored map[int][]string
+
+func ignores(f *symbols.File) ignored {
+	lines := ignored{}
+	for _, comment := range f.Comments {
+		text := strings.TrimPrefix(strings.TrimPrefix(comment.Text, "//"), "/*")
+		text = strings.TrimSpace(strings.TrimSuffix(text, "*/"))
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+		rules := strings.FieldsFunc(text[len(ignoreDirective):], func(r rune) bool {
+			return r == ' ' || r == ',' || r == '\t'
+		})
+		end := comment.Pos.Line + strings.Count(comment.Text, "\n")
+		lines[end] = append(lines[end], rules...)
+		if len(rules) == 0 {
+			lines[end] = []string{}
+		}
+	}
+	return lines
+}
+
+func (ig ignored) covers(finding Finding) bool {
+	for _, line := range []int{finding.Pos.Line, finding.Pos.Line - 1} {
+		rules, ok := ig[line]
+		if !ok {
+			continue
+		}
+		if len(rules) == 0 {
+			return true
+		}
+		for _, rule := range rules {
+			if rule == finding.Rule {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type checker struct {
+	findings []Finding
+	assigned map[string]bool // the names given a new value with =, what they hold is not known
+	loops    int             // the loops around the code being checked, in the current function
+}
+
+func (c *checker) report(pos token.Position, rule string, format string, a ...interface{}) {
+	c.findings = append(c.findings, Finding{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, a...)})
+}
+
+// statements checks the statements of a block, the defer blocks run in its scope too.
+// The names the block declares are known to all of it, a function may use one declared after it
+func (c *checker) statements(stmts []ast.Statement, defers []*ast.BlockStatement, sc *scope) {
+	all := append([]ast.Statement{}, stmts...)
+	for _, deferred := range defers {
+		if deferred != nil {
+			all = append(all, deferred.Statements...)
+		}
+	}
+	for _, stmt := range all {
+		c.predeclare(stmt, sc)
+	}
+
+	terminated, reported := false, false
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		if terminated && !reported {
+			c.report(stmt.Pos(), Unreachable, "unreachable code")
+			reported = true // once for each block
+		}
+		c.statement(stmt, sc)
+		terminated = terminated || c.terminates(stmt)
+	}
+	for _, deferred := range defers {
+		if deferred != nil {
+			for _, stmt := range deferred.Statements {
+				c.statement(stmt, sc)
+			}
+		}
+	}
+
+	if sc.watch {
+		for _, sym := range sc.lets {
+			if !sym.Used && !strings.HasPrefix(sym.Name, "_") {
+				c.report(sym.Pos, UnusedLet, "%s declared and not used", sym.Name)
+			}
+		}
+	}
+}
+
+// terminates tells whether the statements after stmt in its block never run,
+// a break or a continue outside a loop does not stop anything
+func (c *checker) terminates(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	case *ast.ExpressionStatement:
+		switch stmt.Expression.(type) {
+		case *ast.BreakExpression, *ast.ContinueExpression:
+			return c.loops > 0
+		}
+	}
+	return false
+}
+
+func (c *checker) predeclare(stmt ast.Statement, sc *scope) {
+	sym := symbols.Declaration(stmt)
+	if sym == nil {
+		return
+	}
+	if previous, ok := sc.Symbols[sym.Name]; ok {
+		// declared twice, it is not known which value a use sees
+		previous.Arity = nil
+		previous.Value = ""
+		return
+	}
+	sc.Define(sym)
+	if _, ok := stmt.(*ast.LetStatement); ok && sc.watch {
+		sc.lets = append(sc.lets, sym)
+	}
+}
+
+func (c *checker) statement(stmt ast.Statement, sc *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.expression(stmt.Value, sc)
+		if stmt.Name != nil {
+			if _, ok := sc.Symbols[stmt.Name.Value]; !ok {
+				c.predeclare(stmt, sc)
+			}
+		}
+	case *ast.ReturnStatement:
+		c.expression(stmt.ReturnValue, sc)
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression, sc)
+	case *ast.ThrowStatement:
+		c.expression(stmt.Value, sc)
+	}
+}
+
+// identifier checks the use of a name
+func (c *checker) identifier(ident *ast.Identifier, sc *scope) *symbols.Symbol {
+	if ident == nil {
+		return nil
+	}
+	switch ident.Value {
+	case "__FILE__", "__DIR__":
+		return nil
+	case "this":
+		if sc.EnclosingClass() == nil {
+			c.report(ident.Pos(), Undefined, "this used outside a class")
+		}
+		return nil
+	}
+	sym := lookup(ident, sc)
+	if sym == nil {
+		c.report(ident.Pos(), Undefined, "undefined: %s", ident.Value)
+		return nil
+	}
+	sym.Used = true
+	return sym
+}
+
+// lookup finds the symbol of a name like the evaluator does: the names a program declares hide the builtins
+// but for the fields and methods of classes, a name is tried with the package of its file too
+func lookup(ident *ast.Identifier, sc *scope) *symbols.Symbol {
+	sym := declared(ident.Value, sc.Scope)
+	if sym == nil && ident.PackageName != "" {
+		sym = declared(ident.PackageName+"."+ident.Value, sc.Scope)
+	}
+	return sym
+}
+
+// declared finds name in sc and the scopes around it, a class member with the name of a builtin is the builtin
+func declared(name string, sc *symbols.Scope) *symbols.Symbol {
+	for ; sc != nil; sc = sc.Outer {
+		sym, ok := sc.Symbols[name]
+		if !ok {
+			continue
+		}
+		if _, builtin := builtinArities[name]; builtin && sc.Class != nil {
+			for sc.Outer != nil {
+				sc = sc.Outer
+			}
+			return sc.Symbols[name]
+		}
+		return sym
+	}
+	return nil
+}
+
+// block checks a block in a scope of its own
+func (c *checker) block(block *ast.BlockStatement, sc *scope) {
+	if block == nil {
+		return
+	}
+	c.statements(block.Statements, block.Defers, newScope(sc, true))
+}
+
+func (c *checker) expression(e ast.Expression, sc *scope) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		c.identifier(e, sc)
+	case *ast.PrefixExpression:
+		c.expression(e.Right, sc)
+	case *ast.InfixExpression:
+		c.infix(e, sc)
+	case *ast.IfExpression:
+		ifScope := newScope(sc, true)
+		c.expression(e.Condition, ifScope)
+		c.block(e.Consequence, ifScope)
+		c.block(e.Alternative, ifScope)
+	case *ast.BlockStatement:
+		c.block(e, sc)
+	case *ast.BreakExpression:
+		if c.loops == 0 {
+			c.report(e.Pos(), BreakOutsideLoop, "break outside a loop")
+		}
+	case *ast.ContinueExpression:
+		if c.loops == 0 {
+			c.report(e.Pos(), BreakOutsideLoop, "continue outside a loop")
+		}
+	case *ast.FunctionLiteral:
+		c.function(e, sc)
+	case *ast.CallExpression:
+		c.call(e, sc)
+	case *ast.ArrayLiteral:
+		for _, element := range e.Elements {
+			c.expression(element, sc)
+		}
+	case *ast.TemplateLiteral:
+		for _, part := range e.Parts {
+			c.expression(part, sc)
+		}
+	case *ast.IndexExpression:
+		c.expression(e.Left, sc)
+		c.expression(e.Index, sc)
+		c.expression(e.High, sc)
+	case *ast.HashLiteral:
+		for _, key := range e.Keys {
+			c.expression(key, sc)
+			c.expression(e.Pairs[key], sc)
+		}
+	case *ast.WhileExpression:
+		loopScope := newScope(sc, true)
+		c.expression(e.Condition, loopScope)
+		c.loop(e.Body, loopScope)
+	case *ast.ForExpression:
+		loopScope := newScope(sc, true)
+		c.statement(e.Initor, loopScope)
+		c.expression(e.Condition, loopScope)
+		c.expression(e.After, loopScope)
+		c.loop(e.Body, loopScope)
+	case *ast.ForInExpression:
+		c.expression(e.Collection, sc)
+		loopScope := newScope(sc, true)
+		for _, name := range e.Names {
+			loopScope.Define(&symbols.Symbol{Name: name.Value, Pos: name.Pos()})
+		}
+		c.loop(e.Body, loopScope)
+	case *ast.ClassExpress:
+		c.class(e, sc)
+	case *ast.ObjectExpress:
+		c.identifier(e.Class, sc)
+		for _, param := range e.Parameters {
+			c.expression(param, sc)
+		}
+	case *ast.TryExpression:
+		c.block(e.Block, sc)
+		catchScope := newScope(sc, true)
+		if e.Parameter != nil {
+			catchScope.Define(&symbols.Symbol{Name: e.Parameter.Value, Pos: e.Parameter.Pos()})
+		}
+		c.block(e.Catch, catchScope)
+		c.block(e.Finally, sc)
+	}
+}
+
+// loop checks the body of a loop, it runs in the scope of the loop
+func (c *checker) loop(body *ast.BlockStatement, sc *scope) {
+	c.loops++
+	if body != nil {
+		c.statements(body.Statements, body.Defers, sc)
+	}
+	c.loops--
+}
+
+func (c *checker) infix(e *ast.InfixExpression, sc *scope) {
+	switch e.Operator {
+	case "=":
+		c.expression(e.Right, sc)
+		ident, ok := e.Left.(*ast.Identifier)
+		if !ok {
+			c.expression(e.Left, sc)
+			return
+		}
+		c.assigned[ident.Value] = true
+		if lookup(ident, sc) == nil {
+			c.report(ident.Pos(), AssignUndeclared, "assignment to undeclared %s", ident.Value)
+			sc.Define(&symbols.Symbol{Name: ident.Value, Pos: ident.Pos()})
+		}
+	case "->", "::", "?->":
+		// the right side is a member name, not a variable
+		c.expression(e.Left, sc)
+		if e.Operator == "->" {
+			c.objectGet(e, sc)
+		}
+	default:
+		c.expression(e.Left, sc)
+		c.expression(e.Right, sc)
+	}
+}
+
+// objectGet reports a -> on a value that is definitely not an object
+func (c *checker) objectGet(e *ast.InfixExpression, sc *scope) {
+	kind := symbols.ValueKind(e.Left)
+	if ident, ok := e.Left.(*ast.Identifier); ok && !c.assigned[ident.Value] {
+		if sym := lookup(ident, sc); sym != nil {
+			kind = sym.Value
+		}
+	}
+	if kind != "" {
+		c.report(e.Left.Pos(), NotObject, "-> on %s, a %s is not an object", e.Left.String(), kind)
+	}
+}
+
+func (c *checker) call(e *ast.CallExpression, sc *scope) {
+	c.expression(e.Function, sc)
+	for _, arg := range e.Arguments {
+		c.expression(arg, sc)
+	}
+	ident, ok := e.Function.(*ast.Identifier)
+	if !ok || c.assigned[ident.Value] {
+		return
+	}
+	sym := lookup(ident, sc)
+	if sym == nil || sym.Arity == nil || sym.Arity.Accepts(len(e.Arguments)) {
+		return
+	}
+	c.report(e.Pos(), Arity, "wrong number of arguments to %s. got=%d, want=%s", ident.Value, len(e.Arguments), sym.Arity)
+}
+
+// function checks a function in a scope of its own, a named function is declared where it is written
+func (c *checker) function(fn *ast.FunctionLiteral, sc *scope) {
+	if fn.Name != "" && sc.Class == nil && sc.Symbols[fn.Name] == nil {
+		sc.Define(symbols.FunctionSymbol(fn, symbols.Function))
+	}
+	fnScope := newScope(sc, true)
+	for _, param := range fn.Parameters {
+		if param == nil {
+			continue
+		}
+		c.expression(param.Default, fnScope)
+		fnScope.Define(&symbols.Symbol{Name: param.Value, Pos: param.Pos()})
+	}
+	loops := c.loops
+	c.loops = 0
+	if fn.Body != nil {
+		c.statements(fn.Body.Statements, fn.Body.Defers, fnScope)
+	}
+	c.loops = loops
+}
+
+// class checks the fields and methods of a class, they see the members of the class without this
+func (c *checker) class(class *ast.ClassExpress, sc *scope) {
+	for _, parent := range class.Parents {
+		c.identifier(parent, sc)
+	}
+	c.identifier(class.Interface, sc)
+	classScope := newScope(sc, false)
+	classScope.Class = class
+	for _, sym := range symbols.Members(class, sc.Scope) {
+		if _, ok := classScope.Symbols[sym.Name]; !ok {
+			classScope.Define(sym)
+		}
+	}
+	for _, let := range class.LetStatements {
+		if let != nil {
+			c.expression(let.Value, classScope)
+		}
+	}
+	for _, fn := range class.Functions {
+		if fn != nil {
+			c.function(fn, classScope)
+		}
+	}
+}
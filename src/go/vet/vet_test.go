@@ -0,0 +1,141 @@
+package vet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"z/module"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string // line:column rule
+	}{
+		{
+			"clean",
+			"let a = 1\nfn add(x, y = 2) { x + y }\nputs(add(a), len(\"ab\"))",
+			nil,
+		},
+		{
+			"unused let",
+			"fn f() {\n  let used = 1\n  let unused = 2\n  let _skipped = 3\n  return used\n}\nlet top = 1",
+			[]string{"3:7 unused-let"},
+		},
+		{
+			"undefined",
+			"fn f(x) { x + y }\nputs(z, __FILE__, f(1))\nthis",
+			[]string{"1:15 undefined", "2:6 undefined", "3:1 undefined"},
+		},
+		{
+			"declared later",
+			"fn f() { g() }\nfn g() { 1 }\ntry { f() } catch (e) { puts(e) }",
+			nil,
+		},
+		{
+			"arity",
+			"fn f(a, b = 1) { a }\nf()\nf(1)\nf(1, 2, 3)\nlen(1, 2)\nputs()\nlet g = fn(x) { x }\ng(1, 2)",
+			[]string{"2:2 arity", "4:2 arity", "5:4 arity", "8:2 arity"},
+		},
+		{
+			"a builtin hides a method",
+			"class A {\n  let items = []\n  fn push(x) { items = push(items, x) }\n}",
+			nil,
+		},
+		{
+			"a function hides a builtin",
+			"fn keys(h, all) { h }\nkeys({}, true)",
+			nil,
+		},
+		{
+			"unreachable",
+			"fn f() {\n  return 1\n  puts(2)\n  puts(3)\n}\nwhile (true) {\n  break\n  puts(4)\n}\nfn g() { throw \"e\"\n  1 }",
+			[]string{"3:3 unreachable", "8:3 unreachable", "11:3 unreachable"},
+		},
+		{
+			"break outside a loop",
+			"break\nwhile (true) {\n  if (true) { break }\n  fn f() { break }\n}\nfor (let i = 0; i < 3; i++) { try { break } catch (e) { puts(e) } }",
+			[]string{"1:1 break-outside-loop", "4:12 break-outside-loop"},
+		},
+		{
+			"for in loops",
+			"outer: for (k, v in {\"a\": 1}) {\n  for (x in [k]) { continue outer\n  puts(x) }\n}\ncontinue",
+			[]string{"3:3 unreachable", "5:1 break-outside-loop"},
+		},
+		{
+			"assignment to undeclared names",
+			"let a = 1\na = 2\nb = 3\nputs(b)",
+			[]string{"3:1 assign-undeclared"},
+		},
+		{
+			"not an object",
+			"let n = 1\nn->x\n\"s\"->len\nlet o = new A()\no->x\nlet m = 1\nm = new A()\nm->x\nclass A { let x = 1 }\nA->x",
+			[]string{"2:1 not-object", "3:1 not-object", "10:1 not-object"},
+		},
+		{
+			"classes",
+			"class A extends B {\n  let x = 1\n  fn get() { this->x + x + y + parent() }\n}\nclass B { fn parent() { 1 } }",
+			[]string{"3:28 undefined"},
+		},
+		{
+			"ignore comments",
+			"fn f() {\n  let a = 1 // vet:ignore unused-let\n  // vet:ignore\n  let b = 2\n  // vet:ignore arity\n  let c = 3\n}",
+			[]string{"6:7 unused-let"},
+		},
+	}
+
+	for _, tt := range tests {
+		findings, err := Source("test.z", tt.input, module.NewResolver("", ""))
+		if err != nil {
+			t.Errorf("%s: vet failed: %s", tt.name, err)
+			continue
+		}
+		got := []string{}
+		for _, finding := range findings {
+			got = append(got, fmt.Sprintf("%d:%d %s", finding.Pos.Line, finding.Pos.Column, finding.Rule))
+		}
+		if strings.Join(got, ", ") != strings.Join(tt.expected, ", ") {
+			t.Errorf("%s: wrong findings.\nexpected=%v\ngot=     %v (%v)", tt.name, tt.expected, got, findings)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"geometry.z": "package geometry\nfn area(w, h) { w * h }\nfn square(s) { area(s, s) }",
+		"main.z":     "import \"geometry\"\nputs(geometry.area(1), geometry.square(2), geometry.volume(3))",
+		"broken.z":   "import \"missing\"\nputs(1)",
+		"shapes.z":   "import \"geometry\"\nexport fn box() { geometry.square(1) }\nfn hidden() { 1 }",
+		"exports.z":  "import \"shapes\"\nputs(box(), hidden(), geometry.area(1, 2))",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	findings, err := File(filepath.Join(dir, "main.z"), module.NewResolver("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || findings[0].Rule != Arity || findings[1].Rule != Undefined {
+		t.Errorf("wrong findings. got=%v", findings)
+	}
+	if findings, err := File(filepath.Join(dir, "geometry.z"), module.NewResolver("", "")); err != nil || len(findings) != 0 {
+		t.Errorf("a package has findings. got=%v, %v", findings, err)
+	}
+	findings, err = File(filepath.Join(dir, "exports.z"), module.NewResolver("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 || findings[0].Rule != Undefined || findings[1].Rule != Undefined {
+		t.Errorf("names that are not exported are seen. got=%v", findings)
+	}
+	if _, err := File(filepath.Join(dir, "broken.z"), module.NewResolver("", "")); err == nil || !strings.Contains(err.Error(), "import file not exists") {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
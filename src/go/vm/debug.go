@@ -0,0 +1,121 @@
+package vm
+
+import (
+	"errors"
+	"z/debug"
+	"z/object"
+	"z/token"
+)
+
+// ErrStopped is returned by Run when the debugger stops the program
+var ErrStopped = errors.New("stopped by the debugger")
+
+// Debugger pauses a VM at breakpoints and after steps.
+// Pause is called with the VM stopped before an instruction and returns how to go on, Stop ends Run with ErrStopped.
+// The VM can be inspected with Position, CallStack, Locals, FreeVariables, Globals and OperandStack meanwhile.
+// Breakpoints may be changed and Interrupt called from other goroutines while the program runs
+type Debugger struct {
+	Pause func(vm *VM, reason debug.PauseReason) debug.StepMode
+	*debug.Stepper
+}
+
+// NewDebugger makes a debugger that pauses before the first line of the program
+func NewDebugger(pause func(vm *VM, reason debug.PauseReason) debug.StepMode) *Debugger {
+	return &Debugger{Pause: pause, Stepper: debug.NewStepper()}
+}
+
+// SetDebugger attaches d to the VM, it must be called before Run
+func (vm *VM) SetDebugger(d *Debugger) {
+	vm.debugger = d
+}
+
+// before is called by run before the instruction at ip of the current frame
+func (d *Debugger) before(vm *VM, ip int) error {
+	pos := vm.currentFrame().cl.Fn.SourceMap.Lookup(ip)
+	stop := d.Before(pos, vm.framesIndex, func(reason debug.PauseReason) debug.StepMode {
+		return d.Pause(vm, reason)
+	})
+	if stop {
+		return ErrStopped
+	}
+	return nil
+}
+
+// Variable is a named value shown by the debugger
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Position is the source position of the instruction the VM is paused at
+func (vm *VM) Position() token.Position {
+	frame := vm.currentFrame()
+	return frame.cl.Fn.SourceMap.Lookup(frame.ip)
+}
+
+// CallStack lists the active frames, innermost first
+func (vm *VM) CallStack() object.Stack {
+	return vm.stackTrace()
+}
+
+// frame returns the frame at index of CallStack
+func (vm *VM) frame(index int) *Frame {
+	return vm.frames[vm.framesIndex-1-index]
+}
+
+// Locals are the parameters and local variables that have a value in the function of the frame at index of CallStack
+func (vm *VM) Locals(index int) []Variable {
+	if index == vm.framesIndex-1 {
+		return nil // the main program only has globals
+	}
+	frame := vm.frame(index)
+	variables := []Variable{}
+	for i, name := range frame.cl.Fn.LocalNames {
+		if value := deref(vm.stack[frame.basePointer+i]); value != nil {
+			variables = append(variables, Variable{name, value})
+		}
+	}
+	return variables
+}
+
+// FreeVariables are the variables the closure of the frame at index of CallStack captured from the functions around it
+func (vm *VM) FreeVariables(index int) []Variable {
+	cl := vm.frame(index).cl
+	variables := []Variable{}
+	for i, name := range cl.Fn.FreeNames {
+		if i < len(cl.Free) {
+			variables = append(variables, Variable{name, deref(cl.Free[i])})
+		}
+	}
+	return variables
+}
+
+// Globals are the global variables that have a value
+func (vm *VM) Globals() []Variable {
+	variables := []Variable{}
+	for i, name := range vm.globalNames {
+		if value := vm.globals[i]; value != nil {
+			variables = append(variables, Variable{name, value})
+		}
+	}
+	return variables
+}
+
+// LookupVariable finds a variable like the function of the frame at index of CallStack would:
+// in its locals, then its free variables, then the globals
+func (vm *VM) LookupVariable(index int, name string) (object.Object, bool) {
+	scopes := [][]Variable{vm.Locals(index), vm.FreeVariables(index), vm.Globals()}
+	for _, variables := range scopes {
+		for _, variable := range variables {
+			if variable.Name == name {
+				return variable.Value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// OperandStack is the stack of the VM, the bottom first
+func (vm *VM) OperandStack() []object.Object {
+	return vm.stack[:vm.sp]
+}
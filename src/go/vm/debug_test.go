@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"z/compile"
+	"z/debug"
+)
+
+const debugInput = `let total = 0
+let add = fn(a, b) {
+	let sum = a + b
+	return sum
+}
+let twice = fn(x) {
+	let once = add(x, x)
+	return once
+}
+total = twice(3)
+total = add(total, 1)
+`
+
+// debugLines runs debugInput and returns the lines it paused at, modes are the answers to the pauses
+func debugLines(t *testing.T, breakpoints []debug.Breakpoint, modes ...debug.StepMode) []int {
+	t.Helper()
+	comp := compile.New()
+	if err := comp.Compile(parse(debugInput)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	lines := []int{}
+	debugger := NewDebugger(func(vm *VM, reason debug.PauseReason) debug.StepMode {
+		lines = append(lines, vm.Position().Line)
+		if len(modes) == 0 {
+			return debug.Continue
+		}
+		mode := modes[0]
+		modes = modes[1:]
+		return mode
+	})
+	debugger.SetBreakpoints(breakpoints)
+	machine.SetDebugger(debugger)
+	if err := machine.Run(); err != nil && err != ErrStopped {
+		t.Fatalf("vm error: %s", err)
+	}
+	return lines
+}
+
+func TestDebuggerSteps(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakpoints []debug.Breakpoint
+		modes       []debug.StepMode
+		expected    []int
+	}{
+		{"continue", nil, nil, []int{1}},
+		{"step over", nil, []debug.StepMode{debug.StepOver, debug.StepOver, debug.StepOver, debug.StepOver, debug.StepOver}, []int{1, 2, 6, 10, 11}},
+		{"step into", nil, []debug.StepMode{debug.StepOver, debug.StepOver, debug.StepOver, debug.StepInto, debug.StepInto, debug.StepInto, debug.StepInto, debug.StepInto, debug.StepInto, debug.StepInto},
+			[]int{1, 2, 6, 10, 7, 3, 4, 7, 8, 10, 11}},
+		{"step out", nil, []debug.StepMode{debug.StepOver, debug.StepOver, debug.StepOver, debug.StepInto, debug.StepInto, debug.StepOut, debug.StepOut}, []int{1, 2, 6, 10, 7, 3, 7, 10}},
+		{"breakpoints", []debug.Breakpoint{{Line: 3}}, nil, []int{1, 3, 3}},
+		{"breakpoint in file", []debug.Breakpoint{{FileName: "other.z", Line: 3}}, nil, []int{1}},
+		{"stop", []debug.Breakpoint{{Line: 3}}, []debug.StepMode{debug.Continue, debug.Stop}, []int{1, 3}},
+	}
+	for _, tt := range tests {
+		lines := debugLines(t, tt.breakpoints, tt.modes...)
+		if !reflect.DeepEqual(lines, tt.expected) {
+			t.Errorf("%s: wrong pauses. want=%v, got=%v", tt.name, tt.expected, lines)
+		}
+	}
+}
+
+func TestDebuggerInspection(t *testing.T) {
+	input := `let base = 10
+let adder = fn(n) {
+	fn(x) {
+		let sum = base + n + x
+		sum
+	}
+}
+adder(2)(3)
+`
+	comp := compile.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	var locals, free, outerLocals, globals string
+	var stack []string
+	debugger := NewDebugger(func(vm *VM, reason debug.PauseReason) debug.StepMode {
+		if reason != debug.PausedBreakpoint {
+			return debug.Continue
+		}
+		locals = fmt.Sprint(variableStrings(vm.Locals(0)))
+		free = fmt.Sprint(variableStrings(vm.FreeVariables(0)))
+		outerLocals = fmt.Sprint(variableStrings(vm.Locals(1)))
+		globals = fmt.Sprint(variableStrings(vm.Globals()))
+		for _, frame := range vm.CallStack() {
+			stack = append(stack, fmt.Sprintf("%s %d", frame.Function, frame.Position.Line))
+		}
+		return debug.Continue
+	})
+	debugger.SetBreakpoints([]debug.Breakpoint{{Line: 5}})
+	machine.SetDebugger(debugger)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if locals != "[x=3 sum=15]" {
+		t.Errorf("wrong locals. got=%s", locals)
+	}
+	if free != "[n=2]" {
+		t.Errorf("wrong free variables. got=%s", free)
+	}
+	if outerLocals != "[]" {
+		t.Errorf("main should have no locals. got=%s", outerLocals)
+	}
+	if !strings.HasPrefix(globals, "[base=10 adder=fn(") {
+		t.Errorf("wrong globals. got=%s", globals)
+	}
+	if !reflect.DeepEqual(stack, []string{"fn 5", "main 8"}) {
+		t.Errorf("wrong call stack. got=%v", stack)
+	}
+}
+
+func variableStrings(variables []Variable) []string {
+	values := []string{}
+	for _, variable := range variables {
+		values = append(values, variable.Name+"="+variable.Value.Inspect())
+	}
+	return values
+}
+
+func TestDebuggerInterrupt(t *testing.T) {
+	comp := compile.New()
+	if err := comp.Compile(parse(debugInput)); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	reasons := []debug.PauseReason{}
+	var debugger *Debugger
+	debugger = NewDebugger(func(vm *VM, reason debug.PauseReason) debug.StepMode {
+		reasons = append(reasons, reason)
+		if len(reasons) == 1 {
+			debugger.Interrupt()
+		}
+		return debug.Continue
+	})
+	machine.SetDebugger(debugger)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if !reflect.DeepEqual(reasons, []debug.PauseReason{debug.PausedStep, debug.PausedInterrupt}) {
+		t.Errorf("wrong pause reasons. got=%v", reasons)
+	}
+}
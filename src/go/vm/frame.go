@@ -6,9 +6,10 @@ import (
 )
 
 type Frame struct {
-	cl          *object.Closure
-	ip          int
-	basePointer int
+	cl            *object.Closure
+	ip            int
+	basePointer   int
+	isConstructor bool // an __init call made by new, it returns the new object instead of its own result
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"strings"
 	"z/code"
 	"z/compile"
 	"z/object"
@@ -11,9 +12,9 @@ const StackSize = 2048
 const GlobalSize = 65536
 const MaxFrames = 1024
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 type VM struct {
 	constants   []object.Object
@@ -22,10 +23,30 @@ type VM struct {
 	globals     []object.Object
 	frames      []*Frame
 	framesIndex int
+	handlers    []handler
+	globalNames []string
+	debugger    *Debugger
+	returnAt    int // run stops when a frame returns to this many frames, for the calls of callBack
+}
+
+// handler is an active try block, an error raised while it is active unwinds to catchIP
+type handler struct {
+	catchIP     int
+	framesIndex int
+	sp          int
+}
+
+// thrownError is raised by OpThrow, it carries the thrown value wrapped in an error object
+type thrownError struct {
+	err *object.Error
+}
+
+func (e *thrownError) Error() string {
+	return e.err.Message
 }
 
 func New(bytecode *compile.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -39,6 +60,7 @@ func New(bytecode *compile.Bytecode) *VM {
 		globals:     make([]object.Object, GlobalSize),
 		frames:      frames,
 		framesIndex: 1,
+		globalNames: bytecode.GlobalNames,
 	}
 }
 
@@ -52,7 +74,131 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// RuntimeError is an error raised while running bytecode, with the frames that were active at the time
+type RuntimeError struct {
+	Err   error
+	Stack object.Stack // innermost frame first
+}
+
+func (e *RuntimeError) Error() string {
+	if len(e.Stack) > 0 && e.Stack[0].Position.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Stack[0].Position, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Run executes the bytecode, a returned error is a *RuntimeError carrying the stack it was raised in.
+// Errors raised inside a try block are passed to its handler instead of being returned
 func (vm *VM) Run() error {
+	err := vm.runCatching(0)
+	if err == nil || err == ErrStopped {
+		return err
+	}
+	return &RuntimeError{Err: err, Stack: vm.errorObject(err).Stack}
+}
+
+// runCatching runs until the program ends, or until a call of callBack returns. An error raised in a try block
+// of a frame above base is passed to its handler, other errors are returned
+func (vm *VM) runCatching(base int) error {
+	for {
+		err := vm.run()
+		if err == nil || err == ErrStopped {
+			return err
+		}
+		if len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].framesIndex <= base {
+			return err
+		}
+		errObj := vm.errorObject(err)
+		h := vm.handlers[len(vm.handlers)-1]
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		vm.framesIndex = h.framesIndex
+		vm.sp = h.sp
+		vm.currentFrame().ip = h.catchIP - 1
+		errObj.Caught = true
+		err = vm.push(errObj)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// callBack calls a function of the program for a builtin like sort, running it until it returns
+func (vm *VM) callBack(fn object.Object, args ...object.Object) object.Object {
+	framesIndex, sp := vm.framesIndex, vm.sp
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err == nil && vm.framesIndex > framesIndex {
+		returnAt := vm.returnAt
+		vm.returnAt = framesIndex
+		err = vm.runCatching(framesIndex)
+		vm.returnAt = returnAt
+	}
+	if err != nil {
+		errObj := vm.errorObject(err)
+		vm.framesIndex, vm.sp = framesIndex, sp
+		vm.dropHandlers()
+		return errObj
+	}
+	return vm.pop()
+}
+
+// errorObject converts an error raised by run into the value handed to a catch block
+func (vm *VM) errorObject(err error) *object.Error {
+	if thrown, ok := err.(*thrownError); ok {
+		if thrown.err.Stack == nil {
+			thrown.err.Stack = vm.stackTrace()
+			thrown.err.Position = thrown.err.Stack[0].Position
+		}
+		return thrown.err
+	}
+	stack := vm.stackTrace()
+	return &object.Error{Message: err.Error(), Position: stack[0].Position, Stack: stack}
+}
+
+// throwValue wraps a thrown value in an error, throwing a caught error raises it again
+func throwValue(val object.Object) *thrownError {
+	if err, ok := val.(*object.Error); ok {
+		rethrown := *err
+		rethrown.Caught = false
+		return &thrownError{err: &rethrown}
+	}
+	return &thrownError{err: &object.Error{Message: val.Inspect(), ErrorType: object.THROWN_ERROR, Value: val}}
+}
+
+// dropHandlers discards the try blocks of frames that have returned
+func (vm *VM) dropHandlers() {
+	for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].framesIndex > vm.framesIndex {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+func (vm *VM) stackTrace() object.Stack {
+	stack := object.Stack{}
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		name := frame.cl.Fn.Name
+		if i == 0 {
+			name = "main"
+		} else if name == "" {
+			name = "fn"
+		}
+		stack = append(stack, object.StackFrame{Function: name, Position: frame.cl.Fn.SourceMap.Lookup(frame.ip)})
+	}
+	return stack
+}
+
+func (vm *VM) run() error {
 	var ip int
 	var ins code.Instructions
 	var op code.OpCode
@@ -61,6 +207,11 @@ func (vm *VM) Run() error {
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.OpCode(ins[ip])
+		if vm.debugger != nil {
+			if err := vm.debugger.before(vm, ip); err != nil {
+				return err
+			}
+		}
 		switch op {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[ip+1:])
@@ -69,7 +220,8 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
 			err := vm.executeBinaryOperation(op)
 			if err != nil {
 				return err
@@ -111,6 +263,15 @@ func (vm *VM) Run() error {
 			if !isTruthy(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpJumpNull, code.OpJumpNotNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			isNull := vm.stack[vm.sp-1].Type() == object.NULL_OBJ
+			if isNull == (op == code.OpJumpNull) {
+				vm.currentFrame().ip = pos - 1
+			} else if isNull {
+				vm.pop()
+			}
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -124,7 +285,11 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(ins[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
+			global := vm.globals[globalIndex]
+			if global == nil { // declared further down the program and not set yet
+				global = Null
+			}
+			err := vm.push(global)
 
 			if err != nil {
 				return err
@@ -133,13 +298,18 @@ func (vm *VM) Run() error {
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
-			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+			slot := frame.basePointer + int(localIndex)
+			if c, ok := vm.stack[slot].(*cell); ok {
+				c.value = vm.pop()
+			} else {
+				vm.stack[slot] = vm.pop()
+			}
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			frame := vm.currentFrame()
 
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			err := vm.push(deref(vm.stack[frame.basePointer+int(localIndex)]))
 
 			if err != nil {
 				return err
@@ -154,12 +324,23 @@ func (vm *VM) Run() error {
 			}
 		case code.OpReturnValue:
 			returnValue := vm.pop()
+			if vm.framesIndex == 1 { // return at the top level ends the program, returnValue stays the last popped element
+				vm.currentFrame().ip = len(vm.currentFrame().Instructions()) - 1
+				continue
+			}
 			frame := vm.popFrame()
+			vm.dropHandlers()
 			vm.sp = frame.basePointer - 1
+			if frame.isConstructor {
+				returnValue = frame.cl.This
+			}
 			err := vm.push(returnValue)
 			if err != nil {
 				return err
 			}
+			if vm.framesIndex == vm.returnAt {
+				return nil
+			}
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -171,6 +352,36 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpTemplate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			str := vm.buildTemplate(vm.sp-numParts, vm.sp)
+
+			vm.sp = vm.sp - numParts
+			err := vm.push(str)
+			if err != nil {
+				return err
+			}
+		case code.OpIterator:
+			collection := vm.pop()
+			iterator, ok := object.NewIterator(collection)
+			if !ok {
+				return fmt.Errorf("cannot iterate over %s", collection.Type())
+			}
+			err := vm.push(iterator)
+			if err != nil {
+				return err
+			}
+		case code.OpIteratorClose:
+			vm.pop().(*object.Iterator).Close()
+		case code.OpIteratorNext:
+			numNames := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+			err := vm.executeIteratorNext(numNames)
+			if err != nil {
+				return err
+			}
 		case code.OpHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
@@ -188,7 +399,20 @@ func (vm *VM) Run() error {
 			index := vm.pop()
 			left := vm.pop()
 
-			err := vm.executeIndexExpress(left, index)
+			err := vm.pushResult(object.Index(left, index))
+			if err != nil {
+				return err
+			}
+		case code.OpIndexKeep:
+			err := vm.pushResult(object.Index(vm.stack[vm.sp-2], vm.stack[vm.sp-1]))
+			if err != nil {
+				return err
+			}
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+			err := vm.pushResult(object.Slice(left, low, high))
 			if err != nil {
 				return err
 			}
@@ -212,18 +436,160 @@ func (vm *VM) Run() error {
 			freeIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			err := vm.push(deref(currentClosure.Free[freeIndex]))
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			slot := vm.currentFrame().basePointer + int(localIndex)
+			c, ok := vm.stack[slot].(*cell)
+			if !ok {
+				c = &cell{value: vm.stack[slot]}
+				vm.stack[slot] = c
+			}
+			err := vm.push(c)
+			if err != nil {
+				return err
+			}
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.push(vm.currentFrame().cl.Free[freeIndex])
 			if err != nil {
 				return err
 			}
 		case code.OpReturn:
 			frame := vm.popFrame()
+			vm.dropHandlers()
 			vm.sp = frame.basePointer - 1
-			err := vm.push(Null)
+			var returnValue object.Object = Null
+			if frame.isConstructor {
+				returnValue = frame.cl.This
+			}
+			err := vm.push(returnValue)
 
 			if err != nil {
 				return err
 			}
+			if vm.framesIndex == vm.returnAt {
+				return nil
+			}
+		case code.OpTry:
+			catchIP := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			vm.handlers = append(vm.handlers, handler{catchIP: catchIP, framesIndex: vm.framesIndex, sp: vm.sp})
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case code.OpThrow:
+			return throwValue(vm.pop())
+		case code.OpAnd, code.OpOr:
+			right := vm.pop()
+			left := vm.pop()
+			result := left
+			if isTruthy(left) == (op == code.OpAnd) {
+				result = right
+			}
+			err := vm.push(result)
+			if err != nil {
+				return err
+			}
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.currentFrame().cl.Free[freeIndex].(*cell).value = vm.pop()
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			left := vm.pop()
+			err := vm.pushResult(object.SetIndex(left, index, value))
+			if err != nil {
+				return err
+			}
+		case code.OpGetProperty, code.OpGetStatic:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name := vm.constants[nameIndex].(*object.String).Value
+			left := vm.pop()
+			var value object.Object
+			var err error
+			if op == code.OpGetProperty {
+				value, err = vm.getProperty(left, name)
+			} else {
+				value, err = vm.getStatic(left, name)
+			}
+			if err != nil {
+				return err
+			}
+			err = vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpGetField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name := vm.constants[nameIndex].(*object.String).Value
+			cl := vm.currentFrame().cl
+			if cl.Fields == nil {
+				return fmt.Errorf("member %s used outside of an object", name)
+			}
+			value, ok := cl.Fields.Get(name, "")
+			if !ok {
+				value = Null
+			}
+			if method, ok := value.(*object.Closure); ok && method.This == nil {
+				value = method.Bind(cl.This, cl.Fields)
+			}
+			err := vm.push(value)
+			if err != nil {
+				return err
+			}
+		case code.OpSetField:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			name := vm.constants[nameIndex].(*object.String).Value
+			fields := vm.currentFrame().cl.Fields
+			if fields == nil {
+				return fmt.Errorf("member %s used outside of an object", name)
+			}
+			value := vm.pop()
+			if fields.IsFormOuter(name, "") {
+				fields.OuterSet(name, value, "")
+			} else {
+				fields.Set(name, value, "")
+			}
+		case code.OpThis:
+			this := vm.currentFrame().cl.This
+			if this == nil {
+				return fmt.Errorf("this used outside of an object")
+			}
+			err := vm.push(this)
+			if err != nil {
+				return err
+			}
+		case code.OpClass:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			numMembers := int(code.ReadUint16(ins[ip+3:]))
+			numParents := int(code.ReadUint8(ins[ip+5:]))
+			vm.currentFrame().ip += 5
+			name := vm.constants[nameIndex].(*object.String).Value
+			class, err := vm.buildClass(name, vm.sp-numParents-numMembers, numMembers, numParents)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numParents - numMembers
+			err = vm.push(class)
+			if err != nil {
+				return err
+			}
+		case code.OpNew:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err := vm.executeNew(int(numArgs))
+			if err != nil {
+				return err
+			}
 		case code.OpCurrentClosure:
 			currentClosure := vm.currentFrame().cl
 			err := vm.push(currentClosure)
@@ -244,62 +610,168 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	}
 	free := make([]object.Object, numFree)
 	for i := 0; i < numFree; i++ {
-		free[i] = vm.stack[vm.sp-numFree+i]
+		value := vm.stack[vm.sp-numFree+i]
+		if _, ok := value.(*cell); !ok {
+			value = &cell{value: value}
+		}
+		free[i] = value
 	}
 	vm.sp = vm.sp - numFree
-	closure := &object.Closure{Fn: function, Free: free}
+	// functions created inside a method keep the object the method is bound to
+	current := vm.currentFrame().cl
+	closure := &object.Closure{Fn: function, Free: free, This: current.This, Fields: current.Fields}
 	return vm.push(closure)
 }
 
-func (vm *VM) executeIndexExpress(left, index object.Object) error {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return vm.executeArrayIndex(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return vm.executeHashIndex(left, index)
-	default:
-		return fmt.Errorf("index operator not supported: %s", left.Type())
+// cell holds a variable closures capture, the function that declares it and the closures read and assign it through the cell
+type cell struct {
+	value object.Object
+}
+
+func (c *cell) Type() object.ObjectType { return c.value.Type() }
+func (c *cell) Inspect() string         { return c.value.Inspect() }
+func (c *cell) Json() string            { return c.value.Json() }
+
+// deref is the value of a variable, which may be in a cell
+func deref(value object.Object) object.Object {
+	if c, ok := value.(*cell); ok {
+		return c.value
 	}
+	return value
 }
 
-func (vm *VM) executeArrayIndex(array, index object.Object) error {
-	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
-	if i < 0 || i > max {
-		return vm.push(Null)
+// pushResult pushes the result of an operation the evaluator shares, raising it when it is an error
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		return &thrownError{err: err}
 	}
-	return vm.push(arrayObject.Elements[i])
+	return vm.push(result)
 }
 
-func (vm *VM) executeHashIndex(hash, index object.Object) error {
-	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+// getProperty looks up object->name, methods are bound to the object
+func (vm *VM) getProperty(left object.Object, name string) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Error:
+		if value := left.Field(name); value != nil {
+			return value, nil
+		}
+		return Null, nil
+	case *object.ObjectInstance:
+		value, ok := left.Environment.Get(name, "")
+		if !ok {
+			return Null, nil
+		}
+		if method, ok := value.(*object.Closure); ok && method.This == nil {
+			return method.Bind(left, left.Environment), nil
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("cannot get member %s of %s", name, left.Type())
+	}
+}
 
+// getStatic looks up Class::name in the class and then in its parents, methods are bound to the class
+func (vm *VM) getStatic(left object.Object, name string) (object.Object, error) {
+	class, ok := left.(*object.Class)
+	if !ok {
+		return nil, fmt.Errorf("left is not class")
+	}
+	if strings.HasPrefix(name, "_") {
+		return nil, fmt.Errorf("class call can not with _ start, method is:%s", name)
+	}
+	value, ok := class.Environment.Get(name, "")
 	if !ok {
-		return fmt.Errorf("unusable as hash key : %s", index.Type())
+		for _, parent := range class.Parents {
+			value, err := vm.getStatic(parent, name)
+			if err != nil || value != Null {
+				return value, err
+			}
+		}
+		return Null, nil
+	}
+	if method, ok := value.(*object.Closure); ok && method.This == nil {
+		return method.Bind(class, class.Environment), nil
+	}
+	return value, nil
+}
+
+// buildClass creates a class from the name and value pairs of its members followed by its parents
+func (vm *VM) buildClass(name string, startIndex int, numMembers int, numParents int) (*object.Class, error) {
+	class := &object.Class{Name: name, Parents: []*object.Class{}, Environment: object.NewEnvironment()}
+	for i := startIndex; i < startIndex+numMembers; i += 2 {
+		memberName := vm.stack[i].(*object.String).Value
+		class.Environment.Set(memberName, vm.stack[i+1], "")
+	}
+	for i := startIndex + numMembers; i < startIndex+numMembers+numParents; i++ {
+		parent, ok := vm.stack[i].(*object.Class)
+		if !ok {
+			return nil, fmt.Errorf("parent is not a class")
+		}
+		class.Parents = append(class.Parents, parent)
 	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	return class, nil
+}
+
+// executeNew creates an object of the class below the arguments on the stack and calls its __init method
+func (vm *VM) executeNew(numArgs int) error {
+	classIndex := vm.sp - 1 - numArgs
+	class, ok := vm.stack[classIndex].(*object.Class)
 	if !ok {
-		return vm.push(Null)
+		return fmt.Errorf("class not found: %s", vm.stack[classIndex].Inspect())
+	}
+	instance := &object.ObjectInstance{InstanceClass: class, Environment: object.NewEnvironment()}
+	copyClassMembers(class, instance, instance.Environment, false)
+
+	init, ok := instance.Environment.Get("__init", "")
+	initMethod, isMethod := init.(*object.Closure)
+	if !ok || !isMethod {
+		vm.sp = classIndex
+		return vm.push(instance)
+	}
+	// __init always runs on the members of the object, also when it comes from a parent class
+	initMethod = initMethod.Bind(instance, instance.Environment)
+	vm.stack[classIndex] = initMethod
+	err := vm.callClosure(initMethod, numArgs)
+	if err != nil {
+		return err
+	}
+	vm.currentFrame().isConstructor = true
+	return nil
+}
+
+// copyClassMembers gives a new object the members of its class and parent classes, like the evaluator does:
+// methods of a parent class are bound to an environment of their own holding the members of that parent,
+// and private members of a parent are only visible to the methods of the parent
+func copyClassMembers(class *object.Class, instance *object.ObjectInstance, env *object.Environment, isParent bool) {
+	parentEnv := object.NewEnclosedEnviroment(env)
+	for _, parent := range class.Parents {
+		copyClassMembers(parent, instance, env, true)
+	}
+	for name, member := range class.Environment.GetAll() {
+		if method, ok := member.(*object.Closure); ok && isParent {
+			member = method.Bind(instance, parentEnv)
+		}
+		parentEnv.Set(name, member, "")
+		if isParent && strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "__") {
+			continue
+		}
+		env.Set(name, member, "")
 	}
-	return vm.push(pair.Value)
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashedPairs := make(map[object.HashKey]object.HashPair)
+	hash := &object.Hash{}
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
-		pair := object.HashPair{Key: key, Value: value}
 
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key %s", key.Type())
 		}
-		hashedPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
-	return &object.Hash{Pairs: hashedPairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
@@ -309,6 +781,15 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 	}
 	return &object.Array{Elements: elements}
 }
+
+// buildTemplate joins the text and the ${...} values of a string, printed the way puts prints them
+func (vm *VM) buildTemplate(startIndex, endIndex int) object.Object {
+	var out strings.Builder
+	for i := startIndex; i < endIndex; i++ {
+		out.WriteString(vm.stack[i].Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
 func (vm *VM) executeCall(numArgs int) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
@@ -323,9 +804,23 @@ func (vm *VM) executeCall(numArgs int) error {
 
 func (vm *VM) callBulitin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	var result object.Object
+	if builtin.CallFn != nil {
+		result = builtin.CallFn(vm.callBack, args...)
+	} else {
+		result = builtin.Fn(args...)
+	}
 	vm.sp = vm.sp - numArgs - 1
 
+	if errorObject, ok := result.(*object.Error); ok && !errorObject.Caught {
+		if !errorObject.Position.IsValid() {
+			errorObject.Stack = vm.stackTrace()
+			errorObject.Position = errorObject.Stack[0].Position
+		}
+		// an error returned by a builtin stops the program like in the evaluator, unless it is caught
+		return &thrownError{err: errorObject}
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -334,11 +829,28 @@ func (vm *VM) callBulitin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
+	if numArgs < cl.Fn.NumParameters-cl.Fn.NumDefaults {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
+	// extra arguments are dropped, the evaluator ignores them too
+	if numArgs > cl.Fn.NumParameters {
+		vm.sp -= numArgs - cl.Fn.NumParameters
+		numArgs = cl.Fn.NumParameters
+	}
+	// parameters left out are passed as null, the function sets them to their default
+	for ; numArgs < cl.Fn.NumParameters; numArgs++ {
+		err := vm.push(Null)
+		if err != nil {
+			return err
+		}
+	}
 	frame := NewFrame(cl, vm.sp-numArgs)
 	vm.pushFrame(frame)
+	// locals left over from an earlier call must not show as values in the debugger,
+	// nor share a cell with the closures of that call
+	for i := vm.sp; i < frame.basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
@@ -356,33 +868,57 @@ func isTruthy(obj object.Object) bool {
 func (vm *VM) executeMinusOperator() error {
 	operand := vm.pop()
 
-	if operand.Type() != object.INTEGER_OBJ {
-		return fmt.Errorf("unsupported type for negation : %s", operand.Type())
+	switch operand := operand.(type) {
+	case *object.Integer:
+		return vm.push(&object.Integer{Value: -operand.Value})
+	case *object.Float:
+		return vm.push(&object.Float{Value: -operand.Value})
 	}
-	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return fmt.Errorf("unsupported type for negation : %s", operand.Type())
 }
 
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False:
-		return vm.push(True)
-	case Null:
+	switch operand := operand.(type) {
+	case *object.Boolean:
+		return vm.push(nativeBoolToBooleanObject(!operand.Value))
+	case *object.Null:
 		return vm.push(True)
 	default:
 		return vm.push(False)
 	}
 }
 
+// operators are the operators of the arithmetic and comparison opcodes, as object.Arithmetic and object.Compare take them
+var operators = map[code.OpCode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpGreaterEqual: ">=",
+}
+
 func (vm *VM) executeComparision(op code.OpCode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
-		return vm.executeIntegerComparison(op, left, right)
+	switch {
+	case object.IsNumber(left) && object.IsNumber(right):
+		result, _ := object.Compare(operators[op], left, right)
+		return vm.push(nativeBoolToBooleanObject(result))
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ && (op == code.OpEqual || op == code.OpNotEqual):
+		equal := left.(*object.String).Value == right.(*object.String).Value
+		return vm.push(nativeBoolToBooleanObject(equal == (op == code.OpEqual)))
 	}
 	switch op {
 	case code.OpEqual:
@@ -394,24 +930,6 @@ func (vm *VM) executeComparision(op code.OpCode) error {
 	}
 }
 
-func (vm *VM) executeIntegerComparison(op code.OpCode, left, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	switch op {
-	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue == leftValue))
-	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(rightValue != leftValue))
-	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
-	case code.OpGreaterEqual:
-		return vm.push(nativeBoolToBooleanObject(leftValue >= rightValue))
-	default:
-		return fmt.Errorf("unknown operator: %d", op)
-	}
-}
-
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return True
@@ -419,6 +937,26 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return False
 }
 
+// executeIteratorNext replaces the iterator on the stack with the values of the names of a for in loop
+// and true, or with false when the loop is done
+func (vm *VM) executeIteratorNext(numNames int) error {
+	iterator := vm.pop().(*object.Iterator)
+	values, ok := iterator.Next(numNames)
+	if !ok {
+		if err := iterator.Err(); err != nil {
+			return err
+		}
+		return vm.push(False)
+	}
+	for _, value := range values {
+		err := vm.push(value)
+		if err != nil {
+			return err
+		}
+	}
+	return vm.push(True)
+}
+
 func (vm *VM) executeBinaryOperation(op code.OpCode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -426,8 +964,12 @@ func (vm *VM) executeBinaryOperation(op code.OpCode) error {
 	rightType := right.Type()
 
 	switch {
-	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
-		return vm.executeBinaryIntegerOperation(op, left, right)
+	case object.IsNumber(left) && object.IsNumber(right):
+		result := object.Arithmetic(operators[op], left, right)
+		if err, ok := result.(*object.Error); ok {
+			return &thrownError{err: err}
+		}
+		return vm.push(result)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
 	default:
@@ -444,27 +986,6 @@ func (vm *VM) executeBinaryStringOperation(op code.OpCode, left object.Object, r
 	return vm.push(&object.String{Value: leftValue + rightValue})
 }
 
-func (vm *VM) executeBinaryIntegerOperation(op code.OpCode, left object.Object, right object.Object) error {
-	leftValue := left.(*object.Integer).Value
-	rightValue := right.(*object.Integer).Value
-
-	var result int64
-
-	switch op {
-	case code.OpAdd:
-		result = leftValue + rightValue
-	case code.OpSub:
-		result = leftValue - rightValue
-	case code.OpMul:
-		result = leftValue * rightValue
-	case code.OpDiv:
-		result = leftValue / rightValue
-	default:
-		return fmt.Errorf("unkown integer operator: %d", op)
-	}
-	return vm.push(&object.Integer{Value: result})
-}
-
 func (vm *VM) pop() object.Object {
 	o := vm.stack[vm.sp-1]
 	vm.sp--
@@ -1,11 +1,16 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"z/ast"
 	"z/compile"
 	"z/lexer"
+	"z/module"
 	"z/object"
 	"z/parser"
 )
@@ -33,6 +38,11 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"-10", -10},
 		{"-50 + 100 + -50", 0},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"-7 / 2", -3},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"0xff & 0b1010 | 1 << 4", 26},
+		{"1_000 ^ 0o7", 1007},
 	}
 	runVmTests(t, tests)
 }
@@ -110,13 +120,29 @@ func TestHashLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHashBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{"keys({2: 1, 1: 2})", []int{2, 1}},
+		{"values({2: 1, 1: 2})", []int{1, 2}},
+		{"let h = {1: 1}; delete(h, 1)", true},
+		{"let h = {1: 1}; delete(h, 2)", false},
+		{"let h = {1: 1, 2: 2}; delete(h, 1); h[1] = 3; keys(h)", []int{2, 1}},
+		{"has_key({1: 0}, 1) == true", true},
+		{"has_key({}, 1)", false},
+		{"values(merge({1: 1, 2: 2}, {2: 3, 3: 4}))", []int{1, 3, 4}},
+		{"keys(1)", &object.Error{Message: "argument 1 to `keys` must be Hash, got=INTEGER"}},
+	}
+	runVmTests(t, tests)
+}
+
 func TestIndexExpress(t *testing.T) {
 	tests := []vmTestCase{
 		{"[1,2,3][1]", 2},
 		{"[1,2,3][0 + 2]", 3},
 		{"[[1,1,1]][0][0]", 1},
 		{"[1,2,3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1][-1]", 1},
+		{"[1][-2]", Null},
 		{"{1:1, 2:2}[1]", 1},
 		{"{1:1, 2:2}[2]", 2},
 		{"{1:1}[0]", Null},
@@ -125,6 +151,53 @@ func TestIndexExpress(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestNullAndOptionalChaining(t *testing.T) {
+	tests := []vmTestCase{
+		{"null", Null},
+		{"null ?? 5", 5},
+		{"0 ?? 5", 0},
+		{"false ?? true", false},
+		{`{"a": 1}["b"] ?? 2`, 2},
+		{"[1][3] ?? 4", 4},
+		{"let a = null; a?->b->c(1)[2]", Null},
+		{`let a = null; a?.[0]["b"] ?? 3`, 3},
+		{`let h = {"a": [7]}; h?.["a"]?.[0]`, 7},
+		{"class A {let n = 1}; let a = new A(); a?->n + (a->m ?? 1)", 2},
+		{"class A {}; A::missing ?? 6", 6},
+		{"try { let a = 1; a->b } catch (e) { e->message }", "cannot get member b of INTEGER"},
+	}
+	runVmTests(t, tests)
+}
+
+func TestArrayMutation(t *testing.T) {
+	tests := []vmTestCase{
+		{"let a = [1, 2, 3]; a[0] = 5; a", []int{5, 2, 3}},
+		{"let a = [1, 2, 3]; a[-1] += 10; a[2]", 13},
+		{"let m = [[1], [2]]; m[1][0] = 7; m[1]", []int{7}},
+		{`let h = {"a": [1]}; h["a"][0]++; h["a"]`, []int{2}},
+		{"[1, 2, 3, 4][1:3]", []int{2, 3}},
+		{"[1, 2, 3, 4][-2:]", []int{3, 4}},
+		{"[1, 2, 3][:-1]", []int{1, 2}},
+		{"[1, 2, 3][5:9]", []int{}},
+		{`"héllo"[1:3]`, "él"},
+		{`"héllo"[-1]`, "o"},
+		{"let a = [1]; append(a, 2, 3); a", []int{1, 2, 3}},
+		{"let a = [1, 2, 3]; pop(a) + shift(a) * 10 + len(a) * 100", 113},
+		{"let a = [1, 3]; insert(a, 1, 2); insert(a, -1, 4); a", []int{1, 2, 3, 4}},
+		{"let a = [1, 2, 3]; remove(a, -2) * 10 + len(a)", 22},
+		{"sort([3, 1, 2])", []int{1, 2, 3}},
+		{"reverse(sort([2.5, 1, 3]))[1] == 2.5", true},
+		{"sort([1, 3, 2], fn(x, y) { y - x })", []int{3, 2, 1}},
+		{`fn longest(words) { sort(words, fn(x, y) { len(y) - len(x) })[0] }; longest(["ab", "abcd", "abc"])`, "abcd"},
+		{"let a = [1, 2]; a[2] = 3", &object.Error{Message: "index 2 out of range for array of length 2"}},
+		{"remove([1], 1)", &object.Error{Message: "index 1 out of range for array of length 1"}},
+		{"pop([])", &object.Error{Message: "pop from an empty array"}},
+		{"[1][0:true]", &object.Error{Message: "slice bounds must be INTEGER, got=BOOLEAN"}},
+		{"try { sort([1, 2], fn(x, y) { throw \"no\" }) } catch (e) { e->message }", "no"},
+	}
+	runVmTests(t, tests)
+}
+
 func TestConditionals(t *testing.T) {
 	tests := []vmTestCase{
 		{"if (true) { 10 }", 10},
@@ -384,6 +457,11 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 		vm := New(comp.Bytecode())
 		err = vm.Run()
 
+		// errors returned by builtins stop the vm, the error is the result of the program
+		if thrown, ok := errors.Unwrap(err).(*thrownError); ok {
+			testExpectedObject(t, tt.expected, thrown.err)
+			continue
+		}
 		if err != nil {
 			t.Fatalf("vm error:%s", err)
 		}
@@ -396,16 +474,17 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	tests := []vmTestCase{
 		{
+			// extra arguments are dropped, like in the evaluator
 			input:    `fn() { 1; }(1);`,
-			expected: `wrong number of arguments: want=0, got=1`,
+			expected: 1,
 		},
 		{
 			input:    `fn(a) { a;}();`,
-			expected: `wrong number of arguments: want=1, got=0`,
+			expected: `1:12: wrong number of arguments: want=1, got=0`,
 		},
 		{
 			input:    `fn(a, b) { a + b;}(1);`,
-			expected: `wrong number of arguments: want=2, got=1`,
+			expected: `1:19: wrong number of arguments: want=2, got=1`,
 		},
 	}
 	for _, tt := range tests {
@@ -421,6 +500,13 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 
 		err = vm.Run()
 
+		if _, ok := tt.expected.(int); ok {
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+			continue
+		}
 		if err == nil {
 			t.Fatalf("expected VM error but resulted in none.")
 		}
@@ -634,13 +720,13 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 			return
 		}
 
-		if len(hash.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of pairs. wnat=%d, got=%d", len(expected), len(hash.Pairs))
+		if hash.Len() != len(expected) {
+			t.Errorf("hash has wrong number of pairs. wnat=%d, got=%d", len(expected), hash.Len())
 			return
 		}
 
-		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
+		for _, pair := range hash.Pairs() {
+			expectedValue, ok := expected[pair.Key.(object.Hashable).HashKey()]
 			if !ok {
 				t.Errorf("no pair for given key in pair")
 			}
@@ -722,3 +808,326 @@ func TestRecursiveFibonalcci(t *testing.T) {
 	}
 	runVmTests(t, tests)
 }
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+  x + true
+}
+let outer = fn(y) {
+  inner(y)
+}
+outer(1)`
+	program := parse(input)
+	compile := compile.New()
+	err := compile.Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	vm := New(compile.Bytecode())
+	err = vm.Run()
+	runtimeError, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected RuntimeError. got=%T (%+v)", err, err)
+	}
+	expectedError := "2:5: unsupported types for binary operation: INTEGER BOOLEAN"
+	if runtimeError.Error() != expectedError {
+		t.Errorf("wrong vm error: want=%q, got=%q", expectedError, runtimeError.Error())
+	}
+	expected := "\tat inner (2:5)\n\tat outer (5:8)\n\tat main (7:6)\n"
+	if runtimeError.Stack.String() != expected {
+		t.Errorf("wrong stack trace: want=%q, got=%q", expected, runtimeError.Stack.String())
+	}
+}
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		{input: `try { 1 } catch (e) { 2 }`, expected: 1},
+		{input: `try { throw 1; 2 } catch (e) { 3 }`, expected: 3},
+		{input: `try { throw "boom"; } catch (e) { get_error_message(e) }`, expected: "boom"},
+		{input: `try { 1 + true } catch { 5 }`, expected: 5},
+		{input: `let f = fn() { throw 1; }; try { f() } catch (e) { 10 }`, expected: 10},
+		{input: `let f = fn(x) { try { x + true } catch { x * 2 } }; f(3) + f(4)`, expected: 14},
+		{input: `try { 1 } finally { 2 }`, expected: 1},
+		{input: `let f = fn() { try { return 1; } finally { return 2; } }; f()`, expected: 2},
+		{input: `let f = fn() { try { throw 1; } finally { return 4; } }; f()`, expected: 4},
+		{input: `let f = fn() { try { throw 1; } catch { return 3; } finally { 5 } }; f()`, expected: 3},
+		{input: `let f = fn() { try { throw 1; } finally { 5 } }; try { f() } catch (e) { 6 }`, expected: 6},
+		{input: `try { try { throw 1; } catch (e) { throw e; } } catch (e) { 8 }`, expected: 8},
+	}
+	runVmTests(t, tests)
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	program := parse("let f = fn() {\n  throw \"boom\";\n}\nf()")
+	compile := compile.New()
+	err := compile.Compile(program)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	vm := New(compile.Bytecode())
+	err = vm.Run()
+	runtimeError, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("expected RuntimeError. got=%T (%+v)", err, err)
+	}
+	if runtimeError.Error() != "2:3: boom" {
+		t.Errorf("wrong vm error: want=%q, got=%q", "2:3: boom", runtimeError.Error())
+	}
+	expected := "\tat f (2:3)\n\tat main (4:2)\n"
+	if runtimeError.Stack.String() != expected {
+		t.Errorf("wrong stack trace: want=%q, got=%q", expected, runtimeError.Stack.String())
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = 0; while (a < 5) { a = a + 1 }; a`, 5},
+		{`let a = 0; while (true) { a++; if (a > 2) { break } }; a`, 3},
+		{`let s = 0; for (let i = 0; i < 5; i++) { s += i }; s`, 10},
+		{
+			input: `
+			let f = fn() {
+				let i = 0
+				while (true) {
+					i++
+					if (i == 4) {
+						return i
+					}
+				}
+			}
+			f()
+			`,
+			expected: 4,
+		},
+		{`let i = 0; while (i < 3) { try { i++; break } finally { i = i + 10 } }; i`, 11},
+		{`let s = 0; for (x in [1, 2, 3]) { s += x }; s`, 6},
+		{`let s = ""; for (k, v in {"a": "1", "b": "2"}) { s = s + k + v }; s`, "a1b2"},
+		{`let s = ""; for (k in {"a": 1, "b": 2}) { s = s + k }; s`, "ab"},
+		{`let s = ""; for (i, c in "héllo") { if (i == 1) { continue }; s = s + c }; s`, "hllo"},
+		{`for (x in [1, 2, 3]) { x * 2 }`, 6},
+		{`for (x in []) { x }`, Null},
+		{`let s = 0; for (let i = 0; i < 6; i++) { if (i % 2 == 0) { continue }; s += i }; s`, 9},
+		{
+			input: `
+			let n = 0
+			outer: for (i in [1, 2, 3]) {
+				for (j in [1, 2, 3]) {
+					if (j == 2) { continue outer }
+					if (i == 3) { break outer }
+					n = n * 10 + i
+				}
+			}
+			n
+			`,
+			expected: 12,
+		},
+		{
+			input: `
+			let f = fn(items) {
+				for (item in items) {
+					if (item > 1) { return item }
+				}
+				0
+			}
+			f([1, 5, 7])
+			`,
+			expected: 5,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []vmTestCase{
+		{`let a = 1; a = 2; a`, 2},
+		{`let a = 1; a += 2; a -= 1; a *= 6; a /= 3; a`, 4},
+		{`let f = fn() { let a = 1; a = a + 1; a }; f()`, 2},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`true && false`, false},
+		{`false || true`, true},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFloatsAndStrings(t *testing.T) {
+	tests := []vmTestCase{
+		{`1.5 + 1.5 == 3.0`, true},
+		{`2.5 > 1.0`, true},
+		{`"a" == "a"`, true},
+		{`"a" != "b"`, true},
+		{`"abc"[1]`, "b"},
+		{`!0`, false},
+	}
+	runVmTests(t, tests)
+}
+
+func TestFunctionDefaults(t *testing.T) {
+	tests := []vmTestCase{
+		{`fn add(a, b = 2) { a + b }; add(1)`, 3},
+		{`fn add(a, b = 2) { a + b }; add(1, 5)`, 6},
+		{`fn one() { 1 }; one(2)`, 1},
+		{`fn later() { first_defined() }; fn first_defined() { 7 }; later()`, 7},
+		{`fn f() { let a = 1; defer { a = 2 }; a }; f()`, 1},
+	}
+	runVmTests(t, tests)
+}
+
+func TestClasses(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			class Person {
+				let name = "seven"
+				fn get_name() { name }
+				fn set_name(n) { name = n }
+			}
+			let p = new Person()
+			p->set_name("pan")
+			p->get_name()
+			`,
+			expected: "pan",
+		},
+		{
+			input: `
+			class Counter {
+				let count = 0
+				fn __init(start) { count = start }
+				fn next() { count = count + 1; this->count }
+			}
+			let c = new Counter(5)
+			c->next()
+			`,
+			expected: 6,
+		},
+		{
+			input: `
+			class Animal {
+				let _secret = 1
+				fn name() { "animal" }
+			}
+			class Dog extends Animal {
+				fn bark() { name() + " barks" }
+			}
+			let d = new Dog()
+			d->bark()
+			`,
+			expected: "animal barks",
+		},
+		{
+			input: `
+			class Math {
+				fn double(a) { a * 2 }
+			}
+			Math::double(4)
+			`,
+			expected: 8,
+		},
+		{
+			input: `
+			class Pair {
+				let a = 1
+				fn set(v) { a = v }
+			}
+			let x = new Pair()
+			let y = new Pair()
+			x->set(3)
+			y->a
+			`,
+			expected: 1,
+		},
+	}
+	runVmTests(t, tests)
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"counter.z": "package counter\nexport let count = 0\nexport fn add() { count = count + 1 }\nlet hidden = 1\nexport class Base { fn get() { 40 } }",
+		"main.z":    "import \"counter\"\nclass Child extends counter.Base {}\ncounter.add()\ncounter.add()\ncounter.count + new Child()->get()",
+		"hidden.z":  "import \"counter\"\nhidden",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	main, err := module.NewLoader(module.NewResolver("", "")).Load(filepath.Join(dir, "main.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compile.New()
+	if err := comp.CompileModule(main); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 42, machine.LastPoppedStackElem())
+
+	main, err = module.NewLoader(module.NewResolver("", "")).Load(filepath.Join(dir, "hidden.z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = compile.New().CompileModule(main)
+	if err == nil || !strings.Contains(err.Error(), "undefined variable hidden") {
+		t.Errorf("a name that is not exported is seen. got=%v", err)
+	}
+}
+
+// TestStandardShadowsBuiltin checks that a function of the standard library named like a builtin,
+// file.append, is called by its qualified name and that the builtin is still there by its own
+func TestStandardShadowsBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.z")
+	src := "import \"file\"\ntypeof(file.append) + \" \" + typeof(append)"
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	main, err := module.NewLoader(module.NewResolver(filepath.Join("..", "..", ".."), "")).Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compile.New()
+	if err := comp.CompileModule(main); err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, "function builtin", machine.LastPoppedStackElem())
+}
+
+func TestJson(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"rows.json":  `[{"n": 1}, {"n": 2}, {"n": 3}]`,
+		"lines.json": "4\n5\n",
+		"bad.json":   `[1, x]`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := func(name string) string { return strings.ReplaceAll(filepath.Join(dir, name), `\`, `\\`) }
+
+	tests := []vmTestCase{
+		{`json_decode("[1, 2]")`, []int{1, 2}},
+		{`json_decode("{\"a\": {\"b\": 3}}")["a"]["b"]`, 3},
+		{`json_encode({"q": "\"\n"})`, `{"q": "\"\n"}`},
+		{`json_encode([1.0, json_decode("null"), true])`, `[1.0, null, true]`},
+		{`json_decode("[1,")`, &object.Error{Message: "json_decode: unexpected end of JSON input at 1:4"}},
+		{fmt.Sprintf(`let sum = 0; for row in json_stream("%s") { sum += row["n"] }; sum`, path("rows.json")), 6},
+		{fmt.Sprintf(`let sum = 0; for i, n in json_stream("%s") { sum += i * n }; sum`, path("lines.json")), 5},
+		{fmt.Sprintf(`try { for n in json_stream("%s") { n } } catch (e) { e->message }`, path("bad.json")),
+			"json_stream: invalid character 'x' looking for beginning of value at byte 4"},
+		// a loop left early closes the stream, a loop over it again gets nothing
+		{fmt.Sprintf(`let s = json_stream("%s"); for row in s { break }; let n = 0; for row in s { n += 1 }; n`, path("rows.json")), 0},
+		{fmt.Sprintf(`let s = json_stream("%s"); outer: for i in [1, 2] { for row in s { continue outer } }; let n = 0; for row in s { n += 1 }; n`, path("rows.json")), 0},
+		{fmt.Sprintf(`let s = json_stream("%s"); let first = fn() { for row in s { return row } }; first(); let n = 0; for row in s { n += 1 }; n`, path("rows.json")), 0},
+	}
+	runVmTests(t, tests)
+}